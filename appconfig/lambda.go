@@ -0,0 +1,89 @@
+package appconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/benjaminkitson/bk-auth-api/secrets"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.uber.org/zap"
+)
+
+// The user pool and app client the API lambdas use, both set on each function by the CDK stack
+type Cognito struct {
+	UserPoolID string `config:"COGNITO_USER_POOL_ID,required"`
+	// Usually a reference to the COGNITO_CLIENT secret
+	ClientID string `config:"COGNITO_CLIENT_ID,required"`
+}
+
+type UserAPI struct {
+	// Usually a reference to the SSM parameter the user API's stack writes its endpoint to
+	URL string `config:"USER_API_URL,required"`
+}
+
+// The DynamoDB table the rate limiters share. Without one each instance only limits the requests it serves itself.
+type RateLimit struct {
+	Table string `config:"RATE_LIMIT_TABLE"`
+}
+
+/*
+The sources lambdas load their config from, in order:
+  - environment variables
+  - the JSON or YAML file at CONFIG_FILE, for running locally
+  - SSM parameters under CONFIG_SSM_PATH
+  - fields of the JSON secret named by CONFIG_SECRET
+
+Only the environment is used unless the others are set. Secrets are cached as set by SECRETS_CACHE_TTL.
+*/
+func FromEnv(ctx context.Context) (Loader, error) {
+	l := NewLoader(EnvSource{})
+
+	if f := os.Getenv("CONFIG_FILE"); f != "" {
+		s, err := FileSource(f)
+		if err != nil {
+			return l, err
+		}
+		l.Sources = append(l.Sources, s)
+	}
+
+	sdkConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return l, err
+	}
+	// Traced with the global provider, so loading config shows up once tracing.FromEnv has run
+	otelaws.AppendMiddlewares(&sdkConfig.APIOptions)
+	cache, err := secrets.CacheFromEnv()
+	if err != nil {
+		return l, err
+	}
+	sc, err := secrets.NewCachingClient(zap.NewNop(), secretsmanager.NewFromConfig(sdkConfig), cache)
+	if err != nil {
+		return l, err
+	}
+	l.SSM = ssm.NewFromConfig(sdkConfig)
+	l.Secrets = sc
+
+	if p := os.Getenv("CONFIG_SSM_PATH"); p != "" {
+		l.Sources = append(l.Sources, NewSSMSource(l.SSM, p))
+	}
+	if s := os.Getenv("CONFIG_SECRET"); s != "" {
+		l.Sources = append(l.Sources, NewSecretSource(l.Secrets, s))
+	}
+	return l, nil
+}
+
+/*
+Loads dst with the sources from FromEnv, for lambdas to call before they start so that a missing or invalid setting
+stops them starting rather than failing every request
+*/
+func LoadFromEnv(ctx context.Context, dst interface{}) error {
+	l, err := FromEnv(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialise config sources: %w", err)
+	}
+	return l.Load(ctx, dst)
+}
@@ -0,0 +1,180 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjaminkitson/bk-auth-api/secrets"
+)
+
+// Values with these prefixes are references, resolved from SSM or Secrets Manager wherever they were found
+const (
+	SSMPrefix    = "ssm:"
+	SecretPrefix = "secret:"
+)
+
+// Returned (wrapped) by Load when required settings couldn't be found anywhere
+var ErrMissing = errors.New("missing required config")
+
+/*
+Fills in structs from layered sources. Each setting is looked up in the sources in order and the first to have it
+wins, so the environment can override a file, and a file can override SSM.
+
+Settings are struct fields tagged with the key to look up, e.g.
+
+	PoolID string `config:"COGNITO_USER_POOL_ID,required"`
+	TTL time.Duration `config:"CACHE_TTL" default:"5m"`
+
+Fields can be strings, bools, ints, durations, or comma separated string slices. Nested and embedded structs are
+filled in too. Any value can be a reference to an SSM parameter ("ssm:/http-endpoints/user-api") or a secret
+("secret:COGNITO_CLIENT", or "secret:bk-auth/mailer#apiKey" for a field of a JSON secret), which needs the SSM
+client or secret getter to resolve.
+*/
+type Loader struct {
+	Sources []Source
+	SSM     SSMClient
+	Secrets secrets.SecretGetter
+}
+
+func NewLoader(sources ...Source) Loader {
+	return Loader{Sources: sources}
+}
+
+// Looks the key up in each source in turn, resolving references
+func (l Loader) Lookup(ctx context.Context, key string) (string, bool, error) {
+	for _, s := range l.Sources {
+		v, ok, err := s.Lookup(ctx, key)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to look up %s: %w", key, err)
+		}
+		if !ok {
+			continue
+		}
+		v, err = l.resolve(ctx, v)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		return v, true, nil
+	}
+	return "", false, nil
+}
+
+func (l Loader) resolve(ctx context.Context, v string) (string, error) {
+	if name, ok := strings.CutPrefix(v, SSMPrefix); ok {
+		if l.SSM == nil {
+			return "", fmt.Errorf("no SSM client to resolve %s", v)
+		}
+		p, found, err := getParameter(ctx, l.SSM, name)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("parameter %s not found", name)
+		}
+		return p, nil
+	}
+	if ref, ok := strings.CutPrefix(v, SecretPrefix); ok {
+		if l.Secrets == nil {
+			return "", fmt.Errorf("no secrets client to resolve %s", v)
+		}
+		return l.Secrets.GetSecret(ctx, ref)
+	}
+	return v, nil
+}
+
+/*
+Fills in the struct dst points to. Every setting is tried, so the error covers everything that's wrong rather than
+just the first thing.
+*/
+func (l Loader) Load(ctx context.Context, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be loaded into a pointer to a struct, not %T", dst)
+	}
+
+	missing := []string{}
+	errs := l.load(ctx, v.Elem(), &missing)
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrMissing, strings.Join(missing, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+func (l Loader) load(ctx context.Context, v reflect.Value, missing *[]string) []error {
+	errs := []error{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag, ok := f.Tag.Lookup("config")
+		if !ok {
+			if f.Type.Kind() == reflect.Struct {
+				errs = append(errs, l.load(ctx, v.Field(i), missing)...)
+			}
+			continue
+		}
+
+		key, opts, _ := strings.Cut(tag, ",")
+		value, found, err := l.Lookup(ctx, key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !found {
+			value, found = f.Tag.Lookup("default")
+		}
+		if !found {
+			if opts == "required" {
+				*missing = append(*missing, key)
+			}
+			continue
+		}
+		if err := set(v.Field(i), value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", key, err))
+		}
+	}
+	return errs
+}
+
+func set(f reflect.Value, value string) error {
+	switch {
+	case f.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+	case f.Kind() == reflect.String:
+		f.SetString(value)
+	case f.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case f.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(n))
+	case f.Type() == reflect.TypeOf([]string{}):
+		s := []string{}
+		for _, p := range strings.Split(value, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				s = append(s, p)
+			}
+		}
+		f.Set(reflect.ValueOf(s))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+	return nil
+}
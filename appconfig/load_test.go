@@ -0,0 +1,218 @@
+package appconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/benjaminkitson/bk-auth-api/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockSSMClient struct {
+	isError    bool
+	parameters map[string]string
+}
+
+func (m MockSSMClient) GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("GetParameter error")
+	}
+	v, ok := m.parameters[aws.ToString(params.Name)]
+	if !ok {
+		return nil, &types.ParameterNotFound{}
+	}
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Value: aws.String(v)}}, nil
+}
+
+// Secrets by reference, including the #field
+type MockSecretGetter struct {
+	isError bool
+	secrets map[string]string
+}
+
+func (m MockSecretGetter) GetSecret(ctx context.Context, ref string) (string, error) {
+	if m.isError {
+		return "", fmt.Errorf("GetSecret error")
+	}
+	v, ok := m.secrets[ref]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", secrets.ErrFieldNotFound, ref)
+	}
+	return v, nil
+}
+
+type testConfig struct {
+	Cognito
+	UserAPI
+	Timeout time.Duration `config:"TIMEOUT" default:"5s"`
+	Retries int           `config:"RETRIES"`
+	Debug   bool          `config:"DEBUG"`
+	Origins []string      `config:"ORIGINS"`
+	Mailer  struct {
+		APIKey string `config:"MAILER_API_KEY"`
+	}
+	unexported string
+}
+
+func TestLoad(t *testing.T) {
+	l := Loader{
+		Sources: []Source{
+			MapSource{
+				"COGNITO_USER_POOL_ID": "eu-west-2_pool",
+				"COGNITO_CLIENT_ID":    "secret:COGNITO_CLIENT",
+				"RETRIES":              "3",
+				"DEBUG":                "true",
+				"ORIGINS":              "https://a.com, https://b.com,",
+			},
+			// Only used for what the first source doesn't have
+			MapSource{
+				"COGNITO_USER_POOL_ID": "eu-west-2_other",
+				"USER_API_URL":         "ssm:/http-endpoints/user-api",
+				"MAILER_API_KEY":       "secret:bk-auth/mailer#apiKey",
+			},
+		},
+		SSM: MockSSMClient{parameters: map[string]string{"/http-endpoints/user-api": "https://users.example.com"}},
+		Secrets: MockSecretGetter{secrets: map[string]string{
+			"COGNITO_CLIENT":        "client-id",
+			"bk-auth/mailer#apiKey": "key",
+		}},
+	}
+
+	var c testConfig
+	assert.Nil(t, l.Load(context.Background(), &c))
+	assert.Equal(t, "eu-west-2_pool", c.UserPoolID)
+	assert.Equal(t, "client-id", c.ClientID)
+	assert.Equal(t, "https://users.example.com", c.URL)
+	assert.Equal(t, 5*time.Second, c.Timeout)
+	assert.Equal(t, 3, c.Retries)
+	assert.True(t, c.Debug)
+	assert.Equal(t, []string{"https://a.com", "https://b.com"}, c.Origins)
+	assert.Equal(t, "key", c.Mailer.APIKey)
+}
+
+func TestLoadErrors(t *testing.T) {
+	type test struct {
+		Name          string
+		Loader        Loader
+		ExpectMissing bool
+		ExpectedError string
+	}
+
+	tests := []test{
+		{
+			Name:          "Missing required settings",
+			Loader:        NewLoader(MapSource{"COGNITO_USER_POOL_ID": "eu-west-2_pool"}),
+			ExpectMissing: true,
+			ExpectedError: "COGNITO_CLIENT_ID, USER_API_URL",
+		},
+		{
+			Name: "Invalid values",
+			Loader: NewLoader(MapSource{
+				"COGNITO_USER_POOL_ID": "eu-west-2_pool", "COGNITO_CLIENT_ID": "client-id", "USER_API_URL": "https://users.example.com",
+				"TIMEOUT": "soon", "RETRIES": "many",
+			}),
+			ExpectedError: "invalid TIMEOUT",
+		},
+		{
+			Name:          "Reference without a client",
+			Loader:        NewLoader(MapSource{"COGNITO_CLIENT_ID": "secret:COGNITO_CLIENT"}),
+			ExpectMissing: true,
+			ExpectedError: "no secrets client",
+		},
+		{
+			Name: "Missing parameter",
+			Loader: Loader{
+				Sources: []Source{MapSource{"USER_API_URL": "ssm:/missing"}},
+				SSM:     MockSSMClient{},
+			},
+			ExpectMissing: true,
+			ExpectedError: "parameter /missing not found",
+		},
+		{
+			Name: "Source error",
+			Loader: Loader{
+				Sources: []Source{NewSSMSource(MockSSMClient{isError: true}, "/bk-auth/dev")},
+			},
+			ExpectedError: "GetParameter error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var c testConfig
+			err := tt.Loader.Load(context.Background(), &c)
+			assert.ErrorContains(t, err, tt.ExpectedError)
+			assert.Equal(t, tt.ExpectMissing, errors.Is(err, ErrMissing))
+		})
+	}
+
+	assert.Error(t, NewLoader().Load(context.Background(), testConfig{}))
+}
+
+func TestSources(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("BK_AUTH_USER_API_URL", "https://users.example.com")
+	v, ok, err := EnvSource{Prefix: "BK_AUTH_"}.Lookup(ctx, "USER_API_URL")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "https://users.example.com", v)
+
+	s := NewSSMSource(MockSSMClient{parameters: map[string]string{"/bk-auth/dev/USER_API_URL": "https://users.example.com"}}, "/bk-auth/dev/")
+	v, ok, err = s.Lookup(ctx, "USER_API_URL")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "https://users.example.com", v)
+	_, ok, err = s.Lookup(ctx, "TIMEOUT")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ss := NewSecretSource(MockSecretGetter{secrets: map[string]string{"bk-auth/config#COGNITO_CLIENT_ID": "client-id"}}, "bk-auth/config")
+	v, ok, err = ss.Lookup(ctx, "COGNITO_CLIENT_ID")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "client-id", v)
+	_, ok, err = ss.Lookup(ctx, "TIMEOUT")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, _, err = NewSecretSource(MockSecretGetter{isError: true}, "bk-auth/config").Lookup(ctx, "TIMEOUT")
+	assert.Error(t, err)
+}
+
+func TestFileSource(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"COGNITO_USER_POOL_ID": "eu-west-2_pool", "RETRIES": 3, "DEBUG": true}`,
+		"config.yaml": "COGNITO_USER_POOL_ID: eu-west-2_pool\nRETRIES: 3\nDEBUG: true\n",
+		"config.yml":  "COGNITO_USER_POOL_ID: eu-west-2_pool\nRETRIES: 3\nDEBUG: true\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0o600))
+
+		s, err := FileSource(path)
+		assert.Nil(t, err, name)
+		assert.Equal(t, MapSource{"COGNITO_USER_POOL_ID": "eu-west-2_pool", "RETRIES": "3", "DEBUG": "true"}, s, name)
+	}
+
+	path := filepath.Join(dir, "config.toml")
+	assert.Nil(t, os.WriteFile(path, []byte(`RETRIES = 3`), 0o600))
+	_, err := FileSource(path)
+	assert.Error(t, err)
+
+	path = filepath.Join(dir, "broken.json")
+	assert.Nil(t, os.WriteFile(path, []byte(`{`), 0o600))
+	_, err = FileSource(path)
+	assert.Error(t, err)
+
+	_, err = FileSource(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,137 @@
+package appconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/benjaminkitson/bk-auth-api/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// Somewhere settings can come from. Not finding a key isn't an error, the next source is tried
+type Source interface {
+	Lookup(ctx context.Context, key string) (string, bool, error)
+}
+
+// Environment variables, named after the keys with the prefix in front
+type EnvSource struct {
+	Prefix string
+}
+
+func (s EnvSource) Lookup(ctx context.Context, key string) (string, bool, error) {
+	v, ok := os.LookupEnv(s.Prefix + key)
+	return v, ok, nil
+}
+
+type MapSource map[string]string
+
+func (s MapSource) Lookup(ctx context.Context, key string) (string, bool, error) {
+	v, ok := s[key]
+	return v, ok, nil
+}
+
+/*
+Reads a JSON or YAML file, depending on its extension, with the settings at the top level. Values that aren't strings
+are kept as JSON, so numbers and bools read as they're written.
+*/
+func FileSource(path string) (MapSource, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(b, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, expected .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	s := MapSource{}
+	for k, v := range values {
+		if str, ok := v.(string); ok {
+			s[k] = str
+			continue
+		}
+		j, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from config file %s: %w", k, path, err)
+		}
+		s[k] = string(j)
+	}
+	return s, nil
+}
+
+type SSMClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// Parameters named after the keys under a path, e.g. /bk-auth/prod/USER_API_URL
+type SSMSource struct {
+	client SSMClient
+	path   string
+}
+
+func NewSSMSource(c SSMClient, path string) SSMSource {
+	return SSMSource{
+		client: c,
+		path:   strings.TrimSuffix(path, "/") + "/",
+	}
+}
+
+func (s SSMSource) Lookup(ctx context.Context, key string) (string, bool, error) {
+	return getParameter(ctx, s.client, s.path+key)
+}
+
+func getParameter(ctx context.Context, c SSMClient, name string) (string, bool, error) {
+	o, err := c.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	var nf *types.ParameterNotFound
+	if errors.As(err, &nf) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return aws.ToString(o.Parameter.Value), true, nil
+}
+
+// Fields of a secret that's a JSON object, named after the keys
+type SecretSource struct {
+	getter secrets.SecretGetter
+	name   string
+}
+
+func NewSecretSource(g secrets.SecretGetter, name string) SecretSource {
+	return SecretSource{
+		getter: g,
+		name:   name,
+	}
+}
+
+func (s SecretSource) Lookup(ctx context.Context, key string) (string, bool, error) {
+	v, err := s.getter.GetSecret(ctx, s.name+"#"+key)
+	if errors.Is(err, secrets.ErrFieldNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
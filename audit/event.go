@@ -0,0 +1,154 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+)
+
+type Action string
+
+const (
+	ActionSignUp               Action = "sign_up"
+	ActionSignIn               Action = "sign_in"
+	ActionVerifyEmail          Action = "verify_email"
+	ActionRefresh              Action = "refresh"
+	ActionNewPassword          Action = "new_password"
+	ActionPasswordResetRequest Action = "password_reset_request"
+	ActionPasswordReset        Action = "password_reset"
+	ActionPasswordChange       Action = "password_change"
+	ActionAttributesUpdate     Action = "attributes_update"
+	ActionEmailChange          Action = "email_change"
+	ActionEmailChangeConfirm   Action = "email_change_confirm"
+	ActionAdminDelete          Action = "admin_delete"
+	ActionInvite               Action = "invite"
+	ActionRoleList             Action = "role_list"
+	ActionRoleAdd              Action = "role_add"
+	ActionRoleRemove           Action = "role_remove"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// The caller wasn't allowed to do it, e.g. a bad token, a missing role or too many attempts
+	OutcomeDenied  Outcome = "denied"
+	OutcomeFailure Outcome = "failure"
+)
+
+/*
+One audited request. Actor is whoever made the request, when it was authenticated by the API Gateway authorizer, and
+Subject is the user it was about. Both are hashed the same way as emails in the logs (see utils/logging), so the trail
+can be searched for a known user without holding anyone's address.
+*/
+type Event struct {
+	ID         string            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Action     Action            `json:"action"`
+	Outcome    Outcome           `json:"outcome"`
+	StatusCode int               `json:"statusCode"`
+	Reason     string            `json:"reason,omitempty"`
+	Actor      string            `json:"actor,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+	RequestID  string            `json:"requestId,omitempty"`
+	SourceIP   string            `json:"sourceIp,omitempty"`
+	UserAgent  string            `json:"userAgent,omitempty"`
+	Detail     map[string]string `json:"detail,omitempty"`
+}
+
+// Starts an event for the request, taking the subject from an "email" in the body if there is one
+func FromRequest(action Action, request events.APIGatewayProxyRequest) Event {
+	e := Event{
+		ID:        newID(),
+		Time:      time.Now().UTC(),
+		Action:    action,
+		Actor:     logging.HashEmail(auth.Caller(request)),
+		RequestID: request.RequestContext.RequestID,
+		SourceIP:  request.RequestContext.Identity.SourceIP,
+		UserAgent: request.RequestContext.Identity.UserAgent,
+	}
+	if e.UserAgent == "" {
+		e.UserAgent = utils.Header(request, "User-Agent")
+	}
+
+	b := []byte(request.Body)
+	if request.IsBase64Encoded {
+		b, _ = base64.StdEncoding.DecodeString(request.Body)
+	}
+	body := map[string]interface{}{}
+	if json.Unmarshal(b, &body) == nil {
+		if s, ok := body["email"].(string); ok {
+			e.Subject = logging.HashEmail(s)
+		}
+	}
+	return e
+}
+
+// Fills in the outcome from the handler's response, with any error code the response gave as the reason
+func (e *Event) complete(r events.APIGatewayProxyResponse, err error) {
+	e.StatusCode = r.StatusCode
+	switch {
+	case err != nil || r.StatusCode == 0:
+		e.Outcome = OutcomeFailure
+	case r.StatusCode < 300:
+		e.Outcome = OutcomeSuccess
+	case r.StatusCode == 401 || r.StatusCode == 403 || r.StatusCode == 429:
+		e.Outcome = OutcomeDenied
+	default:
+		e.Outcome = OutcomeFailure
+	}
+
+	body := map[string]interface{}{}
+	if json.Unmarshal([]byte(r.Body), &body) == nil {
+		if c, ok := body["code"].(string); ok {
+			e.Reason = c
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+type eventKey struct{}
+
+// Lets handlers add to the event Wrap is building for their request
+func eventFrom(ctx context.Context) *Event {
+	e, _ := ctx.Value(eventKey{}).(*Event)
+	return e
+}
+
+// Replaces the action Wrap was given, for handlers that do more than one thing
+func SetAction(ctx context.Context, a Action) {
+	if e := eventFrom(ctx); e != nil {
+		e.Action = a
+	}
+}
+
+// Sets the subject to the user with this email
+func SetSubject(ctx context.Context, email string) {
+	if e := eventFrom(ctx); e != nil {
+		e.Subject = logging.HashEmail(email)
+	}
+}
+
+func SetDetail(ctx context.Context, key string, value string) {
+	if e := eventFrom(ctx); e != nil {
+		if e.Detail == nil {
+			e.Detail = map[string]string{}
+		}
+		e.Detail[key] = value
+	}
+}
@@ -0,0 +1,87 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+)
+
+type KinesisClient interface {
+	PutRecords(context.Context, *kinesis.PutRecordsInput, ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+// The most records a single PutRecords call accepts
+const maxKinesisBatch = 500
+
+// How many times records Kinesis rejects, e.g. when throttled, are sent again
+const maxKinesisAttempts = 3
+
+// Writes events to a Kinesis data stream in batches, for delivery to longer term storage
+type KinesisSink struct {
+	client KinesisClient
+	stream string
+}
+
+func NewKinesisSink(c KinesisClient, stream string) *KinesisSink {
+	return &KinesisSink{
+		client: c,
+		stream: stream,
+	}
+}
+
+func (s *KinesisSink) Write(ctx context.Context, events []Event) error {
+	records := make([]types.PutRecordsRequestEntry, 0, len(events))
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		// Keeps each user's events in order on one shard
+		key := e.Subject
+		if key == "" {
+			key = e.ID
+		}
+		records = append(records, types.PutRecordsRequestEntry{
+			Data:         b,
+			PartitionKey: aws.String(key),
+		})
+	}
+
+	for len(records) > 0 {
+		n := min(len(records), maxKinesisBatch)
+		if err := s.put(ctx, records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+// Sends a batch, retrying whichever records failed
+func (s *KinesisSink) put(ctx context.Context, records []types.PutRecordsRequestEntry) error {
+	for i := 0; i < maxKinesisAttempts; i++ {
+		output, err := s.client.PutRecords(ctx, &kinesis.PutRecordsInput{
+			StreamName: aws.String(s.stream),
+			Records:    records,
+		})
+		if err != nil {
+			return err
+		}
+		if aws.ToInt32(output.FailedRecordCount) == 0 {
+			return nil
+		}
+
+		failed := []types.PutRecordsRequestEntry{}
+		for j, r := range output.Records {
+			if r.ErrorCode != nil && j < len(records) {
+				failed = append(failed, records[j])
+			}
+		}
+		records = failed
+	}
+	return fmt.Errorf("%d audit events not written to %s", len(records), s.stream)
+}
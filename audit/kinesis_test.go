@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockKinesisClient struct {
+	isError bool
+	// Fails the first record of this many calls, as if throttled
+	failFirst int
+	calls     *[]*kinesis.PutRecordsInput
+}
+
+func (m MockKinesisClient) PutRecords(ctx context.Context, params *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	*m.calls = append(*m.calls, params)
+	if m.isError {
+		return nil, fmt.Errorf("PutRecords error")
+	}
+	output := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int32(0)}
+	for i := range params.Records {
+		r := types.PutRecordsResultEntry{SequenceNumber: aws.String("1")}
+		if i == 0 && len(*m.calls) <= m.failFirst {
+			r = types.PutRecordsResultEntry{ErrorCode: aws.String("ProvisionedThroughputExceededException")}
+			output.FailedRecordCount = aws.Int32(1)
+		}
+		output.Records = append(output.Records, r)
+	}
+	return output, nil
+}
+
+func TestKinesisSink(t *testing.T) {
+	calls := []*kinesis.PutRecordsInput{}
+	s := NewKinesisSink(MockKinesisClient{calls: &calls}, "audit")
+
+	events := make([]Event, 501)
+	for i := range events {
+		events[i] = Event{ID: fmt.Sprint(i), Action: ActionSignIn}
+	}
+	events[0].Subject = "sha256:abc"
+
+	assert.NoError(t, s.Write(context.Background(), events))
+	// Split into batches Kinesis accepts
+	assert.Len(t, calls, 2)
+	assert.Len(t, calls[0].Records, 500)
+	assert.Len(t, calls[1].Records, 1)
+	assert.Equal(t, "audit", aws.ToString(calls[0].StreamName))
+	assert.Equal(t, "sha256:abc", aws.ToString(calls[0].Records[0].PartitionKey))
+	assert.Equal(t, "1", aws.ToString(calls[0].Records[1].PartitionKey))
+
+	var e Event
+	assert.NoError(t, json.Unmarshal(calls[1].Records[0].Data, &e))
+	assert.Equal(t, "500", e.ID)
+}
+
+func TestKinesisSinkRetriesFailedRecords(t *testing.T) {
+	calls := []*kinesis.PutRecordsInput{}
+	s := NewKinesisSink(MockKinesisClient{calls: &calls, failFirst: 1}, "audit")
+
+	assert.NoError(t, s.Write(context.Background(), []Event{{ID: "a"}, {ID: "b"}}))
+	assert.Len(t, calls, 2)
+	// Only the failed record is sent again
+	assert.Len(t, calls[1].Records, 1)
+	assert.Equal(t, "a", aws.ToString(calls[1].Records[0].PartitionKey))
+
+	calls = []*kinesis.PutRecordsInput{}
+	s = NewKinesisSink(MockKinesisClient{calls: &calls, failFirst: maxKinesisAttempts}, "audit")
+	assert.Error(t, s.Write(context.Background(), []Event{{ID: "a"}}))
+	assert.Len(t, calls, maxKinesisAttempts)
+
+	calls = []*kinesis.PutRecordsInput{}
+	s = NewKinesisSink(MockKinesisClient{calls: &calls, isError: true}, "audit")
+	assert.Error(t, s.Write(context.Background(), []Event{{ID: "a"}}))
+}
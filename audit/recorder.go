@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+)
+
+// How many events can wait to be written before new ones are dropped
+const DefaultQueueSize = 256
+
+// The most events written in one go
+const maxBatch = 100
+
+// How long a single write to the sink can take
+const writeTimeout = 5 * time.Second
+
+// Either an event to write, or a Flush waiting for everything before it to be written
+type item struct {
+	event *Event
+	done  chan struct{}
+}
+
+/*
+Writes events to a sink in the background, so that recording one never holds up the handler. If the sink falls so far
+behind that the queue fills up, new events are dropped rather than waited on, and the next Flush reports how many with
+a DroppedError.
+A Recorder is meant to live for as long as the Lambda instance, so create it outside the handler function.
+*/
+type Recorder struct {
+	queue chan item
+	sink  Sink
+
+	mu      sync.Mutex
+	dropped int
+	errs    []error
+}
+
+func NewRecorder(sink Sink, size int) *Recorder {
+	r := &Recorder{
+		queue: make(chan item, size),
+		sink:  sink,
+	}
+	go r.run()
+	return r
+}
+
+/*
+Picks a sink from AUDIT_SINK: "stdout" (the default), "kinesis", which writes to the AUDIT_STREAM stream, or "file",
+which appends to AUDIT_FILE. If the chosen sink can't be set up the recorder falls back to stdout, and the error is
+returned so that it can be reported.
+*/
+func RecorderFromEnv(ctx context.Context) (*Recorder, error) {
+	sink, err := sinkFromEnv(ctx)
+	if err != nil {
+		return NewRecorder(NewStdoutSink(), DefaultQueueSize), err
+	}
+	return NewRecorder(sink, DefaultQueueSize), nil
+}
+
+func sinkFromEnv(ctx context.Context) (Sink, error) {
+	switch s := os.Getenv("AUDIT_SINK"); s {
+	case "", "stdout":
+		return NewStdoutSink(), nil
+	case "file":
+		if os.Getenv("AUDIT_FILE") == "" {
+			return nil, fmt.Errorf("AUDIT_FILE is not set")
+		}
+		return NewFileSink(os.Getenv("AUDIT_FILE")), nil
+	case "kinesis":
+		if os.Getenv("AUDIT_STREAM") == "" {
+			return nil, fmt.Errorf("AUDIT_STREAM is not set")
+		}
+		sdkConfig, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return NewKinesisSink(kinesis.NewFromConfig(sdkConfig), os.Getenv("AUDIT_STREAM")), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", s)
+	}
+}
+
+func (r *Recorder) run() {
+	batch := []Event{}
+	for it := range r.queue {
+		if it.event != nil {
+			batch = append(batch, *it.event)
+		}
+		// Carries on filling the batch while more is already waiting
+		if it.done == nil && len(batch) < maxBatch && len(r.queue) > 0 {
+			continue
+		}
+		if len(batch) > 0 {
+			r.write(batch)
+			batch = []Event{}
+		}
+		if it.done != nil {
+			close(it.done)
+		}
+	}
+}
+
+func (r *Recorder) write(batch []Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	if err := r.sink.Write(ctx, batch); err != nil {
+		r.mu.Lock()
+		r.errs = append(r.errs, fmt.Errorf("writing %d audit events: %w", len(batch), err))
+		r.mu.Unlock()
+	}
+}
+
+// Joined into Flush's error when events were dropped because the queue was full
+type DroppedError struct {
+	Count int
+}
+
+func (e DroppedError) Error() string {
+	return fmt.Sprintf("%d audit events dropped", e.Count)
+}
+
+// Queues the event without waiting for it to be written
+func (r *Recorder) Record(e Event) {
+	select {
+	case r.queue <- item{event: &e}:
+	default:
+		r.mu.Lock()
+		r.dropped++
+		r.mu.Unlock()
+	}
+}
+
+/*
+Waits until everything recorded so far has been written, and returns any errors since the last Flush. Lambda can freeze
+the instance as soon as the handler returns, so the Lambdas flush before returning, see start.WithAudit.
+*/
+func (r *Recorder) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case r.queue <- item{done: done}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := r.errs
+	if r.dropped > 0 {
+		errs = append(errs, DroppedError{Count: r.dropped})
+	}
+	r.errs = nil
+	r.dropped = 0
+	return errors.Join(errs...)
+}
+
+/*
+Records an event for every request the handler serves, apart from CORS preflights. The handler can add to the event
+through its context, see SetAction, SetSubject and SetDetail.
+*/
+func (r *Recorder) Wrap(action Action, h utils.APIHandler) utils.APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if request.HTTPMethod == http.MethodOptions {
+			return h(ctx, request)
+		}
+
+		e := FromRequest(action, request)
+		res, err := h(context.WithValue(ctx, eventKey{}, &e), request)
+		e.complete(res, err)
+		r.Record(e)
+
+		return res, err
+	}
+}
@@ -0,0 +1,205 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func testRequest(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       body,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "mockRequestId",
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  "1.2.3.4",
+				UserAgent: "mockUserAgent",
+			},
+		},
+	}
+}
+
+func respond(statusCode int, body string) utils.APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{StatusCode: statusCode, Body: body}, nil
+	}
+}
+
+func TestWrap(t *testing.T) {
+	type test struct {
+		Name            string
+		Handler         utils.APIHandler
+		ExpectedOutcome Outcome
+		ExpectedReason  string
+	}
+
+	tests := []test{
+		{
+			Name:            "Success",
+			Handler:         respond(200, "{\"message\": \"Successfully signed in\"}"),
+			ExpectedOutcome: OutcomeSuccess,
+		},
+		{
+			Name:            "Rejected",
+			Handler:         respond(400, "{\"message\": \"Invalid request\", \"code\": \"VALIDATION_FAILED\"}"),
+			ExpectedOutcome: OutcomeFailure,
+			ExpectedReason:  "VALIDATION_FAILED",
+		},
+		{
+			Name:            "Rate limited",
+			Handler:         respond(429, "{\"message\": \"Too many attempts\", \"code\": \"RATE_LIMITED\"}"),
+			ExpectedOutcome: OutcomeDenied,
+			ExpectedReason:  "RATE_LIMITED",
+		},
+		{
+			Name: "Handler error",
+			Handler: func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				return utils.RESPONSE_500, fmt.Errorf("handler error")
+			},
+			ExpectedOutcome: OutcomeFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			p := filepath.Join(t.TempDir(), "audit.jsonl")
+			r := NewRecorder(NewFileSink(p), DefaultQueueSize)
+
+			_, _ = r.Wrap(ActionSignIn, tt.Handler)(context.Background(), testRequest("{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\"}"))
+			assert.NoError(t, r.Flush(context.Background()))
+
+			events, err := ReadFile(p)
+			assert.NoError(t, err)
+			assert.Len(t, events, 1)
+
+			e := events[0]
+			assert.NotEmpty(t, e.ID)
+			assert.Equal(t, ActionSignIn, e.Action)
+			assert.Equal(t, tt.ExpectedOutcome, e.Outcome)
+			assert.Equal(t, tt.ExpectedReason, e.Reason)
+			assert.Equal(t, logging.HashEmail("abc@gmail.com"), e.Subject)
+			assert.Equal(t, "mockRequestId", e.RequestID)
+			assert.Equal(t, "1.2.3.4", e.SourceIP)
+			assert.Equal(t, "mockUserAgent", e.UserAgent)
+		})
+	}
+}
+
+func TestWrapHandlerAnnotations(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "audit.jsonl")
+	r := NewRecorder(NewFileSink(p), DefaultQueueSize)
+
+	h := func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		SetAction(ctx, ActionRoleAdd)
+		SetSubject(ctx, "def@gmail.com")
+		SetDetail(ctx, "role", "admin")
+		return utils.RESPONSE_200("{}"), nil
+	}
+	_, err := r.Wrap(ActionRoleList, h)(context.Background(), testRequest("{}"))
+	assert.NoError(t, err)
+
+	// Preflights aren't audited
+	req := testRequest("")
+	req.HTTPMethod = "OPTIONS"
+	_, err = r.Wrap(ActionRoleList, h)(context.Background(), req)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Flush(context.Background()))
+	events, err := ReadFile(p)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, ActionRoleAdd, events[0].Action)
+	assert.Equal(t, logging.HashEmail("def@gmail.com"), events[0].Subject)
+	assert.Equal(t, map[string]string{"role": "admin"}, events[0].Detail)
+}
+
+// A sink that holds every write until released
+type blockingSink struct {
+	release chan struct{}
+}
+
+func (s blockingSink) Write(ctx context.Context, events []Event) error {
+	<-s.release
+	return nil
+}
+
+func TestRecordDoesNotBlock(t *testing.T) {
+	s := blockingSink{release: make(chan struct{})}
+	r := NewRecorder(s, 2)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		r.Record(Event{Action: ActionSignIn})
+	}
+	assert.Less(t, time.Since(start), time.Second)
+
+	close(s.release)
+	err := r.Flush(context.Background())
+	assert.ErrorContains(t, err, "audit events dropped")
+	var d DroppedError
+	assert.ErrorAs(t, err, &d)
+	assert.Greater(t, d.Count, 0)
+
+	// Reported once
+	assert.NoError(t, r.Flush(context.Background()))
+}
+
+type errorSink struct{}
+
+func (errorSink) Write(ctx context.Context, events []Event) error {
+	return fmt.Errorf("sink error")
+}
+
+func TestFlushReportsSinkErrors(t *testing.T) {
+	r := NewRecorder(errorSink{}, DefaultQueueSize)
+	r.Record(Event{Action: ActionSignUp})
+	assert.ErrorContains(t, r.Flush(context.Background()), "sink error")
+}
+
+func TestFlushContext(t *testing.T) {
+	s := blockingSink{release: make(chan struct{})}
+	defer close(s.release)
+	r := NewRecorder(s, DefaultQueueSize)
+	r.Record(Event{Action: ActionSignUp})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, r.Flush(ctx), context.DeadlineExceeded)
+}
+
+func TestWriterSink(t *testing.T) {
+	var b bytes.Buffer
+	err := NewWriterSink(&b).Write(context.Background(), []Event{{ID: "1", Action: ActionSignUp}, {ID: "2", Action: ActionVerifyEmail}})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "\"action\":\"verify_email\"")
+}
+
+func TestRecorderFromEnv(t *testing.T) {
+	t.Setenv("AUDIT_SINK", "file")
+	t.Setenv("AUDIT_FILE", "")
+	_, err := RecorderFromEnv(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv("AUDIT_SINK", "somewhere")
+	_, err = RecorderFromEnv(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv("AUDIT_SINK", "")
+	r, err := RecorderFromEnv(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, r)
+}
@@ -0,0 +1,108 @@
+package breach
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	// Passwords seen at least this many times are rejected, 0 turns screening off
+	Threshold int
+	// Lets passwords through when the range lookup fails, rather than failing the request
+	FailOpen bool
+	// Serves ranges from this file instead of the range API, see FileRangeClient
+	RangeFile string
+}
+
+var DefaultConfig = Config{
+	Threshold: 1,
+	FailOpen:  true,
+}
+
+func (c Config) Environment() map[string]string {
+	mode := "closed"
+	if c.FailOpen {
+		mode = "open"
+	}
+	e := map[string]string{
+		"PASSWORD_BREACH_THRESHOLD": strconv.Itoa(c.Threshold),
+		"PASSWORD_BREACH_FAIL_MODE": mode,
+	}
+	if c.RangeFile != "" {
+		e["PASSWORD_BREACH_RANGE_FILE"] = c.RangeFile
+	}
+	return e
+}
+
+// Reads the variables set by Environment, anything missing or invalid keeps its DefaultConfig value
+func ConfigFromEnv() Config {
+	c := DefaultConfig
+	if t, err := strconv.Atoi(os.Getenv("PASSWORD_BREACH_THRESHOLD")); err == nil && t >= 0 {
+		c.Threshold = t
+	}
+	if m := os.Getenv("PASSWORD_BREACH_FAIL_MODE"); m != "" {
+		c.FailOpen = m != "closed"
+	}
+	c.RangeFile = os.Getenv("PASSWORD_BREACH_RANGE_FILE")
+	return c
+}
+
+// Returns the client the config asks for, a FileRangeClient if it has a RangeFile and the range API otherwise
+func (c Config) RangeClient() (RangeClient, error) {
+	if c.RangeFile != "" {
+		return NewFileRangeClient(c.RangeFile)
+	}
+	return NewHTTPRangeClient(nil, ""), nil
+}
+
+type Checker struct {
+	client RangeClient
+	config Config
+	logger *zap.Logger
+}
+
+func NewChecker(logger *zap.Logger, client RangeClient, config Config) Checker {
+	return Checker{
+		client: client,
+		config: config,
+		logger: logger,
+	}
+}
+
+// Returns how many times the password has been seen in breaches
+func (c Checker) Count(ctx context.Context, password string) (int, error) {
+	h := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(h[:]))
+
+	r, err := c.client.Range(ctx, hash[:PrefixLength])
+	if err != nil {
+		return 0, err
+	}
+	return r[hash[PrefixLength:]], nil
+}
+
+/*
+Reports whether the password has been seen in breaches at least Threshold times. If the lookup fails, it's treated as
+not breached when the config fails open, and returned otherwise.
+*/
+func (c Checker) Breached(ctx context.Context, password string) (bool, error) {
+	if c.config.Threshold <= 0 {
+		return false, nil
+	}
+
+	n, err := c.Count(ctx, password)
+	if err != nil && c.config.FailOpen {
+		c.logger.Warn("Password breach check failed, allowing password", zap.Error(err))
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return n >= c.config.Threshold, nil
+}
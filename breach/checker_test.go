@@ -0,0 +1,136 @@
+package breach
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// SHA-1 of "password"
+const passwordHash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+type MockRangeClient struct {
+	isError  bool
+	prefixes *[]string
+}
+
+func (m MockRangeClient) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	if m.prefixes != nil {
+		*m.prefixes = append(*m.prefixes, prefix)
+	}
+	if m.isError {
+		return nil, fmt.Errorf("Range error")
+	}
+	return map[string]int{
+		passwordHash[PrefixLength:]:           10,
+		"0000000000000000000000000000000000A": 3,
+	}, nil
+}
+
+func TestBreached(t *testing.T) {
+	type test struct {
+		Name             string
+		Password         string
+		Config           Config
+		RangeError       bool
+		ExpectedBreached bool
+		ExpectedError    bool
+		ExpectedWarnings int
+	}
+
+	tests := []test{
+		{
+			Name:             "Breached password",
+			Password:         "password",
+			Config:           DefaultConfig,
+			ExpectedBreached: true,
+		},
+		{
+			Name:     "Unseen password",
+			Password: "Abcabc123",
+			Config:   DefaultConfig,
+		},
+		{
+			Name:             "Seen as often as the threshold",
+			Password:         "password",
+			Config:           Config{Threshold: 10},
+			ExpectedBreached: true,
+		},
+		{
+			Name:     "Seen less often than the threshold",
+			Password: "password",
+			Config:   Config{Threshold: 11},
+		},
+		{
+			Name:     "Screening off",
+			Password: "password",
+			Config:   Config{Threshold: 0},
+		},
+		{
+			Name:             "Lookup failure fails open",
+			Password:         "password",
+			Config:           Config{Threshold: 1, FailOpen: true},
+			RangeError:       true,
+			ExpectedWarnings: 1,
+		},
+		{
+			Name:          "Lookup failure fails closed",
+			Password:      "password",
+			Config:        Config{Threshold: 1},
+			RangeError:    true,
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			core, logs := observer.New(zap.WarnLevel)
+			c := NewChecker(zap.New(core), MockRangeClient{isError: tt.RangeError}, tt.Config)
+
+			b, err := c.Breached(context.Background(), tt.Password)
+			assert.Equal(t, tt.ExpectedError, err != nil)
+			assert.Equal(t, tt.ExpectedBreached, b)
+			assert.Equal(t, tt.ExpectedWarnings, logs.Len())
+		})
+	}
+}
+
+func TestOnlyPrefixSent(t *testing.T) {
+	prefixes := []string{}
+	c := NewChecker(zap.NewNop(), MockRangeClient{prefixes: &prefixes}, DefaultConfig)
+
+	_, err := c.Count(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{passwordHash[:PrefixLength]}, prefixes)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_BREACH_THRESHOLD", "")
+	t.Setenv("PASSWORD_BREACH_FAIL_MODE", "")
+	t.Setenv("PASSWORD_BREACH_RANGE_FILE", "")
+	assert.Equal(t, DefaultConfig, ConfigFromEnv())
+
+	c := Config{Threshold: 5, RangeFile: "/opt/hashes.txt"}
+	for k, v := range c.Environment() {
+		t.Setenv(k, v)
+	}
+	assert.Equal(t, c, ConfigFromEnv())
+
+	t.Setenv("PASSWORD_BREACH_THRESHOLD", "lots")
+	assert.Equal(t, DefaultConfig.Threshold, ConfigFromEnv().Threshold)
+}
+
+func TestFileRangeClientChecker(t *testing.T) {
+	fc, err := ReadRangeClient(strings.NewReader(strings.ToLower(passwordHash) + ":3861493\n"))
+	assert.NoError(t, err)
+
+	c := NewChecker(zap.NewNop(), fc, DefaultConfig)
+	n, err := c.Count(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.Equal(t, 3861493, n)
+}
@@ -0,0 +1,144 @@
+package breach
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Looks up breached password hashes by the first PrefixLength characters of their upper case hex SHA-1, returning the
+remaining characters of every matching hash with the number of times it has been seen. Only the prefix ever leaves
+the caller, so the service can't tell which of the hundreds of hashes in a range was being checked.
+*/
+type RangeClient interface {
+	Range(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+const PrefixLength = 5
+
+const DefaultRangeURL = "https://api.pwnedpasswords.com/range/"
+
+// Sign up shouldn't wait on the range API for long, the Checker fails open by default
+const defaultTimeout = 2 * time.Second
+
+// Calls a range API over HTTP, such as Have I Been Pwned's
+type HTTPRangeClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// A nil client gets one with a short timeout, and an empty baseURL means DefaultRangeURL
+func NewHTTPRangeClient(c *http.Client, baseURL string) HTTPRangeClient {
+	if c == nil {
+		c = &http.Client{Timeout: defaultTimeout}
+	}
+	if baseURL == "" {
+		baseURL = DefaultRangeURL
+	}
+	return HTTPRangeClient{
+		client:  c,
+		baseURL: baseURL,
+	}
+}
+
+func (hc HTTPRangeClient) Range(ctx context.Context, prefix string) (map[string]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.baseURL+prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Pads responses with zero count entries, so their size doesn't give the prefix away either
+	req.Header.Set("Add-Padding", "true")
+
+	res, err := hc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("range request failed with status %d", res.StatusCode)
+	}
+
+	r := map[string]int{}
+	err = readHashes(res.Body, func(suffix string, count int) {
+		if count > 0 {
+			r[suffix] = count
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+/*
+Serves ranges from a local file of full hashes, one "HASH:COUNT" per line, the format of the downloadable Have I Been
+Pwned corpus. Used in tests and anywhere the range API can't be reached. The whole file is held in memory, so larger
+corpora should be trimmed to the more common hashes first.
+*/
+type FileRangeClient struct {
+	ranges map[string]map[string]int
+}
+
+func NewFileRangeClient(path string) (FileRangeClient, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileRangeClient{}, err
+	}
+	defer f.Close()
+	return ReadRangeClient(f)
+}
+
+func ReadRangeClient(r io.Reader) (FileRangeClient, error) {
+	ranges := map[string]map[string]int{}
+	err := readHashes(r, func(hash string, count int) {
+		if len(hash) <= PrefixLength {
+			return
+		}
+		p := hash[:PrefixLength]
+		if ranges[p] == nil {
+			ranges[p] = map[string]int{}
+		}
+		ranges[p][hash[PrefixLength:]] += count
+	})
+	if err != nil {
+		return FileRangeClient{}, err
+	}
+	return FileRangeClient{ranges: ranges}, nil
+}
+
+func (fc FileRangeClient) Range(_ context.Context, prefix string) (map[string]int, error) {
+	r := map[string]int{}
+	for s, c := range fc.ranges[strings.ToUpper(prefix)] {
+		r[s] = c
+	}
+	return r, nil
+}
+
+// Reads "HASH:COUNT" lines, skipping blank ones. Hashes are upper cased to match the API and the corpus
+func readHashes(r io.Reader, f func(hash string, count int)) error {
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		hash, count, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("malformed hash line %q", line)
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return fmt.Errorf("malformed hash count %q", count)
+		}
+		f(strings.ToUpper(hash), n)
+	}
+	return s.Err()
+}
@@ -0,0 +1,68 @@
+package breach
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRangeClient(t *testing.T) {
+	var path, padding string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		padding = r.Header.Get("Add-Padding")
+		if strings.HasSuffix(r.URL.Path, "FFFFF") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("1E4C9B93F3F0682250B6CF8331B7EE68FD8:3861493\r\n011053FD0102E94D6AE2F8B83D76FAF94F6:1\r\n00000000000000000000000000000000000:0\r\n"))
+	}))
+	defer s.Close()
+
+	c := NewHTTPRangeClient(s.Client(), s.URL+"/range/")
+
+	r, err := c.Range(context.Background(), "5BAA6")
+	assert.NoError(t, err)
+	assert.Equal(t, "/range/5BAA6", path)
+	assert.Equal(t, "true", padding)
+	// Padding entries are dropped
+	assert.Equal(t, map[string]int{
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 3861493,
+		"011053FD0102E94D6AE2F8B83D76FAF94F6": 1,
+	}, r)
+
+	_, err = c.Range(context.Background(), "FFFFF")
+	assert.Error(t, err)
+}
+
+func TestFileRangeClient(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "hashes.txt")
+	err := os.WriteFile(p, []byte(passwordHash+":3861493\n\n5BAA6000000000000000000000000000000000AA:2\n7C4A8D09CA3762AF61E59520943DC26494F8941B:42\n"), 0o600)
+	assert.NoError(t, err)
+
+	c, err := NewFileRangeClient(p)
+	assert.NoError(t, err)
+
+	r, err := c.Range(context.Background(), "5baa6")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 3861493,
+		"000000000000000000000000000000000AA": 2,
+	}, r)
+
+	r, err = c.Range(context.Background(), "FFFFF")
+	assert.NoError(t, err)
+	assert.Empty(t, r)
+
+	_, err = ReadRangeClient(strings.NewReader("not a hash line\n"))
+	assert.Error(t, err)
+
+	_, err = NewFileRangeClient(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
@@ -1,27 +1,49 @@
 package main
 
 import (
-	"os"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-cdk-go/awscdk/v2"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awscertificatemanager"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsdynamodb"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awseventstargets"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsiam"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsroute53"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsroute53targets"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awss3"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awssecretsmanager"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssqs"
 	"github.com/aws/aws-cdk-go/awscdk/v2/awsssm"
 	awslambdago "github.com/aws/aws-cdk-go/awscdklambdagoalpha/v2"
 	"github.com/aws/constructs-go/constructs/v10"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/breach"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/reconcile"
+	"github.com/benjaminkitson/bk-auth-api/tracing"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
 )
 
 type CdkWorkshopStackProps struct {
 	awscdk.StackProps
+	Config StageConfig
+	// Defaults to GoFunction, which builds the lambdas
+	NewFunction FunctionFactory
 }
 
+// Creates a lambda from its entry, the directory of its main package
+type FunctionFactory func(scope constructs.Construct, id string, entry string) awslambda.Function
+
 func defaultAuthLambdaProps(path string) *awslambdago.GoFunctionProps {
 	return &awslambdago.GoFunctionProps{
 		Architecture: awslambda.Architecture_ARM_64(),
@@ -37,15 +59,48 @@ func defaultAuthLambdaProps(path string) *awslambdago.GoFunctionProps {
 	}
 }
 
+func goFunction(scope constructs.Construct, id string, entry string) awslambda.Function {
+	return awslambdago.NewGoFunction(scope, jsii.String(id), defaultAuthLambdaProps(entry))
+}
+
+/*
+Browsers don't send credentials with preflight requests, so OPTIONS can't sit behind the authorizer like the
+resource's other methods
+*/
+func addAdminMethods(r awsapigateway.Resource, fn awslambda.IFunction, options *awsapigateway.MethodOptions, methods ...string) {
+	i := awsapigateway.NewLambdaIntegration(fn, &awsapigateway.LambdaIntegrationOptions{})
+	for _, m := range methods {
+		r.AddMethod(jsii.String(m), i, options)
+	}
+	r.AddMethod(jsii.String("OPTIONS"), i, &awsapigateway.MethodOptions{})
+}
+
+// The user API is in its own stack, every stage and method of it can be called
+func grantInvokeUserAPI(api awsapigateway.IRestApi, fns ...awslambda.IFunction) {
+	for _, fn := range fns {
+		fn.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+			Effect:    awsiam.Effect_ALLOW,
+			Actions:   jsii.Strings("execute-api:Invoke"),
+			Resources: &[]*string{api.ArnForExecuteApi(jsii.String("*"), jsii.String("/*"), jsii.String("*"))},
+		}))
+	}
+}
+
 func NewCdkWorkshopStack(scope constructs.Construct, id string, props *CdkWorkshopStackProps) awscdk.Stack {
 	var sprops awscdk.StackProps
+	var cfg StageConfig
+	newFunction := FunctionFactory(goFunction)
 	if props != nil {
 		sprops = props.StackProps
+		cfg = props.Config
+		if props.NewFunction != nil {
+			newFunction = props.NewFunction
+		}
 	}
 	stack := awscdk.NewStack(scope, &id, &sprops)
 
 	pool := awscognito.NewUserPool(stack, jsii.String("testPool"), &awscognito.UserPoolProps{
-		UserPoolName:      jsii.String("Test User Pool"),
+		UserPoolName:      jsii.String(cfg.Name("Test User Pool")),
 		SelfSignUpEnabled: jsii.Bool(true),
 		SignInAliases: &awscognito.SignInAliases{
 			Email: jsii.Bool(true),
@@ -53,47 +108,100 @@ func NewCdkWorkshopStack(scope constructs.Construct, id string, props *CdkWorksh
 		AutoVerify: &awscognito.AutoVerifiedAttrs{
 			Email: jsii.Bool(true),
 		},
+		// Shared with the request validation in the handlers
 		PasswordPolicy: &awscognito.PasswordPolicy{
-			MinLength:        jsii.Number(8),
-			RequireLowercase: jsii.Bool(true),
-			RequireUppercase: jsii.Bool(true),
-			RequireDigits:    jsii.Bool(true),
-			RequireSymbols:   jsii.Bool(false),
+			MinLength:        jsii.Number(validation.DefaultPasswordPolicy.MinLength),
+			RequireLowercase: jsii.Bool(validation.DefaultPasswordPolicy.RequireLowercase),
+			RequireUppercase: jsii.Bool(validation.DefaultPasswordPolicy.RequireUppercase),
+			RequireDigits:    jsii.Bool(validation.DefaultPasswordPolicy.RequireDigits),
+			RequireSymbols:   jsii.Bool(validation.DefaultPasswordPolicy.RequireSymbols),
+		},
+		// Client writable attributes are limited in the app client below, and validated in cognitoadapter/attributes.go
+		CustomAttributes: &map[string]awscognito.ICustomAttribute{
+			"marketing_consent": awscognito.NewStringAttribute(&awscognito.StringAttributeProps{
+				MinLen:  jsii.Number(4),
+				MaxLen:  jsii.Number(5),
+				Mutable: jsii.Bool(true),
+			}),
+			// Set once at sign up
+			"tenant": awscognito.NewStringAttribute(&awscognito.StringAttributeProps{
+				MinLen:  jsii.Number(1),
+				MaxLen:  jsii.Number(64),
+				Mutable: jsii.Bool(false),
+			}),
+			// The user's bk-user-api record, set when it's created. Not writable by the app client, see cognitoadapter
+			"user_id": awscognito.NewStringAttribute(&awscognito.StringAttributeProps{
+				Mutable: jsii.Bool(true),
+			}),
+		},
+		// Keeps the current email as the sign in alias until a changed address has been verified
+		KeepOriginal: &awscognito.KeepOriginalAttrs{
+			Email: jsii.Bool(true),
 		},
 		AccountRecovery: awscognito.AccountRecovery_EMAIL_ONLY,
-		RemovalPolicy:   awscdk.RemovalPolicy_DESTROY,
+		RemovalPolicy:   cfg.RemovalPolicy(),
+		// Message content comes from the custom message trigger below
 		UserVerification: &awscognito.UserVerificationConfig{
-			EmailSubject: jsii.String("You need to verify your email"),
-			EmailBody:    jsii.String("Thanks for signing up! Your verification code is {####}"),
-			EmailStyle:   awscognito.VerificationEmailStyle_CODE,
+			EmailStyle: awscognito.VerificationEmailStyle_CODE,
 		},
 	})
 
-	pool.AddClient(jsii.String("test-client"), &awscognito.UserPoolClientOptions{
+	// Email domain policy for self sign up. Lists are comma separated, see lambda/presignup
+	preSignUpLambda := newFunction(stack, "preSignUpHandler", "../lambda/presignup")
+	preSignUpLambda.AddEnvironment(jsii.String("ALLOWED_EMAIL_DOMAINS"), jsii.String(strings.Join(cfg.AllowedEmailDomains, ",")), &awslambda.EnvironmentOptions{})
+	preSignUpLambda.AddEnvironment(jsii.String("DENIED_EMAIL_DOMAINS"), jsii.String(strings.Join(cfg.DeniedEmailDomains, ",")), &awslambda.EnvironmentOptions{})
+	preSignUpLambda.AddEnvironment(jsii.String("TRUSTED_EMAIL_DOMAINS"), jsii.String(strings.Join(cfg.TrustedEmailDomains, ",")), &awslambda.EnvironmentOptions{})
+	pool.AddTrigger(awscognito.UserPoolOperation_PRE_SIGN_UP(), preSignUpLambda, awscognito.LambdaVersion_V1_0)
+
+	// Localised email templates, see lambda/custommessage/handler/templates
+	customMessageLambda := newFunction(stack, "customMessageHandler", "../lambda/custommessage")
+	pool.AddTrigger(awscognito.UserPoolOperation_CUSTOM_MESSAGE(), customMessageLambda, awscognito.LambdaVersion_V1_0)
+
+	// Roles, see utils/auth
+	for i, r := range auth.Roles {
+		awscognito.NewCfnUserPoolGroup(stack, jsii.String(r+"Group"), &awscognito.CfnUserPoolGroupProps{
+			UserPoolId: pool.UserPoolId(),
+			GroupName:  jsii.String(r),
+			// Lower precedence wins when a user is in several groups
+			Precedence: jsii.Number(i),
+		})
+	}
+
+	poolClient := pool.AddClient(jsii.String("test-client"), &awscognito.UserPoolClientOptions{
 		UserPoolClientName: jsii.String("test-pool-client"),
 		AuthFlows: &awscognito.AuthFlow{
 			UserPassword: jsii.Bool(true),
 		},
+		// Anything not listed here (e.g. email_verified) can only be written with admin credentials
+		WriteAttributes: awscognito.NewClientAttributes().
+			WithStandardAttributes(&awscognito.StandardAttributesMask{
+				Email:    jsii.Bool(true),
+				Fullname: jsii.Bool(true),
+				Locale:   jsii.Bool(true),
+			}).
+			WithCustomAttributes(jsii.String("marketing_consent"), jsii.String("tenant")),
 	})
 
+	cognitoClientSecretName := cfg.Name("COGNITO_CLIENT")
 	c := awssecretsmanager.NewSecret(stack, jsii.String("cognitoClientId"), &awssecretsmanager.SecretProps{
 		//TODO: change this back to "COGNITO_CLIENT" once scheduled deletion has occured
-		SecretName: jsii.String("COGNITO_CLIENT"),
+		SecretName: jsii.String(cognitoClientSecretName),
 	})
 
 	// Fallback lambda
-	fallbackLambda := awslambdago.NewGoFunction(stack, jsii.String("fallbackHandler"), defaultAuthLambdaProps("../lambda/fallback"))
+	fallbackLambda := newFunction(stack, "fallbackHandler", "../lambda/fallback")
 
 	// Sign in
-	signInLambda := awslambdago.NewGoFunction(stack, jsii.String("signInHandler"), defaultAuthLambdaProps("../lambda/signin"))
+	signInLambda := newFunction(stack, "signInHandler", "../lambda/signin")
 	c.GrantRead(signInLambda, nil)
 
 	// Sign up
-	signUpLambda := awslambdago.NewGoFunction(stack, jsii.String("signUpHandler"), defaultAuthLambdaProps("../lambda/signup"))
+	signUpLambda := newFunction(stack, "signUpHandler", "../lambda/signup")
 	c.GrantRead(signUpLambda, nil)
 
 	// Verify Email
-	userAPIParamName := jsii.String("/http-endpoints/user-api")
+	userAPIParamName := jsii.String(cfg.UserAPIParameterName)
+	userAPI := awsapigateway.RestApi_FromRestApiId(stack, jsii.String("userAPI"), jsii.String(cfg.UserAPIID))
 
 	p := awsssm.NewStringParameter(stack, jsii.String("userAPIEndpoint"), &awsssm.StringParameterProps{
 		ParameterName: userAPIParamName,
@@ -101,75 +209,353 @@ func NewCdkWorkshopStack(scope constructs.Construct, id string, props *CdkWorksh
 		StringValue: jsii.String("/"),
 	})
 
-	verifyEmailLambda := awslambdago.NewGoFunction(stack, jsii.String("verifyEmailHandler"), defaultAuthLambdaProps("../lambda/verify"))
-	verifyEmailLambda.AddEnvironment(jsii.String("USER_API_PARAMETER_NAME"), userAPIParamName, &awslambda.EnvironmentOptions{})
-	verifyEmailLambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-		Effect:  awsiam.Effect_ALLOW,
-		Actions: jsii.Strings("execute-api:Invoke"),
-		Resources: jsii.Strings(
-			"arn:aws:execute-api:eu-west-2:905418429454:6blz968hz8/*/*/*",
-		),
-	}))
+	verifyEmailLambda := newFunction(stack, "verifyEmailHandler", "../lambda/verify")
+	verifyEmailLambda.AddEnvironment(jsii.String("USER_API_URL"), jsii.String(appconfig.SSMPrefix+*userAPIParamName), &awslambda.EnvironmentOptions{})
+	grantInvokeUserAPI(userAPI, verifyEmailLambda)
+	// The ID of each user's record is kept on the Cognito user, see outbox.UserDeliverer
+	pool.Grant(verifyEmailLambda, jsii.String("cognito-idp:AdminGetUser"), jsii.String("cognito-idp:AdminUpdateUserAttributes"))
 	c.GrantRead(verifyEmailLambda, nil)
 	p.GrantRead(verifyEmailLambda)
 
 	// Admin Delete User
-	adminDeleteLambda := awslambdago.NewGoFunction(stack, jsii.String("adminDeleteHandler"), defaultAuthLambdaProps("../lambda/admindelete"))
-	adminDeleteLambda.AddEnvironment(jsii.String("USER_API_PARAMETER_NAME"), userAPIParamName, &awslambda.EnvironmentOptions{})
-	adminDeleteLambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-		Effect:  awsiam.Effect_ALLOW,
-		Actions: jsii.Strings("execute-api:Invoke"),
-		Resources: jsii.Strings(
-			"arn:aws:execute-api:eu-west-2:905418429454:6blz968hz8/*/*/*",
-		),
-	}))
-	adminDeleteLambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
-		Effect:  awsiam.Effect_ALLOW,
-		Actions: jsii.Strings("cognito-idp:AdminDeleteUser"),
-		Resources: jsii.Strings(
-			"arn:aws:cognito-idp:eu-west-2:905418429454:userpool/eu-west-2_PsrvIdHug",
-		),
-	}))
+	adminDeleteLambda := newFunction(stack, "adminDeleteHandler", "../lambda/admindelete")
+	adminDeleteLambda.AddEnvironment(jsii.String("USER_API_URL"), jsii.String(appconfig.SSMPrefix+*userAPIParamName), &awslambda.EnvironmentOptions{})
+	grantInvokeUserAPI(userAPI, adminDeleteLambda)
+	pool.Grant(adminDeleteLambda, jsii.String("cognito-idp:AdminDeleteUser"))
 	c.GrantRead(adminDeleteLambda, nil)
 	p.GrantRead(adminDeleteLambda)
 
-	authApi := awsapigateway.NewLambdaRestApi(stack, jsii.String("Endpoint"), &awsapigateway.LambdaRestApiProps{
-		DomainName: &awsapigateway.DomainNameOptions{
-			// TODO: This needs putting somewhere else, defeats the purpose of SSM above
-			DomainName: jsii.String("auth.benjaminkitson.com"),
-			Certificate: awscertificatemanager.Certificate_FromCertificateArn(
-				stack,
-				jsii.String("benjaminkitson-certificate"),
-				jsii.String("arn:aws:acm:eu-west-2:905418429454:certificate/42197bf4-d86d-404a-87a6-748c4858d916"),
-			),
+	// App claims in ID tokens
+	preTokenGenLambda := newFunction(stack, "preTokenGenHandler", "../lambda/pretokengen")
+	// Sign in keeps working while a new user's record is still in the outbox, downstream services just won't get an ID
+	preTokenGenLambda.AddEnvironment(jsii.String("USER_ID_FAIL_MODE"), jsii.String("open"), &awslambda.EnvironmentOptions{})
+	// The user ID is issued as bk:user_id instead
+	preTokenGenLambda.AddEnvironment(jsii.String("SUPPRESSED_CLAIMS"), jsii.String("custom:marketing_consent,custom:user_id"), &awslambda.EnvironmentOptions{})
+	pool.AddTrigger(awscognito.UserPoolOperation_PRE_TOKEN_GENERATION(), preTokenGenLambda, awscognito.LambdaVersion_V1_0)
+
+	// Admin Invite User
+	inviteLambda := newFunction(stack, "inviteHandler", "../lambda/invite")
+	inviteLambda.AddEnvironment(jsii.String("USER_API_URL"), jsii.String(appconfig.SSMPrefix+*userAPIParamName), &awslambda.EnvironmentOptions{})
+	inviteLambda.AddEnvironment(jsii.String("INVITE_FROM_ADDRESS"), jsii.String(cfg.InviteFromAddress), &awslambda.EnvironmentOptions{})
+	grantInvokeUserAPI(userAPI, inviteLambda)
+	inviteLambda.AddToRolePolicy(awsiam.NewPolicyStatement(&awsiam.PolicyStatementProps{
+		Effect:  awsiam.Effect_ALLOW,
+		Actions: jsii.Strings("ses:SendEmail"),
+		Resources: &[]*string{stack.FormatArn(&awscdk.ArnComponents{
+			Service:      jsii.String("ses"),
+			Resource:     jsii.String("identity"),
+			ResourceName: jsii.String(cfg.InviteFromDomain()),
+		})},
+	}))
+	pool.Grant(inviteLambda, jsii.String("cognito-idp:AdminCreateUser"), jsii.String("cognito-idp:AdminUpdateUserAttributes"))
+	c.GrantRead(inviteLambda, nil)
+	p.GrantRead(inviteLambda)
+
+	// Profile attributes
+	attributesLambda := newFunction(stack, "attributesHandler", "../lambda/attributes")
+	c.GrantRead(attributesLambda, nil)
+
+	// Email change
+	changeEmailLambda := newFunction(stack, "changeEmailHandler", "../lambda/changeemail")
+	c.GrantRead(changeEmailLambda, nil)
+
+	// Publishes the change through the outbox for bk-user-api to pick up
+	confirmEmailLambda := newFunction(stack, "confirmEmailHandler", "../lambda/confirmemail")
+	c.GrantRead(confirmEmailLambda, nil)
+
+	// Role management
+	rolesLambda := newFunction(stack, "rolesHandler", "../lambda/roles")
+	pool.Grant(
+		rolesLambda,
+		jsii.String("cognito-idp:AdminAddUserToGroup"),
+		jsii.String("cognito-idp:AdminRemoveUserFromGroup"),
+		jsii.String("cognito-idp:AdminListGroupsForUser"),
+	)
+	c.GrantRead(rolesLambda, nil)
+
+	// Complete sign in for invited users
+	newPasswordLambda := newFunction(stack, "newPasswordHandler", "../lambda/newpassword")
+	c.GrantRead(newPasswordLambda, nil)
+
+	// Refresh tokens
+	refreshLambda := newFunction(stack, "refreshHandler", "../lambda/refresh")
+	c.GrantRead(refreshLambda, nil)
+
+	// Password reset and change
+	forgotPasswordLambda := newFunction(stack, "forgotPasswordHandler", "../lambda/forgotpassword")
+	c.GrantRead(forgotPasswordLambda, nil)
+
+	resetPasswordLambda := newFunction(stack, "resetPasswordHandler", "../lambda/resetpassword")
+	c.GrantRead(resetPasswordLambda, nil)
+
+	changePasswordLambda := newFunction(stack, "changePasswordHandler", "../lambda/changepassword")
+	c.GrantRead(changePasswordLambda, nil)
+
+	// Rate limits, shared by every instance of the Lambdas that take a code or password
+	rateLimitTable := awsdynamodb.NewTable(stack, jsii.String("rateLimits"), &awsdynamodb.TableProps{
+		PartitionKey:        &awsdynamodb.Attribute{Name: jsii.String("pk"), Type: awsdynamodb.AttributeType_STRING},
+		BillingMode:         awsdynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("expiresAt"),
+		RemovalPolicy:       cfg.RemovalPolicy(),
+	})
+	for _, fn := range []awslambda.Function{signInLambda, verifyEmailLambda, forgotPasswordLambda, resetPasswordLambda, changePasswordLambda} {
+		rateLimitTable.GrantReadWriteData(fn)
+		fn.AddEnvironment(jsii.String("RATE_LIMIT_TABLE"), rateLimitTable.TableName(), &awslambda.EnvironmentOptions{})
+	}
+
+	// The pool and app client, resolved by appconfig when the lambdas start
+	cognitoLambdas := []awslambda.Function{
+		signInLambda, signUpLambda, verifyEmailLambda, adminDeleteLambda, inviteLambda, rolesLambda,
+		newPasswordLambda, refreshLambda, attributesLambda, changeEmailLambda, confirmEmailLambda,
+		forgotPasswordLambda, resetPasswordLambda, changePasswordLambda,
+	}
+	for _, fn := range cognitoLambdas {
+		fn.AddEnvironment(jsii.String("COGNITO_USER_POOL_ID"), pool.UserPoolId(), &awslambda.EnvironmentOptions{})
+		fn.AddEnvironment(jsii.String("COGNITO_CLIENT_ID"), jsii.String(appconfig.SecretPrefix+cognitoClientSecretName), &awslambda.EnvironmentOptions{})
+	}
+
+	// New passwords are screened against known breaches, failing open if the range API can't be reached
+	breachEnv := breach.DefaultConfig.Environment()
+	breachEnvKeys := make([]string, 0, len(breachEnv))
+	for k := range breachEnv {
+		breachEnvKeys = append(breachEnvKeys, k)
+	}
+	sort.Strings(breachEnvKeys)
+	for _, fn := range []awslambda.Function{signUpLambda, resetPasswordLambda, changePasswordLambda, newPasswordLambda} {
+		for _, k := range breachEnvKeys {
+			fn.AddEnvironment(jsii.String(k), jsii.String(breachEnv[k]), &awslambda.EnvironmentOptions{})
+		}
+	}
+
+	// User lifecycle events, published as CloudEvents for other services to subscribe to with rules on the bus
+	userEvents := awsevents.NewEventBus(stack, jsii.String("userEvents"), &awsevents.EventBusProps{
+		EventBusName: jsii.String(cfg.Name("bk-auth-user-events")),
+	})
+
+	// Side-effects are written to the outbox before they're attempted, and the relay retries any that fail
+	outboxTable := awsdynamodb.NewTable(stack, jsii.String("outbox"), &awsdynamodb.TableProps{
+		PartitionKey:        &awsdynamodb.Attribute{Name: jsii.String("id"), Type: awsdynamodb.AttributeType_STRING},
+		BillingMode:         awsdynamodb.BillingMode_PAY_PER_REQUEST,
+		TimeToLiveAttribute: jsii.String("expiresAt"),
+		RemovalPolicy:       cfg.RemovalPolicy(),
+	})
+	outboxTable.AddGlobalSecondaryIndex(&awsdynamodb.GlobalSecondaryIndexProps{
+		IndexName:    jsii.String(outbox.StatusIndex),
+		PartitionKey: &awsdynamodb.Attribute{Name: jsii.String("status"), Type: awsdynamodb.AttributeType_STRING},
+		SortKey:      &awsdynamodb.Attribute{Name: jsii.String("nextAttempt"), Type: awsdynamodb.AttributeType_NUMBER},
+	})
+	outboxDLQ := awssqs.NewQueue(stack, jsii.String("outboxDeadLetters"), &awssqs.QueueProps{
+		RetentionPeriod: awscdk.Duration_Days(jsii.Number(14)),
+	})
+
+	outboxRelayLambda := newFunction(stack, "outboxRelayHandler", "../lambda/outboxrelay")
+	outboxRelayLambda.AddEnvironment(jsii.String("USER_API_URL"), jsii.String(appconfig.SSMPrefix+*userAPIParamName), &awslambda.EnvironmentOptions{})
+	outboxRelayLambda.AddEnvironment(jsii.String("COGNITO_USER_POOL_ID"), pool.UserPoolId(), &awslambda.EnvironmentOptions{})
+	grantInvokeUserAPI(userAPI, outboxRelayLambda)
+	pool.Grant(outboxRelayLambda, jsii.String("cognito-idp:AdminGetUser"), jsii.String("cognito-idp:AdminUpdateUserAttributes"))
+	p.GrantRead(outboxRelayLambda)
+	awsevents.NewRule(stack, jsii.String("outboxRelaySchedule"), &awsevents.RuleProps{
+		Schedule: awsevents.Schedule_Rate(awscdk.Duration_Minutes(jsii.Number(1))),
+		Targets:  &[]awsevents.IRuleTarget{awseventstargets.NewLambdaFunction(outboxRelayLambda, nil)},
+	})
+
+	for _, fn := range []awslambda.Function{signUpLambda, verifyEmailLambda, adminDeleteLambda, confirmEmailLambda, resetPasswordLambda, changePasswordLambda, outboxRelayLambda} {
+		userEvents.GrantPutEventsTo(fn)
+		fn.AddEnvironment(jsii.String("EVENT_BUS_NAME"), userEvents.EventBusName(), &awslambda.EnvironmentOptions{})
+		outboxTable.GrantReadWriteData(fn)
+		fn.AddEnvironment(jsii.String("OUTBOX_TABLE"), outboxTable.TableName(), &awslambda.EnvironmentOptions{})
+		outboxDLQ.GrantSendMessages(fn)
+		fn.AddEnvironment(jsii.String("OUTBOX_DLQ_URL"), outboxDLQ.QueueUrl(), &awslambda.EnvironmentOptions{})
+	}
+
+	// Reports where Cognito and bk-user-api disagree once a day, repairs are run by invoking it with {"mode": "repair"}
+	reconcileLambda := newFunction(stack, "reconcileHandler", "../lambda/reconcile")
+	reconcileLambda.AddEnvironment(jsii.String("COGNITO_USER_POOL_ID"), pool.UserPoolId(), &awslambda.EnvironmentOptions{})
+	reconcileLambda.AddEnvironment(jsii.String("OUTBOX_TABLE"), outboxTable.TableName(), &awslambda.EnvironmentOptions{})
+	pool.Grant(reconcileLambda, jsii.String("cognito-idp:ListUsers"))
+	// Repairs are queued for the relay to deliver
+	outboxTable.GrantReadWriteData(reconcileLambda)
+	awsevents.NewRule(stack, jsii.String("reconcileSchedule"), &awsevents.RuleProps{
+		Schedule: awsevents.Schedule_Rate(awscdk.Duration_Days(jsii.Number(1))),
+		Targets: &[]awsevents.IRuleTarget{awseventstargets.NewLambdaFunction(reconcileLambda, &awseventstargets.LambdaFunctionProps{
+			Event: awsevents.RuleTargetInput_FromObject(map[string]string{"mode": reconcile.ModeDryRun}),
+		})},
+	})
+
+	// The reports have users' emails in, so they're private and only kept for as long as they're useful
+	reportBucket := awss3.NewBucket(stack, jsii.String("reconciliationReports"), &awss3.BucketProps{
+		BlockPublicAccess: awss3.BlockPublicAccess_BLOCK_ALL(),
+		Encryption:        awss3.BucketEncryption_S3_MANAGED,
+		EnforceSSL:        jsii.Bool(true),
+		LifecycleRules: &[]*awss3.LifecycleRule{
+			{Expiration: awscdk.Duration_Days(jsii.Number(90))},
 		},
-		DisableExecuteApiEndpoint: jsii.Bool(true),
-		RestApiName:               jsii.String("bk-auth"),
-		Handler:                   fallbackLambda,
 	})
+	reportBucket.GrantPut(reconcileLambda, nil)
+	reconcileLambda.AddEnvironment(jsii.String("REPORT_BUCKET"), reportBucket.BucketName(), &awslambda.EnvironmentOptions{})
+
+	// Without a custom domain, the API is only reachable at the endpoint API Gateway gives it
+	apiProps := &awsapigateway.LambdaRestApiProps{
+		RestApiName: jsii.String(cfg.Name("bk-auth")),
+		Handler:     fallbackLambda,
+	}
+	var zone awsroute53.IHostedZone
+	if cfg.Domain != nil {
+		zone = awsroute53.HostedZone_FromLookup(stack, jsii.String("zone"), &awsroute53.HostedZoneProviderProps{
+			DomainName: jsii.String(cfg.Domain.HostedZone),
+		})
+		var cert awscertificatemanager.ICertificate
+		if cfg.Domain.CertificateARN != "" {
+			cert = awscertificatemanager.Certificate_FromCertificateArn(stack, jsii.String("benjaminkitson-certificate"), jsii.String(cfg.Domain.CertificateARN))
+		} else {
+			cert = awscertificatemanager.NewCertificate(stack, jsii.String("certificate"), &awscertificatemanager.CertificateProps{
+				DomainName: jsii.String(cfg.Domain.Name),
+				Validation: awscertificatemanager.CertificateValidation_FromDns(zone),
+			})
+		}
+		apiProps.DomainName = &awsapigateway.DomainNameOptions{
+			DomainName:  jsii.String(cfg.Domain.Name),
+			Certificate: cert,
+		}
+		apiProps.DisableExecuteApiEndpoint = jsii.Bool(true)
+	}
+	authApi := awsapigateway.NewLambdaRestApi(stack, jsii.String("Endpoint"), apiProps)
+
+	// Browser origins allowed to call the API, set per stage or with the corsAllowedOrigins context value
+	cors := utils.CORSConfig{
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowCredentials: true,
+		AllowedHeaders:   utils.DefaultAllowedHeaders,
+		ExposedHeaders:   []string{"Retry-After"},
+		MaxAge:           3600,
+	}
+
+	// Cookie mode is off unless the stage or the sessionCookies context value turns it on, see utils/lambda/session.go
+	session := utils.SessionConfig{
+		Cookies:  cfg.SessionCookies,
+		Domain:   cfg.CookieDomain,
+		SameSite: http.SameSiteStrictMode,
+	}
+
+	apiEnv := cors.Environment()
+	for k, v := range session.Environment() {
+		apiEnv[k] = v
+	}
+	apiEnvKeys := make([]string, 0, len(apiEnv))
+	for k := range apiEnv {
+		apiEnvKeys = append(apiEnvKeys, k)
+	}
+	sort.Strings(apiEnvKeys)
+	apiLambdas := []awslambda.Function{
+		fallbackLambda, signInLambda, signUpLambda, verifyEmailLambda, adminDeleteLambda, inviteLambda, rolesLambda,
+		newPasswordLambda, refreshLambda, attributesLambda, changeEmailLambda, confirmEmailLambda,
+		forgotPasswordLambda, resetPasswordLambda, changePasswordLambda,
+	}
+	for _, fn := range apiLambdas {
+		for _, k := range apiEnvKeys {
+			fn.AddEnvironment(jsii.String(k), jsii.String(apiEnv[k]), &awslambda.EnvironmentOptions{})
+		}
+	}
 
+	// API Gateway's own errors, e.g. from the authorizer, can only have CORS headers if the origin doesn't need checking
+	if o, ok := cors.StaticOrigin(); ok {
+		h := map[string]*string{
+			"Access-Control-Allow-Origin": jsii.String("'" + o + "'"),
+		}
+		if cors.AllowCredentials {
+			h["Access-Control-Allow-Credentials"] = jsii.String("'true'")
+		}
+		authApi.AddGatewayResponse(jsii.String("default4xx"), &awsapigateway.GatewayResponseOptions{
+			Type:            awsapigateway.ResponseType_DEFAULT_4XX(),
+			ResponseHeaders: &h,
+		})
+		authApi.AddGatewayResponse(jsii.String("default5xx"), &awsapigateway.GatewayResponseOptions{
+			Type:            awsapigateway.ResponseType_DEFAULT_5XX(),
+			ResponseHeaders: &h,
+		})
+	}
+
+	// Every method goes to the handlers, which answer preflight requests and reject methods they don't support
 	signUp := authApi.Root().AddResource(jsii.String("signup"), &awsapigateway.ResourceOptions{})
-	signUp.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(signUpLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	signUp.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(signUpLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
 
 	signIn := authApi.Root().AddResource(jsii.String("signin"), &awsapigateway.ResourceOptions{})
-	signIn.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(signInLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	signIn.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(signInLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
 
 	verifyEmail := authApi.Root().AddResource(jsii.String("verify"), &awsapigateway.ResourceOptions{})
-	verifyEmail.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(verifyEmailLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	verifyEmail.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(verifyEmailLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	attributes := authApi.Root().AddResource(jsii.String("attributes"), &awsapigateway.ResourceOptions{})
+	attributes.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(attributesLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	email := authApi.Root().AddResource(jsii.String("email"), &awsapigateway.ResourceOptions{})
+	email.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(changeEmailLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	confirmEmail := email.AddResource(jsii.String("confirm"), &awsapigateway.ResourceOptions{})
+	confirmEmail.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(confirmEmailLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	// Role protected routes expect the ID token, so that the handlers can check the cognito:groups claim
+	authorizer := awsapigateway.NewCognitoUserPoolsAuthorizer(stack, jsii.String("authorizer"), &awsapigateway.CognitoUserPoolsAuthorizerProps{
+		CognitoUserPools: &[]awscognito.IUserPool{pool},
+	})
+	adminMethodOptions := &awsapigateway.MethodOptions{
+		AuthorizationType: awsapigateway.AuthorizationType_COGNITO,
+		Authorizer:        authorizer,
+	}
 
 	// TODO: Change to DELETE method at some point
-	// TODO: Add authentication (presumably IAM or something)
 	adminDelete := authApi.Root().AddResource(jsii.String("admin-delete"), &awsapigateway.ResourceOptions{})
-	adminDelete.AddMethod(jsii.String("POST"), awsapigateway.NewLambdaIntegration(adminDeleteLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	addAdminMethods(adminDelete, adminDeleteLambda, adminMethodOptions, "POST")
+
+	invite := authApi.Root().AddResource(jsii.String("invite"), &awsapigateway.ResourceOptions{})
+	addAdminMethods(invite, inviteLambda, adminMethodOptions, "POST")
+
+	roles := authApi.Root().AddResource(jsii.String("roles"), &awsapigateway.ResourceOptions{})
+	addAdminMethods(roles, rolesLambda, adminMethodOptions, "GET", "POST", "DELETE")
+
+	newPassword := authApi.Root().AddResource(jsii.String("new-password"), &awsapigateway.ResourceOptions{})
+	newPassword.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(newPasswordLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	// Matches the refresh token cookie's path
+	refresh := authApi.Root().AddResource(jsii.String("refresh"), &awsapigateway.ResourceOptions{})
+	refresh.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(refreshLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	password := authApi.Root().AddResource(jsii.String("password"), &awsapigateway.ResourceOptions{})
+	password.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(changePasswordLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	forgotPassword := password.AddResource(jsii.String("forgot"), &awsapigateway.ResourceOptions{})
+	forgotPassword.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(forgotPasswordLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+	resetPassword := password.AddResource(jsii.String("reset"), &awsapigateway.ResourceOptions{})
+	resetPassword.AddMethod(jsii.String("ANY"), awsapigateway.NewLambdaIntegration(resetPasswordLambda, &awsapigateway.LambdaIntegrationOptions{}), &awsapigateway.MethodOptions{})
+
+	if cfg.Domain != nil {
+		awsroute53.NewARecord(stack, jsii.String("authRecord"), &awsroute53.ARecordProps{
+			Zone:       zone,
+			RecordName: jsii.String(cfg.Domain.Name),
+			Target:     awsroute53.RecordTarget_FromAlias(awsroute53targets.NewApiGateway(authApi)),
+		})
+	}
 
-	z := awsroute53.HostedZone_FromLookup(stack, jsii.String("zone"), &awsroute53.HostedZoneProviderProps{
-		DomainName: jsii.String("benjaminkitson.com"),
-	})
+	functions := append(slices.Clone(apiLambdas), preSignUpLambda, customMessageLambda, preTokenGenLambda, outboxRelayLambda, reconcileLambda)
 
-	awsroute53.NewARecord(stack, jsii.String("authRecord"), &awsroute53.ARecordProps{
-		Zone:       z,
-		RecordName: jsii.String("auth"),
-		Target:     awsroute53.RecordTarget_FromAlias(awsroute53targets.NewApiGateway(authApi)),
+	// Spans go over OTLP to the ADOT collector layer, which sends them on to X-Ray, see tracing.FromEnv
+	var collector awslambda.ILayerVersion
+	if cfg.Tracing() == tracing.ExporterXRay {
+		collector = awslambda.LayerVersion_FromLayerVersionArn(stack, jsii.String("adotCollector"),
+			awslambda.AdotLambdaLayerGenericVersion_LATEST().LayerArn(stack, awslambda.Architecture_ARM_64()))
+	}
+	for _, fn := range functions {
+		fn.AddEnvironment(jsii.String("TRACING_EXPORTER"), jsii.String(cfg.Tracing()), &awslambda.EnvironmentOptions{})
+		if collector != nil {
+			fn.AddLayers(collector)
+		}
+	}
+
+	addMonitoring(stack, cfg, monitoredResources{
+		Functions:  functions,
+		Scheduled:  []awslambda.Function{outboxRelayLambda, reconcileLambda},
+		API:        authApi,
+		Pool:       pool,
+		PoolClient: poolClient,
+		EventBus:   userEvents,
 	})
 
 	// awscloudfront.NewDistribution(stack, jsii.String("myDist"), &awscloudfront.DistributionProps{
@@ -212,38 +598,17 @@ func main() {
 
 	app := awscdk.NewApp(nil)
 
-	NewCdkWorkshopStack(app, "AuthTestStack", &CdkWorkshopStackProps{
-		awscdk.StackProps{
-			Env: env(),
+	cfg, err := LoadStageConfig(app.Node())
+	if err != nil {
+		panic(err)
+	}
+
+	NewCdkWorkshopStack(app, cfg.StackName, &CdkWorkshopStackProps{
+		StackProps: awscdk.StackProps{
+			Env: cfg.Env(),
 		},
+		Config: cfg,
 	})
 
 	app.Synth(nil)
 }
-
-// env determines the AWS environment (account+region) in which our stack is to
-// be deployed. For more information see: https://docs.aws.amazon.com/cdk/latest/guide/environments.html
-func env() *awscdk.Environment {
-	// If unspecified, this stack will be "environment-agnostic".
-	// Account/Region-dependent features and context lookups will not work, but a
-	// single synthesized template can be deployed anywhere.
-	//---------------------------------------------------------------------------
-	// return nil
-
-	// Uncomment if you know exactly what account and region you want to deploy
-	// the stack to. This is the recommendation for production stacks.
-	//---------------------------------------------------------------------------
-	// return &awscdk.Environment{
-	//  Account: jsii.String("123456789012"),
-	//  Region:  jsii.String("us-east-1"),
-	// }
-
-	// Uncomment to specialize this stack for the AWS Account and Region that are
-	// implied by the current CLI configuration. This is recommended for dev
-	// stacks.
-	//---------------------------------------------------------------------------
-	return &awscdk.Environment{
-		Account: jsii.String(os.Getenv("CDK_DEFAULT_ACCOUNT")),
-		Region:  jsii.String(os.Getenv("CDK_DEFAULT_REGION")),
-	}
-}
@@ -0,0 +1,522 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/assertions"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var testStage = StageConfig{
+	Stage:                "test",
+	StackName:            "AuthTestStack",
+	Account:              "123456789012",
+	Region:               "eu-west-2",
+	UserAPIID:            "userapi123",
+	UserAPIParameterName: "/http-endpoints/user-api",
+	InviteFromAddress:    "no-reply@example.com",
+	CORSAllowedOrigins:   []string{"https://example.com"},
+	CookieDomain:         "example.com",
+	Alarms:               AlarmConfig{Email: "alerts@example.com", LambdaErrors: 3},
+}
+
+/*
+Like goFunction, but the entry is packaged as it is instead of being built, so the stack synthesises offline and
+quickly. Packaging it still fails if the entry doesn't exist.
+*/
+func testFunction(scope constructs.Construct, id string, entry string) awslambda.Function {
+	p := defaultAuthLambdaProps(entry)
+	return awslambda.NewFunction(scope, jsii.String(id), &awslambda.FunctionProps{
+		Architecture: p.Architecture,
+		Description:  p.Description,
+		Tracing:      p.Tracing,
+		Runtime:      p.Runtime,
+		MemorySize:   p.MemorySize,
+		Timeout:      p.Timeout,
+		Handler:      jsii.String("bootstrap"),
+		Code:         awslambda.Code_FromAsset(p.Entry, nil),
+	})
+}
+
+func synth(cfg StageConfig, context map[string]interface{}) assertions.Template {
+	app := awscdk.NewApp(&awscdk.AppProps{Context: &context})
+	stack := NewCdkWorkshopStack(app, cfg.StackName, &CdkWorkshopStackProps{
+		StackProps:  awscdk.StackProps{Env: cfg.Env()},
+		Config:      cfg,
+		NewFunction: testFunction,
+	})
+	return assertions.Template_FromStack(stack, nil)
+}
+
+var (
+	testTemplate     assertions.Template
+	testTemplateOnce sync.Once
+)
+
+// Synthesising takes a few seconds, so the tests share the test stage's template
+func template() assertions.Template {
+	testTemplateOnce.Do(func() {
+		testTemplate = synth(testStage, map[string]interface{}{})
+	})
+	return testTemplate
+}
+
+// Resources of the type by construct ID, which is the logical ID without the hash CDK adds to the end
+func resources(tmpl assertions.Template, resourceType string) map[string]map[string]interface{} {
+	r := map[string]map[string]interface{}{}
+	for id, v := range *tmpl.FindResources(jsii.String(resourceType), nil) {
+		r[id[:len(id)-8]] = *v
+	}
+	return r
+}
+
+func properties(r map[string]interface{}) map[string]interface{} {
+	return r["Properties"].(map[string]interface{})
+}
+
+func TestLambdaEnvironment(t *testing.T) {
+	api := []string{
+		"CORS_ALLOWED_HEADERS", "CORS_ALLOWED_ORIGINS", "CORS_ALLOW_CREDENTIALS", "CORS_EXPOSED_HEADERS", "CORS_MAX_AGE",
+		"SESSION_COOKIES", "SESSION_COOKIE_DOMAIN", "SESSION_COOKIE_SAME_SITE",
+	}
+	cognito := []string{"COGNITO_CLIENT_ID", "COGNITO_USER_POOL_ID"}
+	outbox := []string{"EVENT_BUS_NAME", "OUTBOX_DLQ_URL", "OUTBOX_TABLE"}
+	breach := []string{"PASSWORD_BREACH_FAIL_MODE", "PASSWORD_BREACH_THRESHOLD"}
+	with := func(lists ...[]string) []string {
+		all := []string{}
+		for _, l := range lists {
+			all = append(all, l...)
+		}
+		return all
+	}
+
+	expected := map[string][]string{
+		"adminDeleteHandler":    with(api, cognito, outbox, []string{"USER_API_URL"}),
+		"attributesHandler":     with(api, cognito),
+		"changeEmailHandler":    with(api, cognito),
+		"changePasswordHandler": with(api, cognito, outbox, breach, []string{"RATE_LIMIT_TABLE"}),
+		"confirmEmailHandler":   with(api, cognito, outbox),
+		"customMessageHandler":  {},
+		"fallbackHandler":       api,
+		"forgotPasswordHandler": with(api, cognito, []string{"RATE_LIMIT_TABLE"}),
+		"inviteHandler":         with(api, cognito, []string{"INVITE_FROM_ADDRESS", "USER_API_URL"}),
+		"newPasswordHandler":    with(api, cognito, breach),
+		"outboxRelayHandler":    with(outbox, []string{"COGNITO_USER_POOL_ID", "USER_API_URL"}),
+		"preSignUpHandler":      {"ALLOWED_EMAIL_DOMAINS", "DENIED_EMAIL_DOMAINS", "TRUSTED_EMAIL_DOMAINS"},
+		"preTokenGenHandler":    {"SUPPRESSED_CLAIMS", "USER_ID_FAIL_MODE"},
+		"reconcileHandler":      {"COGNITO_USER_POOL_ID", "OUTBOX_TABLE", "REPORT_BUCKET"},
+		"refreshHandler":        with(api, cognito),
+		"resetPasswordHandler":  with(api, cognito, outbox, breach, []string{"RATE_LIMIT_TABLE"}),
+		"rolesHandler":          with(api, cognito),
+		"signInHandler":         with(api, cognito, []string{"RATE_LIMIT_TABLE"}),
+		"signUpHandler":         with(api, cognito, outbox, breach),
+		"verifyEmailHandler":    with(api, cognito, outbox, []string{"RATE_LIMIT_TABLE", "USER_API_URL"}),
+	}
+
+	functions := resources(template(), "AWS::Lambda::Function")
+	assert.Len(t, functions, len(expected))
+	for id, keys := range expected {
+		f, ok := functions[id]
+		if !assert.True(t, ok, id) {
+			continue
+		}
+		vars := map[string]interface{}{}
+		if e, ok := properties(f)["Environment"].(map[string]interface{}); ok {
+			vars = e["Variables"].(map[string]interface{})
+		}
+		got := []string{}
+		for k := range vars {
+			got = append(got, k)
+		}
+		// Every lambda exports its spans
+		assert.ElementsMatch(t, append(keys, "TRACING_EXPORTER"), got, id)
+		assert.Equal(t, "xray", vars["TRACING_EXPORTER"], id)
+		assert.Len(t, properties(f)["Layers"], 1, id)
+
+		// References resolved by appconfig
+		if _, ok := vars["USER_API_URL"]; ok {
+			assert.Equal(t, "ssm:/http-endpoints/user-api", vars["USER_API_URL"], id)
+		}
+		if _, ok := vars["COGNITO_CLIENT_ID"]; ok {
+			assert.Equal(t, "secret:COGNITO_CLIENT-test", vars["COGNITO_CLIENT_ID"], id)
+		}
+	}
+
+	template().HasResourceProperties(jsii.String("AWS::Lambda::Function"), map[string]interface{}{
+		"Environment": map[string]interface{}{"Variables": assertions.Match_ObjectLike(&map[string]interface{}{
+			"CORS_ALLOWED_ORIGINS":  "https://example.com",
+			"SESSION_COOKIE_DOMAIN": "example.com",
+			"SESSION_COOKIES":       "false",
+		})},
+	})
+	template().HasResourceProperties(jsii.String("AWS::Lambda::Function"), map[string]interface{}{
+		"Environment": map[string]interface{}{"Variables": assertions.Match_ObjectLike(&map[string]interface{}{
+			"INVITE_FROM_ADDRESS": "no-reply@example.com",
+		})},
+	})
+}
+
+// Actions that need a wildcard resource
+var wildcardActions = map[string]bool{
+	"xray:PutTraceSegments":    true,
+	"xray:PutTelemetryRecords": true,
+}
+
+func TestIAMStatements(t *testing.T) {
+	userAPI := ":execute-api:eu-west-2:123456789012:userapi123/*/*/*"
+	invokers := []string{}
+
+	for id, p := range resources(template(), "AWS::IAM::Policy") {
+		doc := properties(p)["PolicyDocument"].(map[string]interface{})
+		for _, s := range doc["Statement"].([]interface{}) {
+			s := s.(map[string]interface{})
+			assert.Equal(t, "Allow", s["Effect"], id)
+
+			actions := []string{}
+			switch a := s["Action"].(type) {
+			case string:
+				actions = append(actions, a)
+			case []interface{}:
+				for _, v := range a {
+					actions = append(actions, v.(string))
+				}
+			}
+			for _, a := range actions {
+				// Only S3's grants add wildcard actions, for aborting multipart uploads
+				if strings.Contains(a, "*") {
+					assert.Equal(t, "s3:Abort*", a, id)
+				}
+			}
+
+			r, _ := json.Marshal(s["Resource"])
+			if string(r) == `"*"` {
+				for _, a := range actions {
+					assert.True(t, wildcardActions[a], "%s has %s on every resource", id, a)
+				}
+			}
+
+			if len(actions) == 1 && actions[0] == "execute-api:Invoke" {
+				assert.Contains(t, string(r), userAPI, id)
+				invokers = append(invokers, strings.TrimSuffix(id, "ServiceRoleDefaultPolicy"))
+			}
+			if strings.HasPrefix(actions[0], "cognito-idp:") {
+				assert.Contains(t, string(r), `"testPool`, id)
+			}
+		}
+	}
+
+	sort.Strings(invokers)
+	assert.Equal(t, []string{
+		"adminDeleteHandler", "inviteHandler", "outboxRelayHandler", "verifyEmailHandler",
+	}, invokers)
+
+	template().HasResourceProperties(jsii.String("AWS::IAM::Policy"), map[string]interface{}{
+		"PolicyDocument": map[string]interface{}{"Statement": assertions.Match_ArrayWith(&[]interface{}{
+			map[string]interface{}{
+				"Action":   "ses:SendEmail",
+				"Effect":   "Allow",
+				"Resource": assertions.Match_AnyValue(),
+			},
+		})},
+	})
+}
+
+func TestRoutes(t *testing.T) {
+	tmpl := template()
+	paths := map[string]string{}
+	parents := map[string]string{}
+	for id, r := range *tmpl.FindResources(jsii.String("AWS::ApiGateway::Resource"), nil) {
+		p := properties(*r)
+		paths[id] = p["PathPart"].(string)
+		if ref, ok := p["ParentId"].(map[string]interface{})["Ref"]; ok {
+			parents[id] = ref.(string)
+		}
+	}
+	path := func(id string) string {
+		full := ""
+		for ; id != ""; id = parents[id] {
+			full = "/" + paths[id] + full
+		}
+		return full
+	}
+
+	routes := []string{}
+	for _, m := range *tmpl.FindResources(jsii.String("AWS::ApiGateway::Method"), nil) {
+		p := properties(*m)
+		route := p["HttpMethod"].(string) + " /"
+		if ref, ok := p["ResourceId"].(map[string]interface{})["Ref"]; ok {
+			route = p["HttpMethod"].(string) + " " + path(ref.(string))
+		}
+		routes = append(routes, route+" "+p["AuthorizationType"].(string))
+
+		// Admin routes have to be checked by the pool's authorizer, the handlers rely on its claims
+		if p["AuthorizationType"] == "COGNITO_USER_POOLS" {
+			ref, _ := p["AuthorizerId"].(map[string]interface{})["Ref"].(string)
+			assert.True(t, strings.HasPrefix(ref, "authorizer"), route)
+		}
+	}
+	sort.Strings(routes)
+
+	assert.Equal(t, []string{
+		"ANY / NONE",
+		"ANY /attributes NONE",
+		"ANY /email NONE",
+		"ANY /email/confirm NONE",
+		"ANY /new-password NONE",
+		"ANY /password NONE",
+		"ANY /password/forgot NONE",
+		"ANY /password/reset NONE",
+		"ANY /refresh NONE",
+		"ANY /signin NONE",
+		"ANY /signup NONE",
+		"ANY /verify NONE",
+		"ANY /{proxy+} NONE",
+		"DELETE /roles COGNITO_USER_POOLS",
+		"GET /roles COGNITO_USER_POOLS",
+		"OPTIONS /admin-delete NONE",
+		"OPTIONS /invite NONE",
+		"OPTIONS /roles NONE",
+		"POST /admin-delete COGNITO_USER_POOLS",
+		"POST /invite COGNITO_USER_POOLS",
+		"POST /roles COGNITO_USER_POOLS",
+	}, routes)
+}
+
+func TestUserPool(t *testing.T) {
+	p := validation.DefaultPasswordPolicy
+	template().HasResource(jsii.String("AWS::Cognito::UserPool"), map[string]interface{}{
+		"DeletionPolicy": "Delete",
+		"Properties": assertions.Match_ObjectLike(&map[string]interface{}{
+			"UserPoolName":           "Test User Pool-test",
+			"UsernameAttributes":     []string{"email"},
+			"AutoVerifiedAttributes": []string{"email"},
+			"Policies": map[string]interface{}{"PasswordPolicy": assertions.Match_ObjectLike(&map[string]interface{}{
+				"MinimumLength":    p.MinLength,
+				"RequireLowercase": p.RequireLowercase,
+				"RequireUppercase": p.RequireUppercase,
+				"RequireNumbers":   p.RequireDigits,
+				"RequireSymbols":   p.RequireSymbols,
+			})},
+			"AccountRecoverySetting": map[string]interface{}{"RecoveryMechanisms": []interface{}{
+				map[string]interface{}{"Name": "verified_email", "Priority": 1},
+			}},
+			"UserAttributeUpdateSettings": map[string]interface{}{"AttributesRequireVerificationBeforeUpdate": []string{"email"}},
+			"Schema": assertions.Match_ArrayWith(&[]interface{}{
+				assertions.Match_ObjectLike(&map[string]interface{}{"Name": "user_id", "Mutable": true}),
+			}),
+			"LambdaConfig": assertions.Match_ObjectLike(&map[string]interface{}{
+				"PreSignUp":          assertions.Match_AnyValue(),
+				"CustomMessage":      assertions.Match_AnyValue(),
+				"PreTokenGeneration": assertions.Match_AnyValue(),
+			}),
+		}),
+	})
+	template().ResourceCountIs(jsii.String("AWS::Cognito::UserPoolGroup"), jsii.Number(3))
+	template().HasResourceProperties(jsii.String("AWS::Cognito::UserPoolClient"), map[string]interface{}{
+		"ExplicitAuthFlows": assertions.Match_ArrayWith(&[]interface{}{"ALLOW_USER_PASSWORD_AUTH"}),
+		"WriteAttributes":   []string{"custom:marketing_consent", "custom:tenant", "email", "locale", "name"},
+	})
+
+	// The API has no custom domain
+	template().ResourceCountIs(jsii.String("AWS::ApiGateway::DomainName"), jsii.Number(0))
+	template().ResourceCountIs(jsii.String("AWS::Route53::RecordSet"), jsii.Number(0))
+	template().HasResourceProperties(jsii.String("AWS::ApiGateway::RestApi"), map[string]interface{}{
+		"Name":                      "bk-auth-test",
+		"DisableExecuteApiEndpoint": assertions.Match_Absent(),
+	})
+}
+
+func TestMonitoring(t *testing.T) {
+	tmpl := template()
+	tmpl.HasResourceProperties(jsii.String("AWS::SNS::Topic"), map[string]interface{}{"TopicName": "bk-auth-alarms-test"})
+	tmpl.HasResourceProperties(jsii.String("AWS::SNS::Subscription"), map[string]interface{}{
+		"Protocol": "email",
+		"Endpoint": "alerts@example.com",
+	})
+	tmpl.HasResourceProperties(jsii.String("AWS::CloudWatch::Dashboard"), map[string]interface{}{"DashboardName": "bk-auth-test"})
+
+	alarms := resources(tmpl, "AWS::CloudWatch::Alarm")
+	// Errors and throttles for every lambda, duration for all but the two scheduled ones, and the API and Cognito alarms
+	assert.Len(t, alarms, 20+20+18+2+1)
+	for id, a := range alarms {
+		p := properties(a)
+		assert.Len(t, p["AlarmActions"], 1, id)
+		assert.Len(t, p["OKActions"], 1, id)
+		assert.Equal(t, "notBreaching", p["TreatMissingData"], id)
+	}
+	for _, id := range []string{"outboxRelayHandlerDuration", "reconcileHandlerDuration"} {
+		assert.NotContains(t, alarms, id)
+	}
+
+	// The stage's own thresholds, and the defaults for the rest
+	threshold := func(id string) interface{} {
+		return properties(alarms[id])["Threshold"]
+	}
+	assert.EqualValues(t, 3, threshold("signInHandlerErrors"))
+	assert.EqualValues(t, DefaultAlarmConfig.LambdaThrottles, threshold("signInHandlerThrottles"))
+	assert.EqualValues(t, DefaultAlarmConfig.LambdaP99DurationMs, threshold("signInHandlerDuration"))
+	assert.EqualValues(t, DefaultAlarmConfig.API4xxRate, threshold("api4xxRate"))
+	assert.EqualValues(t, DefaultAlarmConfig.API5xxRate, threshold("api5xxRate"))
+	assert.EqualValues(t, DefaultAlarmConfig.SignInFailures, threshold("signInFailures"))
+
+	p := properties(alarms["signInHandlerDuration"])
+	assert.Equal(t, "p99", p["ExtendedStatistic"])
+	assert.EqualValues(t, 300, p["Period"])
+	assert.Equal(t, "bk-auth-signInHandlerDuration-test", p["AlarmName"])
+
+	// Failed sign ins are worked out from Cognito's metrics for the app client
+	b, err := json.Marshal(properties(alarms["signInFailures"])["Metrics"])
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `"Expression":"attempts - successes"`)
+	assert.Contains(t, string(b), `"Namespace":"AWS/Cognito"`)
+	assert.Contains(t, string(b), `"UserPoolClient"`)
+
+	// The funnel's rules match the user events on the bus
+	for _, eventType := range []string{events.TypeUserSignedUp, events.TypeUserVerified} {
+		tmpl.HasResourceProperties(jsii.String("AWS::Events::Rule"), map[string]interface{}{
+			"EventBusName": assertions.Match_AnyValue(),
+			"EventPattern": map[string]interface{}{
+				"source":      []string{events.Source},
+				"detail-type": []string{eventType},
+			},
+		})
+	}
+}
+
+func TestStages(t *testing.T) {
+	prod := testStage
+	prod.Stage, prod.StackName, prod.Retain = "prod", "AuthStack", true
+	prod.Alarms = AlarmConfig{PeriodMinutes: 1, SignInFailures: 20}
+	prod.TracingExporter = "stdout"
+	prod.DeniedEmailDomains = []string{"example.org", "example.net"}
+	prod.TrustedEmailDomains = []string{"benjaminkitson.com"}
+	prod.Domain = &DomainConfig{Name: "auth.example.com", HostedZone: "example.com"}
+
+	tmpl := synth(prod, map[string]interface{}{
+		"hosted-zone:account=123456789012:domainName=example.com:region=eu-west-2": map[string]interface{}{
+			"Id":   "/hostedzone/Z0000000000000000000",
+			"Name": "example.com.",
+		},
+	})
+
+	tmpl.HasResource(jsii.String("AWS::Cognito::UserPool"), map[string]interface{}{"DeletionPolicy": "Retain"})
+	// Pending side-effects in the outbox would be lost with it, like the rate limits
+	for id, table := range resources(tmpl, "AWS::DynamoDB::Table") {
+		assert.Equal(t, "Retain", table["DeletionPolicy"], id)
+	}
+	tmpl.HasResourceProperties(jsii.String("AWS::SecretsManager::Secret"), map[string]interface{}{"Name": "COGNITO_CLIENT-prod"})
+	tmpl.HasResourceProperties(jsii.String("AWS::Events::EventBus"), map[string]interface{}{"Name": "bk-auth-user-events-prod"})
+	tmpl.HasResourceProperties(jsii.String("AWS::CloudWatch::Alarm"), map[string]interface{}{
+		"AlarmName": "bk-auth-signInFailures-prod",
+		"Threshold": 20,
+	})
+	tmpl.ResourceCountIs(jsii.String("AWS::SNS::Subscription"), jsii.Number(0))
+
+	// Without the X-Ray exporter there's no collector to send spans to
+	tmpl.HasResourceProperties(jsii.String("AWS::Lambda::Function"), map[string]interface{}{
+		"Environment": map[string]interface{}{"Variables": assertions.Match_ObjectLike(&map[string]interface{}{
+			"TRACING_EXPORTER": "stdout",
+		})},
+		"Layers": assertions.Match_Absent(),
+	})
+
+	tmpl.HasResourceProperties(jsii.String("AWS::Lambda::Function"), map[string]interface{}{
+		"Environment": map[string]interface{}{"Variables": map[string]interface{}{
+			"ALLOWED_EMAIL_DOMAINS": "",
+			"DENIED_EMAIL_DOMAINS":  "example.org,example.net",
+			"TRUSTED_EMAIL_DOMAINS": "benjaminkitson.com",
+			"TRACING_EXPORTER":      "stdout",
+		}},
+	})
+
+	// Without a certificate ARN, one is created and validated in the hosted zone
+	tmpl.HasResourceProperties(jsii.String("AWS::CertificateManager::Certificate"), map[string]interface{}{
+		"DomainName":       "auth.example.com",
+		"ValidationMethod": "DNS",
+	})
+	tmpl.HasResourceProperties(jsii.String("AWS::ApiGateway::DomainName"), map[string]interface{}{
+		"DomainName": "auth.example.com",
+	})
+	tmpl.HasResourceProperties(jsii.String("AWS::ApiGateway::RestApi"), map[string]interface{}{
+		"DisableExecuteApiEndpoint": true,
+	})
+	tmpl.HasResourceProperties(jsii.String("AWS::Route53::RecordSet"), map[string]interface{}{
+		"Name":         "auth.example.com.",
+		"Type":         "A",
+		"HostedZoneId": "Z0000000000000000000",
+	})
+}
+
+func TestStagesFile(t *testing.T) {
+	stages := map[string]StageConfig{}
+	b, err := os.ReadFile(defaultStageConfigFile)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(b, &stages))
+	for _, s := range []string{"dev", "staging", "prod"} {
+		assert.Contains(t, stages, s)
+	}
+
+	// Dev keeps the names it was deployed with
+	dev := stages["dev"]
+	dev.Stage = "dev"
+	assert.Nil(t, dev.Validate())
+	assert.Equal(t, "AuthTestStack", dev.StackName)
+	assert.Equal(t, "COGNITO_CLIENT", dev.Name("COGNITO_CLIENT"))
+
+	// The user API for the other stages has to be given with -c userApiId=...
+	staging := stages["staging"]
+	staging.Stage = "staging"
+	assert.ErrorContains(t, staging.Validate(), "userApiId")
+	assert.ErrorContains(t, staging.Validate(), "-c <name>=<value>")
+	staging.UserAPIID = "userapi123"
+	assert.Nil(t, staging.Validate())
+	assert.Equal(t, "COGNITO_CLIENT-staging", staging.Name("COGNITO_CLIENT"))
+	assert.True(t, stages["prod"].Retain)
+
+	staging.TracingExporter = "jaeger"
+	assert.ErrorContains(t, staging.Validate(), "tracingExporter")
+	staging.TracingExporter = ""
+	assert.Equal(t, "xray", staging.Tracing())
+
+	staging.InviteFromAddress = "no-reply"
+	assert.Error(t, staging.Validate())
+}
+
+// Asset hashes change with the lambdas' source, so they're replaced before comparing
+var assetHash = regexp.MustCompile(`[0-9a-f]{64}`)
+
+/*
+Compares the synthesised template to the golden file in testdata. Run with -update after changing the stack, and
+check the diff is what you expected.
+*/
+func TestSnapshot(t *testing.T) {
+	b, err := json.MarshalIndent(template().ToJSON(), "", "  ")
+	assert.Nil(t, err)
+	got := assetHash.ReplaceAllString(string(b), "ASSET_HASH") + "\n"
+
+	golden := filepath.Join("testdata", "template.golden")
+	if *update {
+		assert.Nil(t, os.MkdirAll("testdata", 0755))
+		assert.Nil(t, os.WriteFile(golden, []byte(got), 0644))
+	}
+
+	want, err := os.ReadFile(golden)
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), got)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/constructs-go/constructs/v10"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/benjaminkitson/bk-auth-api/tracing"
+)
+
+const (
+	defaultStage           = "dev"
+	defaultStageConfigFile = "stages.json"
+)
+
+// A custom domain for the API, in a Route 53 hosted zone that's already in the account
+type DomainConfig struct {
+	Name       string `json:"name"`
+	HostedZone string `json:"hostedZone"`
+	// A DNS validated certificate is created in the hosted zone if this is empty
+	CertificateARN string `json:"certificateArn,omitempty"`
+}
+
+/*
+Everything that differs between deployments of the stack. Stages are kept in stages.json, and the stage is picked with
+the stage context value, e.g. cdk deploy -c stage=staging. Most settings can be overridden with a context value of the
+same name.
+*/
+type StageConfig struct {
+	Stage     string `json:"-"`
+	StackName string `json:"stackName"`
+	// Fall back to CDK_DEFAULT_ACCOUNT and CDK_DEFAULT_REGION
+	Account string `json:"account,omitempty"`
+	Region  string `json:"region,omitempty"`
+	// The bk-user-api REST API the lambdas call, and the parameter its endpoint is kept in
+	UserAPIID            string `json:"userApiId"`
+	UserAPIParameterName string `json:"userApiParameterName"`
+	// Must be from an SES verified identity
+	InviteFromAddress  string   `json:"inviteFromAddress"`
+	CORSAllowedOrigins []string `json:"corsAllowedOrigins"`
+	SessionCookies     bool     `json:"sessionCookies"`
+	CookieDomain       string   `json:"cookieDomain,omitempty"`
+	// Email domain policy for self sign up, see lambda/presignup. Any domain can sign up if AllowedEmailDomains is empty
+	AllowedEmailDomains []string `json:"allowedEmailDomains,omitempty"`
+	DeniedEmailDomains  []string `json:"deniedEmailDomains,omitempty"`
+	TrustedEmailDomains []string `json:"trustedEmailDomains,omitempty"`
+	// API Gateway's own endpoint is used without one
+	Domain *DomainConfig `json:"domain,omitempty"`
+	// Where the lambdas send their spans, one of the tracing.Exporter constants. Defaults to X-Ray.
+	TracingExporter string `json:"tracingExporter,omitempty"`
+	// Keeps the user pool and tables if the stack is deleted
+	Retain bool        `json:"retain"`
+	Alarms AlarmConfig `json:"alarms"`
+}
+
+/*
+Physical names of resources that are shared by name, e.g. the client ID secret. Dev keeps the names it was first
+deployed with, so that it doesn't replace them, other stages have the stage on the end so they can share an account.
+*/
+func (c StageConfig) Name(base string) string {
+	if c.Stage == defaultStage {
+		return base
+	}
+	return base + "-" + c.Stage
+}
+
+func (c StageConfig) RemovalPolicy() awscdk.RemovalPolicy {
+	if c.Retain {
+		return awscdk.RemovalPolicy_RETAIN
+	}
+	return awscdk.RemovalPolicy_DESTROY
+}
+
+func (c StageConfig) Tracing() string {
+	if c.TracingExporter == "" {
+		return tracing.ExporterXRay
+	}
+	return c.TracingExporter
+}
+
+// The domain invites are sent from, which SES needs permission to send as
+func (c StageConfig) InviteFromDomain() string {
+	_, d, _ := strings.Cut(c.InviteFromAddress, "@")
+	return d
+}
+
+func (c StageConfig) Validate() error {
+	missing := []string{}
+	for _, s := range [][2]string{
+		{"stackName", c.StackName},
+		{"region", c.Region},
+		{"userApiId", c.UserAPIID},
+		{"userApiParameterName", c.UserAPIParameterName},
+		{"inviteFromAddress", c.InviteFromAddress},
+	} {
+		if s[1] == "" {
+			missing = append(missing, s[0])
+		}
+	}
+	if c.Domain != nil && (c.Domain.Name == "" || c.Domain.HostedZone == "") {
+		missing = append(missing, "domain.name and domain.hostedZone")
+	}
+	if len(missing) > 0 {
+		// Some settings, like userApiId for staging and prod, aren't kept in the stages file at all
+		return fmt.Errorf("stage %s is missing %s: add them to the stages file or pass them with -c <name>=<value>, see README.md", c.Stage, strings.Join(missing, ", "))
+	}
+	switch c.Tracing() {
+	case tracing.ExporterNone, tracing.ExporterXRay, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		return fmt.Errorf("stage %s has an unknown tracingExporter %s", c.Stage, c.TracingExporter)
+	}
+	if c.InviteFromDomain() == "" {
+		return fmt.Errorf("stage %s has an invalid inviteFromAddress %s", c.Stage, c.InviteFromAddress)
+	}
+	if c.Domain != nil && c.Account == "" {
+		return fmt.Errorf("stage %s needs an account to look up its hosted zone", c.Stage)
+	}
+	return nil
+}
+
+func (c StageConfig) Env() *awscdk.Environment {
+	return &awscdk.Environment{
+		Account: jsii.String(c.Account),
+		Region:  jsii.String(c.Region),
+	}
+}
+
+func contextString(node constructs.Node, key string) (string, bool) {
+	v := node.TryGetContext(jsii.String(key))
+	if v == nil {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// Reads the stage named by the stage context value from the stages file, then applies any overrides from context
+func LoadStageConfig(node constructs.Node) (StageConfig, error) {
+	stage, ok := contextString(node, "stage")
+	if !ok {
+		stage = defaultStage
+	}
+	path, ok := contextString(node, "stageConfigFile")
+	if !ok {
+		path = defaultStageConfigFile
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return StageConfig{}, err
+	}
+	stages := map[string]StageConfig{}
+	if err := json.Unmarshal(b, &stages); err != nil {
+		return StageConfig{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	c, ok := stages[stage]
+	if !ok {
+		return StageConfig{}, fmt.Errorf("no stage %s in %s", stage, path)
+	}
+	c.Stage = stage
+
+	for k, v := range map[string]*string{
+		"account":              &c.Account,
+		"region":               &c.Region,
+		"userApiId":            &c.UserAPIID,
+		"userApiParameterName": &c.UserAPIParameterName,
+		"inviteFromAddress":    &c.InviteFromAddress,
+		"cookieDomain":         &c.CookieDomain,
+		"tracingExporter":      &c.TracingExporter,
+		"alarmEmail":           &c.Alarms.Email,
+	} {
+		if o, ok := contextString(node, k); ok {
+			*v = o
+		}
+	}
+	for k, v := range map[string]*[]string{
+		"corsAllowedOrigins":  &c.CORSAllowedOrigins,
+		"allowedEmailDomains": &c.AllowedEmailDomains,
+		"deniedEmailDomains":  &c.DeniedEmailDomains,
+		"trustedEmailDomains": &c.TrustedEmailDomains,
+	} {
+		if o, ok := contextString(node, k); ok {
+			*v = strings.Split(o, ",")
+		}
+	}
+	if o, ok := contextString(node, "sessionCookies"); ok {
+		c.SessionCookies = o == "true"
+	}
+	if o, ok := contextString(node, "domainName"); ok {
+		if o == "" {
+			c.Domain = nil
+		} else {
+			if c.Domain == nil {
+				c.Domain = &DomainConfig{}
+			}
+			c.Domain.Name = o
+		}
+	}
+	if c.Domain != nil {
+		if o, ok := contextString(node, "hostedZone"); ok {
+			c.Domain.HostedZone = o
+		}
+		if o, ok := contextString(node, "certificateArn"); ok {
+			c.Domain.CertificateARN = o
+		}
+	}
+
+	if c.Account == "" {
+		c.Account = os.Getenv("CDK_DEFAULT_ACCOUNT")
+	}
+	if c.Region == "" {
+		c.Region = os.Getenv("CDK_DEFAULT_REGION")
+	}
+	return c, c.Validate()
+}
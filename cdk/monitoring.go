@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-cdk-go/awscdk/v2"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsapigateway"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudwatch"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscloudwatchactions"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awscognito"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awsevents"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awslambda"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssns"
+	"github.com/aws/aws-cdk-go/awscdk/v2/awssnssubscriptions"
+	"github.com/aws/jsii-runtime-go"
+	"github.com/benjaminkitson/bk-auth-api/events"
+)
+
+/*
+Alarm thresholds for a stage, set in the alarms object of its entry in stages.json. Anything left out uses the value
+from DefaultAlarmConfig. Counts are per period.
+*/
+type AlarmConfig struct {
+	// Subscribed to the alarm topic if set, other subscriptions can be added to the topic outside the stack
+	Email           string  `json:"email,omitempty"`
+	PeriodMinutes   float64 `json:"periodMinutes,omitempty"`
+	LambdaErrors    float64 `json:"lambdaErrors,omitempty"`
+	LambdaThrottles float64 `json:"lambdaThrottles,omitempty"`
+	// Not alarmed on for the scheduled lambdas, which take as long as there's work to do
+	LambdaP99DurationMs float64 `json:"lambdaP99DurationMs,omitempty"`
+	// Fractions of API requests, e.g. 0.05 for 5%
+	API4xxRate     float64 `json:"api4xxRate,omitempty"`
+	API5xxRate     float64 `json:"api5xxRate,omitempty"`
+	SignInFailures float64 `json:"signInFailures,omitempty"`
+}
+
+var DefaultAlarmConfig = AlarmConfig{
+	PeriodMinutes:       5,
+	LambdaErrors:        1,
+	LambdaThrottles:     1,
+	LambdaP99DurationMs: 3000,
+	// Failed sign ins and expired tokens are 4xx, so only a large share of them is worth looking at
+	API4xxRate:     0.25,
+	API5xxRate:     0.01,
+	SignInFailures: 50,
+}
+
+func (c AlarmConfig) withDefaults() AlarmConfig {
+	for _, f := range []struct{ v, d *float64 }{
+		{&c.PeriodMinutes, &DefaultAlarmConfig.PeriodMinutes},
+		{&c.LambdaErrors, &DefaultAlarmConfig.LambdaErrors},
+		{&c.LambdaThrottles, &DefaultAlarmConfig.LambdaThrottles},
+		{&c.LambdaP99DurationMs, &DefaultAlarmConfig.LambdaP99DurationMs},
+		{&c.API4xxRate, &DefaultAlarmConfig.API4xxRate},
+		{&c.API5xxRate, &DefaultAlarmConfig.API5xxRate},
+		{&c.SignInFailures, &DefaultAlarmConfig.SignInFailures},
+	} {
+		if *f.v == 0 {
+			*f.v = *f.d
+		}
+	}
+	return c
+}
+
+// What the alarms and dashboard watch
+type monitoredResources struct {
+	Functions []awslambda.Function
+	// Left out of the duration alarms
+	Scheduled  []awslambda.Function
+	API        awsapigateway.RestApi
+	Pool       awscognito.UserPool
+	PoolClient awscognito.UserPoolClient
+	EventBus   awsevents.EventBus
+}
+
+/*
+Alarms for the stack, which notify the topic it returns when they go into and out of alarm, and a dashboard with the
+sign up funnel and the API's health
+*/
+func addMonitoring(stack awscdk.Stack, cfg StageConfig, r monitoredResources) awssns.Topic {
+	ac := cfg.Alarms.withDefaults()
+	period := awscdk.Duration_Minutes(jsii.Number(ac.PeriodMinutes))
+
+	topic := awssns.NewTopic(stack, jsii.String("alarms"), &awssns.TopicProps{
+		TopicName: jsii.String(cfg.Name("bk-auth-alarms")),
+	})
+	if ac.Email != "" {
+		topic.AddSubscription(awssnssubscriptions.NewEmailSubscription(jsii.String(ac.Email), nil))
+	}
+	action := awscloudwatchactions.NewSnsAction(topic)
+
+	alarm := func(id string, description string, metric awscloudwatch.IMetric, threshold float64) {
+		a := awscloudwatch.NewAlarm(stack, jsii.String(id), &awscloudwatch.AlarmProps{
+			AlarmName:          jsii.String(cfg.Name("bk-auth-" + id)),
+			AlarmDescription:   jsii.String(description),
+			Metric:             metric,
+			Threshold:          jsii.Number(threshold),
+			EvaluationPeriods:  jsii.Number(1),
+			ComparisonOperator: awscloudwatch.ComparisonOperator_GREATER_THAN_OR_EQUAL_TO_THRESHOLD,
+			// No traffic isn't a problem
+			TreatMissingData: awscloudwatch.TreatMissingData_NOT_BREACHING,
+		})
+		a.AddAlarmAction(action)
+		a.AddOkAction(action)
+	}
+
+	scheduled := map[string]bool{}
+	for _, fn := range r.Scheduled {
+		scheduled[*fn.Node().Id()] = true
+	}
+	for _, fn := range r.Functions {
+		id := *fn.Node().Id()
+		alarm(id+"Errors", fmt.Sprintf("%s failed", id), fn.MetricErrors(&awscloudwatch.MetricOptions{
+			Period:    period,
+			Statistic: awscloudwatch.Stats_SUM(),
+		}), ac.LambdaErrors)
+		alarm(id+"Throttles", fmt.Sprintf("%s was throttled", id), fn.MetricThrottles(&awscloudwatch.MetricOptions{
+			Period:    period,
+			Statistic: awscloudwatch.Stats_SUM(),
+		}), ac.LambdaThrottles)
+		if !scheduled[id] {
+			alarm(id+"Duration", fmt.Sprintf("%s is slow", id), fn.MetricDuration(&awscloudwatch.MetricOptions{
+				Period:    period,
+				Statistic: awscloudwatch.Stats_P(jsii.Number(99)),
+			}), ac.LambdaP99DurationMs)
+		}
+	}
+
+	// The Average of the API's error metrics is the share of requests that had the error
+	api4xx := r.API.MetricClientError(&awscloudwatch.MetricOptions{
+		Period:    period,
+		Statistic: awscloudwatch.Stats_AVERAGE(),
+	})
+	api5xx := r.API.MetricServerError(&awscloudwatch.MetricOptions{
+		Period:    period,
+		Statistic: awscloudwatch.Stats_AVERAGE(),
+	})
+	alarm("api4xxRate", "A large share of API requests are being rejected", api4xx, ac.API4xxRate)
+	alarm("api5xxRate", "API requests are failing", api5xx, ac.API5xxRate)
+
+	// Cognito counts every sign in attempt in SignInSuccesses, with a value of 1 if it succeeded
+	cognitoMetric := func(name string, statistic *string, label string) awscloudwatch.Metric {
+		return awscloudwatch.NewMetric(&awscloudwatch.MetricProps{
+			Namespace:  jsii.String("AWS/Cognito"),
+			MetricName: jsii.String(name),
+			DimensionsMap: &map[string]*string{
+				"UserPool":       r.Pool.UserPoolId(),
+				"UserPoolClient": r.PoolClient.UserPoolClientId(),
+			},
+			Statistic: statistic,
+			Period:    period,
+			Label:     jsii.String(label),
+		})
+	}
+	signIns := cognitoMetric("SignInSuccesses", awscloudwatch.Stats_SUM(), "Signed in")
+	signInFailures := awscloudwatch.NewMathExpression(&awscloudwatch.MathExpressionProps{
+		Expression: jsii.String("attempts - successes"),
+		UsingMetrics: &map[string]awscloudwatch.IMetric{
+			"attempts":  cognitoMetric("SignInSuccesses", awscloudwatch.Stats_SAMPLE_COUNT(), "Sign in attempts"),
+			"successes": signIns,
+		},
+		Period: period,
+		Label:  jsii.String("Failed sign ins"),
+	})
+	alarm("signInFailures", "Sign ins are failing more than usual, which could be an outage or credential stuffing", signInFailures, ac.SignInFailures)
+
+	// The funnel counts the user events, which are only published once each step has succeeded
+	eventMetric := func(id string, eventType string, label string) awscloudwatch.Metric {
+		rule := awsevents.NewRule(stack, jsii.String(id), &awsevents.RuleProps{
+			EventBus: r.EventBus,
+			EventPattern: &awsevents.EventPattern{
+				Source:     jsii.Strings(events.Source),
+				DetailType: jsii.Strings(eventType),
+			},
+		})
+		return awscloudwatch.NewMetric(&awscloudwatch.MetricProps{
+			Namespace:     jsii.String("AWS/Events"),
+			MetricName:    jsii.String("MatchedEvents"),
+			DimensionsMap: &map[string]*string{"EventBusName": r.EventBus.EventBusName(), "RuleName": rule.RuleName()},
+			Statistic:     awscloudwatch.Stats_SUM(),
+			Period:        awscdk.Duration_Hours(jsii.Number(1)),
+			Label:         jsii.String(label),
+		})
+	}
+	signedUp := eventMetric("userSignedUpEvents", events.TypeUserSignedUp, "Signed up")
+	verified := eventMetric("userVerifiedEvents", events.TypeUserVerified, "Verified")
+
+	dashboard := awscloudwatch.NewDashboard(stack, jsii.String("dashboard"), &awscloudwatch.DashboardProps{
+		DashboardName:   jsii.String(cfg.Name("bk-auth")),
+		DefaultInterval: awscdk.Duration_Days(jsii.Number(7)),
+	})
+	dashboard.AddWidgets(
+		awscloudwatch.NewGraphWidget(&awscloudwatch.GraphWidgetProps{
+			Title: jsii.String("Sign up → verify"),
+			Left:  &[]awscloudwatch.IMetric{signedUp, verified},
+			Right: &[]awscloudwatch.IMetric{awscloudwatch.NewMathExpression(&awscloudwatch.MathExpressionProps{
+				Expression:   jsii.String("100 * verified / signedUp"),
+				UsingMetrics: &map[string]awscloudwatch.IMetric{"signedUp": signedUp, "verified": verified},
+				Period:       awscdk.Duration_Hours(jsii.Number(1)),
+				Label:        jsii.String("Verified %"),
+			})},
+			Width: jsii.Number(12),
+		}),
+		awscloudwatch.NewSingleValueWidget(&awscloudwatch.SingleValueWidgetProps{
+			Title:                jsii.String("Funnel"),
+			Metrics:              &[]awscloudwatch.IMetric{signedUp, verified, signIns.With(&awscloudwatch.MetricOptions{Period: awscdk.Duration_Hours(jsii.Number(1))})},
+			SetPeriodToTimeRange: jsii.Bool(true),
+			Width:                jsii.Number(12),
+		}),
+	)
+	dashboard.AddWidgets(
+		awscloudwatch.NewGraphWidget(&awscloudwatch.GraphWidgetProps{
+			Title: jsii.String("API error rates"),
+			Left: &[]awscloudwatch.IMetric{
+				api4xx.With(&awscloudwatch.MetricOptions{Label: jsii.String("4xx")}),
+				api5xx.With(&awscloudwatch.MetricOptions{Label: jsii.String("5xx")}),
+			},
+			Width: jsii.Number(12),
+		}),
+		awscloudwatch.NewGraphWidget(&awscloudwatch.GraphWidgetProps{
+			Title: jsii.String("Sign ins"),
+			Left:  &[]awscloudwatch.IMetric{signIns, signInFailures},
+			Width: jsii.Number(12),
+		}),
+	)
+
+	lambdaErrors := []awscloudwatch.IMetric{}
+	lambdaDurations := []awscloudwatch.IMetric{}
+	for _, fn := range r.Functions {
+		label := jsii.String(*fn.Node().Id())
+		lambdaErrors = append(lambdaErrors, fn.MetricErrors(&awscloudwatch.MetricOptions{Period: period, Label: label}))
+		lambdaDurations = append(lambdaDurations, fn.MetricDuration(&awscloudwatch.MetricOptions{
+			Period:    period,
+			Statistic: awscloudwatch.Stats_P(jsii.Number(99)),
+			Label:     label,
+		}))
+	}
+	dashboard.AddWidgets(
+		awscloudwatch.NewGraphWidget(&awscloudwatch.GraphWidgetProps{
+			Title: jsii.String("Lambda errors"),
+			Left:  &lambdaErrors,
+			Width: jsii.Number(12),
+		}),
+		awscloudwatch.NewGraphWidget(&awscloudwatch.GraphWidgetProps{
+			Title: jsii.String("Lambda p99 duration"),
+			Left:  &lambdaDurations,
+			Width: jsii.Number(12),
+		}),
+	)
+
+	return topic
+}
@@ -0,0 +1,106 @@
+package cognito
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+)
+
+// A user attribute that clients may write, keyed in request bodies by a friendlier name than Cognito's
+type attribute struct {
+	name     string
+	validate func(string) error
+}
+
+var (
+	localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+	tenantPattern = regexp.MustCompile(`^[a-z0-9-]{1,64}$`)
+)
+
+var nameAttribute = attribute{"name", func(v string) error {
+	if len(v) == 0 || len(v) > 256 {
+		return fmt.Errorf("must be between 1 and 256 characters")
+	}
+	return nil
+}}
+
+var localeAttribute = attribute{"locale", func(v string) error {
+	if !localePattern.MatchString(v) {
+		return fmt.Errorf("must be a language tag such as en or en-GB")
+	}
+	return nil
+}}
+
+var marketingConsentAttribute = attribute{"custom:marketing_consent", func(v string) error {
+	if v != "true" && v != "false" {
+		return fmt.Errorf("must be true or false")
+	}
+	return nil
+}}
+
+var tenantAttribute = attribute{"custom:tenant", func(v string) error {
+	if !tenantPattern.MatchString(v) {
+		return fmt.Errorf("must be up to 64 lowercase letters, digits or hyphens")
+	}
+	return nil
+}}
+
+/*
+The attributes clients may set at sign up and change afterwards. These must be kept in line with the custom
+attributes and client write attributes in cdk/cdk.go. Anything else, e.g. email_verified or a tenant change, is
+privileged and has to go through an admin route.
+*/
+var signUpAttributes = map[string]attribute{
+	"name":             nameAttribute,
+	"locale":           localeAttribute,
+	"marketingConsent": marketingConsentAttribute,
+	// Immutable once the user exists
+	"tenant": tenantAttribute,
+}
+
+var updatableAttributes = map[string]attribute{
+	"name":             nameAttribute,
+	"locale":           localeAttribute,
+	"marketingConsent": marketingConsentAttribute,
+}
+
+/*
+Converts the allowed attributes in a request body to Cognito user attributes, ignoring the given non-attribute keys.
+Any other key, or an invalid value, is rejected rather than silently dropped.
+*/
+func userAttributes(body map[string]string, allowed map[string]attribute, ignore ...string) ([]types.AttributeType, error) {
+	ignored := map[string]bool{}
+	for _, k := range ignore {
+		ignored[k] = true
+	}
+
+	keys := []string{}
+	for k := range body {
+		if !ignored[k] {
+			keys = append(keys, k)
+		}
+	}
+	// Sorted so the attributes sent to Cognito, and any error, are deterministic
+	sort.Strings(keys)
+
+	attrs := []types.AttributeType{}
+	for _, k := range keys {
+		a, ok := allowed[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: attribute %v cannot be set", auth.ErrInvalidRequest, k)
+		}
+		err := a.validate(body[k])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v %v", auth.ErrInvalidRequest, k, err)
+		}
+		attrs = append(attrs, types.AttributeType{
+			Name:  aws.String(a.name),
+			Value: aws.String(body[k]),
+		})
+	}
+	return attrs, nil
+}
@@ -2,11 +2,17 @@ package cognito
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/aws/jsii-runtime-go"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
 	"go.uber.org/zap"
 )
 
@@ -32,20 +38,35 @@ type CognitoClient interface {
 	SignUp(context.Context, *cognitoidentityprovider.SignUpInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.SignUpOutput, error)
 	ConfirmSignUp(context.Context, *cognitoidentityprovider.ConfirmSignUpInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ConfirmSignUpOutput, error)
 	AdminDeleteUser(context.Context, *cognitoidentityprovider.AdminDeleteUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminDeleteUserOutput, error)
+	AdminCreateUser(context.Context, *cognitoidentityprovider.AdminCreateUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminCreateUserOutput, error)
+	AdminAddUserToGroup(context.Context, *cognitoidentityprovider.AdminAddUserToGroupInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminAddUserToGroupOutput, error)
+	AdminRemoveUserFromGroup(context.Context, *cognitoidentityprovider.AdminRemoveUserFromGroupInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminRemoveUserFromGroupOutput, error)
+	AdminListGroupsForUser(context.Context, *cognitoidentityprovider.AdminListGroupsForUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminListGroupsForUserOutput, error)
+	UpdateUserAttributes(context.Context, *cognitoidentityprovider.UpdateUserAttributesInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.UpdateUserAttributesOutput, error)
+	GetUser(context.Context, *cognitoidentityprovider.GetUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.GetUserOutput, error)
+	VerifyUserAttribute(context.Context, *cognitoidentityprovider.VerifyUserAttributeInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.VerifyUserAttributeOutput, error)
+	RespondToAuthChallenge(context.Context, *cognitoidentityprovider.RespondToAuthChallengeInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.RespondToAuthChallengeOutput, error)
+	ForgotPassword(context.Context, *cognitoidentityprovider.ForgotPasswordInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ForgotPasswordOutput, error)
+	ConfirmForgotPassword(context.Context, *cognitoidentityprovider.ConfirmForgotPasswordInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ConfirmForgotPasswordOutput, error)
+	ChangePassword(context.Context, *cognitoidentityprovider.ChangePasswordInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ChangePasswordOutput, error)
+	ListUsers(context.Context, *cognitoidentityprovider.ListUsersInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ListUsersOutput, error)
+	AdminGetUser(context.Context, *cognitoidentityprovider.AdminGetUserInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminGetUserOutput, error)
+	AdminUpdateUserAttributes(context.Context, *cognitoidentityprovider.AdminUpdateUserAttributesInput, ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminUpdateUserAttributesOutput, error)
 }
 
 // TODO: Some errors (username already exists, incorrect password etc) aren't really errors at all, and need to be accounted for
-// TODO: All of these methods should accept ctx as the first arg
 
 const signInSuccessMessage = "Successfully signed in!"
+const newPasswordRequiredMessage = "A new password is required to complete sign in"
+const challengeMessage = "Further verification is required to complete sign in"
 
-func (ca Adapter) SignIn(body map[string]string) (map[string]string, error) {
+func (ca Adapter) SignIn(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if body["email"] == "" || body["password"] == "" {
 		ca.logger.Error("invalid request body!")
 		return nil, fmt.Errorf("invalid request body")
 	}
 
-	output, err := ca.identityProviderClient.InitiateAuth(context.Background(), &cognitoidentityprovider.InitiateAuthInput{
+	output, err := ca.identityProviderClient.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
 		AuthFlow:       "USER_PASSWORD_AUTH",
 		ClientId:       aws.String(ca.clientId),
 		AuthParameters: map[string]string{"USERNAME": body["email"], "PASSWORD": body["password"]},
@@ -53,35 +74,115 @@ func (ca Adapter) SignIn(body map[string]string) (map[string]string, error) {
 
 	if err != nil {
 		ca.logger.Error("signup failed!", zap.Error(err))
-		return nil, fmt.Errorf(err.Error())
+		return nil, err
 	}
-	ca.logger.Info("signin output", zap.Any("output", output))
+	ca.logger.Info("signin output", logging.Output("output", output))
 
-	return map[string]string{
-		"token":   *output.AuthenticationResult.AccessToken,
+	// Invited users have to choose their own password before Cognito will issue any tokens, and MFA or a custom auth
+	// flow would add challenges of their own, so any challenge is handed back to the client to answer
+	if output.ChallengeName != "" {
+		message := challengeMessage
+		if output.ChallengeName == types.ChallengeNameTypeNewPasswordRequired {
+			message = newPasswordRequiredMessage
+		}
+		return map[string]string{
+			"challenge": string(output.ChallengeName),
+			"session":   aws.ToString(output.Session),
+			"message":   message,
+		}, nil
+	}
+
+	return ca.tokenResponse(output.AuthenticationResult)
+}
+
+/*
+Exchanges a refresh token for new access and ID tokens
+*/
+func (ca Adapter) Refresh(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["refreshToken"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	output, err := ca.identityProviderClient.InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+		AuthFlow:       types.AuthFlowTypeRefreshTokenAuth,
+		ClientId:       aws.String(ca.clientId),
+		AuthParameters: map[string]string{"REFRESH_TOKEN": body["refreshToken"]},
+	})
+	var nae *types.NotAuthorizedException
+	if errors.As(err, &nae) {
+		ca.logger.Error("refresh token rejected!", zap.Error(err))
+		return nil, fmt.Errorf("%w: %s", auth.ErrInvalidToken, nae.ErrorMessage())
+	}
+	if err != nil {
+		ca.logger.Error("refresh failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return ca.tokenResponse(output.AuthenticationResult)
+}
+
+/*
+The access token is returned as "token". The ID token is included too when present, as it's the token the API
+Gateway Cognito authorizer expects on role protected routes.
+*/
+func (ca Adapter) tokenResponse(ar *types.AuthenticationResultType) (map[string]string, error) {
+	// Cognito shouldn't answer without either a challenge or tokens, but a panic would take the instance down with it
+	if ar == nil || ar.AccessToken == nil {
+		ca.logger.Error("no tokens in authentication result!")
+		return nil, fmt.Errorf("no tokens in authentication result")
+	}
+	r := map[string]string{
+		"token":   *ar.AccessToken,
 		"message": signInSuccessMessage,
-	}, nil
+	}
+	if ar.IdToken != nil {
+		r["idToken"] = *ar.IdToken
+	}
+	// Only issued on sign in, refreshing keeps the same refresh token
+	if ar.RefreshToken != nil {
+		r["refreshToken"] = *ar.RefreshToken
+	}
+	if ar.ExpiresIn > 0 {
+		r["expiresIn"] = strconv.Itoa(int(ar.ExpiresIn))
+	}
+	return r, nil
 }
 
 const signUpSuccessMessage = "Successfully signed up!"
 
-func (ca Adapter) SignUp(body map[string]string) (map[string]string, error) {
+func (ca Adapter) SignUp(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if body["email"] == "" || body["password"] == "" {
 		ca.logger.Error("invalid request body!")
 		return nil, fmt.Errorf("invalid request body")
 	}
 
-	output, err := ca.identityProviderClient.SignUp(context.Background(), &cognitoidentityprovider.SignUpInput{
-		ClientId: jsii.String(ca.clientId),
-		Password: jsii.String(body["password"]),
-		Username: jsii.String(body["email"]),
+	attrs, err := userAttributes(body, signUpAttributes, "email", "password")
+	if err != nil {
+		ca.logger.Error("invalid user attributes!", zap.Error(err))
+		return nil, err
+	}
+
+	output, err := ca.identityProviderClient.SignUp(ctx, &cognitoidentityprovider.SignUpInput{
+		ClientId:       jsii.String(ca.clientId),
+		Password:       jsii.String(body["password"]),
+		Username:       jsii.String(body["email"]),
+		UserAttributes: attrs,
 	})
 
+	// Rejections from the pre sign up trigger are the client's fault, so pass them on as such
+	var lve *types.UserLambdaValidationException
+	if errors.As(err, &lve) {
+		if re, ok := auth.ParseRequestError(lve.ErrorMessage()); ok {
+			ca.logger.Error("signup rejected by trigger", zap.String("code", re.Code))
+			return nil, re
+		}
+	}
 	if err != nil {
 		ca.logger.Error("signup failed!", zap.Error(err))
-		return nil, fmt.Errorf(err.Error())
+		return nil, err
 	}
-	ca.logger.Info("signup output", zap.Any("output", output))
+	ca.logger.Info("signup output", logging.Output("output", output))
 
 	return map[string]string{
 		"message": signUpSuccessMessage,
@@ -90,13 +191,13 @@ func (ca Adapter) SignUp(body map[string]string) (map[string]string, error) {
 
 const verifyEmailSuccessMessage = "Successfully verified email address!"
 
-func (ca Adapter) VerifyEmail(body map[string]string) (map[string]string, error) {
+func (ca Adapter) VerifyEmail(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if body["email"] == "" || body["code"] == "" {
 		ca.logger.Error("invalid request body!")
 		return nil, fmt.Errorf("invalid request body")
 	}
 
-	output, err := ca.identityProviderClient.ConfirmSignUp(context.Background(), &cognitoidentityprovider.ConfirmSignUpInput{
+	output, err := ca.identityProviderClient.ConfirmSignUp(ctx, &cognitoidentityprovider.ConfirmSignUpInput{
 		ClientId:         jsii.String(ca.clientId),
 		ConfirmationCode: jsii.String(body["code"]),
 		Username:         jsii.String(body["email"]),
@@ -107,7 +208,7 @@ func (ca Adapter) VerifyEmail(body map[string]string) (map[string]string, error)
 		return nil, err
 	}
 
-	ca.logger.Info("verify output", zap.Any("output", output))
+	ca.logger.Info("verify output", logging.Output("output", output))
 
 	return map[string]string{
 		"message": verifyEmailSuccessMessage,
@@ -117,7 +218,7 @@ func (ca Adapter) VerifyEmail(body map[string]string) (map[string]string, error)
 const adminDeleteSuccessMessage = "Successfully deleted user from auth provider"
 
 // TODO: The map[string]string breaks down a bit for this one - consider making it a special case?
-func (ca Adapter) AdminDelete(body map[string]string) (map[string]string, error) {
+func (ca Adapter) AdminDelete(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if body["email"] == "" {
 		ca.logger.Error("invalid request body!")
 		return nil, fmt.Errorf("invalid request body")
@@ -127,7 +228,7 @@ func (ca Adapter) AdminDelete(body map[string]string) (map[string]string, error)
 	// TODO: Investigate what exactly is in the metadata, and if it's needed
 
 	// TODO: Change this to the user pool id
-	_, err := ca.identityProviderClient.AdminDeleteUser(context.Background(), &cognitoidentityprovider.AdminDeleteUserInput{
+	_, err := ca.identityProviderClient.AdminDeleteUser(ctx, &cognitoidentityprovider.AdminDeleteUserInput{
 		UserPoolId: &ca.userPoolID,
 		Username:   &email,
 	})
@@ -138,3 +239,471 @@ func (ca Adapter) AdminDelete(body map[string]string) (map[string]string, error)
 		"message": adminDeleteSuccessMessage,
 	}, nil
 }
+
+const adminInviteSuccessMessage = "Successfully invited user"
+
+/*
+Creates a user on behalf of an admin. If a temporary password is supplied, Cognito sends its own invitation email
+containing it. Otherwise the Cognito message is suppressed and a generated temporary password is returned under
+"temporaryPassword", so that the caller can send the invitation itself.
+*/
+func (ca Adapter) AdminInvite(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	input := &cognitoidentityprovider.AdminCreateUserInput{
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(body["email"]),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(body["email"])},
+			// The invitation is sent to this address, so signing in with the temporary password proves ownership
+			{Name: aws.String("email_verified"), Value: aws.String("true")},
+		},
+	}
+
+	suppress := body["temporaryPassword"] == ""
+	if suppress {
+		p, err := temporaryPassword()
+		if err != nil {
+			ca.logger.Error("failed to generate temporary password", zap.Error(err))
+			return nil, err
+		}
+		input.TemporaryPassword = aws.String(p)
+		input.MessageAction = types.MessageActionTypeSuppress
+	} else {
+		input.TemporaryPassword = aws.String(body["temporaryPassword"])
+		input.DesiredDeliveryMediums = []types.DeliveryMediumType{types.DeliveryMediumTypeEmail}
+	}
+
+	output, err := ca.identityProviderClient.AdminCreateUser(ctx, input)
+	if err != nil {
+		ca.logger.Error("admin create user failed!", zap.Error(err))
+		return nil, err
+	}
+	ca.logger.Info("admin create user output", logging.Output("output", output))
+
+	r := map[string]string{
+		"message": adminInviteSuccessMessage,
+	}
+	if suppress {
+		r["temporaryPassword"] = *input.TemporaryPassword
+	}
+	return r, nil
+}
+
+/*
+Completes the NEW_PASSWORD_REQUIRED challenge returned by SignIn for invited users, using the session from that
+response, and signs the user in
+*/
+func (ca Adapter) CompleteNewPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" || body["newPassword"] == "" || body["session"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	output, err := ca.identityProviderClient.RespondToAuthChallenge(ctx, &cognitoidentityprovider.RespondToAuthChallengeInput{
+		ChallengeName: types.ChallengeNameTypeNewPasswordRequired,
+		ClientId:      aws.String(ca.clientId),
+		Session:       aws.String(body["session"]),
+		ChallengeResponses: map[string]string{
+			"USERNAME":     body["email"],
+			"NEW_PASSWORD": body["newPassword"],
+		},
+	})
+	if err != nil {
+		ca.logger.Error("new password challenge failed!", zap.Error(err))
+		return nil, err
+	}
+	if output.ChallengeName != "" {
+		ca.logger.Error("unexpected challenge after new password", zap.String("challenge", string(output.ChallengeName)))
+		return nil, fmt.Errorf("unexpected challenge %v", output.ChallengeName)
+	}
+
+	return ca.tokenResponse(output.AuthenticationResult)
+}
+
+const forgotPasswordSuccessMessage = "If the account exists, a password reset code has been sent"
+
+/*
+Sends a password reset code to the user's email. Unknown users get the same response, so that this can't be used to
+find out who has an account.
+*/
+func (ca Adapter) ForgotPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	_, err := ca.identityProviderClient.ForgotPassword(ctx, &cognitoidentityprovider.ForgotPasswordInput{
+		ClientId: aws.String(ca.clientId),
+		Username: aws.String(body["email"]),
+	})
+	var unf *types.UserNotFoundException
+	if errors.As(err, &unf) {
+		ca.logger.Info("password reset requested for unknown user")
+		err = nil
+	}
+	if err != nil {
+		ca.logger.Error("forgot password failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return map[string]string{
+		"message": forgotPasswordSuccessMessage,
+	}, nil
+}
+
+const resetPasswordSuccessMessage = "Successfully reset password"
+
+// Sets a new password using the code sent by ForgotPassword
+func (ca Adapter) ConfirmForgotPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" || body["code"] == "" || body["password"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	_, err := ca.identityProviderClient.ConfirmForgotPassword(ctx, &cognitoidentityprovider.ConfirmForgotPasswordInput{
+		ClientId:         aws.String(ca.clientId),
+		Username:         aws.String(body["email"]),
+		ConfirmationCode: aws.String(body["code"]),
+		Password:         aws.String(body["password"]),
+	})
+	if err != nil {
+		ca.logger.Error("confirm forgot password failed!", zap.Error(err))
+		return nil, codeError(err)
+	}
+
+	return map[string]string{
+		"message": resetPasswordSuccessMessage,
+	}, nil
+}
+
+// Wrong and expired codes are the client's fault, anything else is returned as is
+func codeError(err error) error {
+	var cme *types.CodeMismatchException
+	var ece *types.ExpiredCodeException
+	if errors.As(err, &cme) || errors.As(err, &ece) {
+		return auth.RequestError{Code: auth.ErrCodeInvalidCode, Message: "Invalid or expired code"}
+	}
+	return err
+}
+
+const changePasswordSuccessMessage = "Successfully changed password"
+
+/*
+Changes the signed in user's password. Cognito rejects a wrong previous password the same way as a bad access token,
+so both come back as auth.ErrInvalidToken. The user's email is returned as "email", so that callers can say whose
+password changed.
+*/
+func (ca Adapter) ChangePassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["accessToken"] == "" || body["previousPassword"] == "" || body["password"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	email, err := ca.email(ctx, body["accessToken"])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ca.identityProviderClient.ChangePassword(ctx, &cognitoidentityprovider.ChangePasswordInput{
+		AccessToken:      aws.String(body["accessToken"]),
+		PreviousPassword: aws.String(body["previousPassword"]),
+		ProposedPassword: aws.String(body["password"]),
+	})
+	var nae *types.NotAuthorizedException
+	if errors.As(err, &nae) {
+		ca.logger.Error("change password rejected!", zap.Error(err))
+		return nil, fmt.Errorf("%w: %s", auth.ErrInvalidToken, nae.ErrorMessage())
+	}
+	if err != nil {
+		ca.logger.Error("change password failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return map[string]string{
+		"message": changePasswordSuccessMessage,
+		"email":   email,
+	}, nil
+}
+
+const addUserToGroupSuccessMessage = "Successfully added user to group"
+
+func (ca Adapter) AddUserToGroup(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" || body["group"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	_, err := ca.identityProviderClient.AdminAddUserToGroup(ctx, &cognitoidentityprovider.AdminAddUserToGroupInput{
+		GroupName:  aws.String(body["group"]),
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(body["email"]),
+	})
+	if err != nil {
+		ca.logger.Error("add user to group failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return map[string]string{
+		"message": addUserToGroupSuccessMessage,
+	}, nil
+}
+
+const removeUserFromGroupSuccessMessage = "Successfully removed user from group"
+
+func (ca Adapter) RemoveUserFromGroup(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" || body["group"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	_, err := ca.identityProviderClient.AdminRemoveUserFromGroup(ctx, &cognitoidentityprovider.AdminRemoveUserFromGroupInput{
+		GroupName:  aws.String(body["group"]),
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(body["email"]),
+	})
+	if err != nil {
+		ca.logger.Error("remove user from group failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return map[string]string{
+		"message": removeUserFromGroupSuccessMessage,
+	}, nil
+}
+
+// Returns the user's groups as a comma separated list under "groups"
+func (ca Adapter) ListGroupsForUser(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["email"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	groups := []string{}
+	p := cognitoidentityprovider.NewAdminListGroupsForUserPaginator(ca.identityProviderClient, &cognitoidentityprovider.AdminListGroupsForUserInput{
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(body["email"]),
+	})
+	for p.HasMorePages() {
+		output, err := p.NextPage(ctx)
+		if err != nil {
+			ca.logger.Error("list groups for user failed!", zap.Error(err))
+			return nil, err
+		}
+		for _, g := range output.Groups {
+			groups = append(groups, aws.ToString(g.GroupName))
+		}
+	}
+
+	return map[string]string{
+		"groups": strings.Join(groups, ","),
+	}, nil
+}
+
+const updateAttributesSuccessMessage = "Successfully updated attributes"
+
+// Updates the signed in user's own attributes, restricted to those in updatableAttributes
+func (ca Adapter) UpdateAttributes(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["accessToken"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	attrs, err := userAttributes(body, updatableAttributes, "accessToken")
+	if err != nil {
+		ca.logger.Error("invalid user attributes!", zap.Error(err))
+		return nil, err
+	}
+	if len(attrs) == 0 {
+		ca.logger.Error("no attributes to update!")
+		return nil, fmt.Errorf("%w: no attributes supplied", auth.ErrInvalidRequest)
+	}
+
+	_, err = ca.identityProviderClient.UpdateUserAttributes(ctx, &cognitoidentityprovider.UpdateUserAttributesInput{
+		AccessToken:    aws.String(body["accessToken"]),
+		UserAttributes: attrs,
+	})
+	if err != nil {
+		ca.logger.Error("update user attributes failed!", zap.Error(err))
+		return nil, err
+	}
+
+	return map[string]string{
+		"message": updateAttributesSuccessMessage,
+	}, nil
+}
+
+const changeEmailSuccessMessage = "Verification code sent to new email address"
+
+/*
+Starts an email change for the signed in user. Cognito sends a verification code to the new address, and because the
+user pool keeps original attribute values until they're verified, the old address remains the sign in alias until
+ConfirmEmailChange succeeds.
+*/
+func (ca Adapter) ChangeEmail(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["accessToken"] == "" || body["email"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	output, err := ca.identityProviderClient.UpdateUserAttributes(ctx, &cognitoidentityprovider.UpdateUserAttributesInput{
+		AccessToken: aws.String(body["accessToken"]),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("email"), Value: aws.String(body["email"])},
+		},
+	})
+	if err != nil {
+		ca.logger.Error("change email failed!", zap.Error(err))
+		return nil, codeError(err)
+	}
+	ca.logger.Info("change email output", logging.Output("output", output))
+
+	return map[string]string{
+		"message": changeEmailSuccessMessage,
+	}, nil
+}
+
+const confirmEmailChangeSuccessMessage = "Successfully changed email address"
+
+/*
+Verifies the code sent by ChangeEmail, at which point the new address replaces the old one. The previous and new
+addresses are returned as "previousEmail" and "email", with the user's bk-user-api ID as "userId", so that callers can
+update anything keyed on email.
+*/
+func (ca Adapter) ConfirmEmailChange(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if body["accessToken"] == "" || body["code"] == "" {
+		ca.logger.Error("invalid request body!")
+		return nil, fmt.Errorf("invalid request body")
+	}
+
+	previous, err := ca.email(ctx, body["accessToken"])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ca.identityProviderClient.VerifyUserAttribute(ctx, &cognitoidentityprovider.VerifyUserAttributeInput{
+		AccessToken:   aws.String(body["accessToken"]),
+		AttributeName: aws.String("email"),
+		Code:          aws.String(body["code"]),
+	})
+	if err != nil {
+		ca.logger.Error("verify email attribute failed!", zap.Error(err))
+		return nil, codeError(err)
+	}
+
+	current, err := ca.attributes(ctx, body["accessToken"])
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"message":       confirmEmailChangeSuccessMessage,
+		"previousEmail": previous,
+		"email":         current["email"],
+		"userId":        current[UserIDAttribute],
+	}, nil
+}
+
+// Every user in the pool, a page at a time
+func (ca Adapter) ListUsers(ctx context.Context) ([]auth.User, error) {
+	users := []auth.User{}
+	var token *string
+	for {
+		output, err := ca.identityProviderClient.ListUsers(ctx, &cognitoidentityprovider.ListUsersInput{
+			UserPoolId:      aws.String(ca.userPoolID),
+			PaginationToken: token,
+		})
+		if err != nil {
+			ca.logger.Error("list users failed!", zap.Error(err))
+			return nil, err
+		}
+		for _, u := range output.Users {
+			user := auth.User{Confirmed: u.UserStatus == types.UserStatusTypeConfirmed}
+			for _, a := range u.Attributes {
+				switch aws.ToString(a.Name) {
+				case "sub":
+					user.ID = aws.ToString(a.Value)
+				case "email":
+					user.Email = aws.ToString(a.Value)
+				case UserIDAttribute:
+					user.UserID = aws.ToString(a.Value)
+				}
+			}
+			users = append(users, user)
+		}
+		if aws.ToString(output.PaginationToken) == "" {
+			return users, nil
+		}
+		token = output.PaginationToken
+	}
+}
+
+/*
+Holds the ID of the user's bk-user-api record. The app client can't write it, so it can be trusted once it's in a
+token. It's kept on the Cognito user because the user API client can't look records up by email.
+*/
+const UserIDAttribute = "custom:user_id"
+
+// The ID of the user's bk-user-api record, or "" if one hasn't been created for them yet
+func (ca Adapter) UserID(ctx context.Context, email string) (string, error) {
+	output, err := ca.identityProviderClient.AdminGetUser(ctx, &cognitoidentityprovider.AdminGetUserInput{
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(email),
+	})
+	if err != nil {
+		ca.logger.Error("admin get user failed!", zap.Error(err))
+		return "", err
+	}
+	for _, a := range output.UserAttributes {
+		if aws.ToString(a.Name) == UserIDAttribute {
+			return aws.ToString(a.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// Records the ID of the bk-user-api record created for the user
+func (ca Adapter) SetUserID(ctx context.Context, email string, id string) error {
+	_, err := ca.identityProviderClient.AdminUpdateUserAttributes(ctx, &cognitoidentityprovider.AdminUpdateUserAttributesInput{
+		UserPoolId: aws.String(ca.userPoolID),
+		Username:   aws.String(email),
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String(UserIDAttribute), Value: aws.String(id)},
+		},
+	})
+	if err != nil {
+		ca.logger.Error("admin update user attributes failed!", zap.Error(err))
+	}
+	return err
+}
+
+// Returns the current email attribute of the user the access token belongs to
+func (ca Adapter) email(ctx context.Context, accessToken string) (string, error) {
+	attrs, err := ca.attributes(ctx, accessToken)
+	if err != nil {
+		return "", err
+	}
+	if attrs["email"] == "" {
+		return "", fmt.Errorf("user has no email attribute")
+	}
+	return attrs["email"], nil
+}
+
+// Returns the attributes of the user the access token belongs to, by name
+func (ca Adapter) attributes(ctx context.Context, accessToken string) (map[string]string, error) {
+	output, err := ca.identityProviderClient.GetUser(ctx, &cognitoidentityprovider.GetUserInput{
+		AccessToken: aws.String(accessToken),
+	})
+	if err != nil {
+		ca.logger.Error("get user failed!", zap.Error(err))
+		return nil, err
+	}
+	attrs := map[string]string{}
+	for _, a := range output.UserAttributes {
+		attrs[aws.ToString(a.Name)] = aws.ToString(a.Value)
+	}
+	return attrs, nil
+}
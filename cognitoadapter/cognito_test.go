@@ -2,25 +2,61 @@ package cognito
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type MockCognitoClient struct {
-	isError bool
+	isError             bool
+	newPasswordRequired bool
+	// Returned by InitiateAuth in place of tokens
+	challenge types.ChallengeNameType
+	// InitiateAuth answers with neither tokens nor a challenge
+	noResult bool
+	// Counts GetUser calls, so that the email can appear to change once verified
+	getUserCalls *int
 }
 
 var mockToken = "mockToken"
+var mockSession = "mockSession"
 
 func (ma MockCognitoClient) InitiateAuth(ctx context.Context, params *cognitoidentityprovider.InitiateAuthInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.InitiateAuthOutput, error) {
 	if ma.isError {
 		return nil, fmt.Errorf("IntitiateAuth error")
 	}
+	if ma.newPasswordRequired {
+		return &cognitoidentityprovider.InitiateAuthOutput{
+			ChallengeName: types.ChallengeNameTypeNewPasswordRequired,
+			Session:       &mockSession,
+		}, nil
+	}
+	if ma.challenge != "" {
+		return &cognitoidentityprovider.InitiateAuthOutput{
+			ChallengeName: ma.challenge,
+			Session:       &mockSession,
+		}, nil
+	}
+	if ma.noResult {
+		return &cognitoidentityprovider.InitiateAuthOutput{}, nil
+	}
+	if params.AuthFlow == types.AuthFlowTypeRefreshTokenAuth {
+		return &cognitoidentityprovider.InitiateAuthOutput{
+			AuthenticationResult: &types.AuthenticationResultType{
+				AccessToken: &mockToken,
+				ExpiresIn:   3600,
+			},
+		}, nil
+	}
 	return &cognitoidentityprovider.InitiateAuthOutput{
 		AuthenticationResult: &types.AuthenticationResultType{
 			AccessToken: &mockToken,
@@ -32,6 +68,11 @@ func (ma MockCognitoClient) SignUp(ctx context.Context, params *cognitoidentityp
 	if ma.isError {
 		return nil, fmt.Errorf("SignUp error")
 	}
+	if params.Username != nil && *params.Username == "abc@mailinator.com" {
+		return nil, &types.UserLambdaValidationException{
+			Message: aws.String("PreSignUp failed with error DISPOSABLE_EMAIL: Disposable email addresses are not allowed."),
+		}
+	}
 	return &cognitoidentityprovider.SignUpOutput{}, nil
 }
 
@@ -49,15 +90,187 @@ func (ma MockCognitoClient) AdminDeleteUser(ctx context.Context, params *cognito
 	return &cognitoidentityprovider.AdminDeleteUserOutput{}, nil
 }
 
+func (ma MockCognitoClient) AdminCreateUser(ctx context.Context, params *cognitoidentityprovider.AdminCreateUserInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminCreateUserOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminCreateUser error")
+	}
+	return &cognitoidentityprovider.AdminCreateUserOutput{
+		User: &types.UserType{
+			Username:   params.Username,
+			Attributes: params.UserAttributes,
+		},
+	}, nil
+}
+
+func (ma MockCognitoClient) AdminAddUserToGroup(ctx context.Context, params *cognitoidentityprovider.AdminAddUserToGroupInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminAddUserToGroupOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminAddUserToGroup error")
+	}
+	return &cognitoidentityprovider.AdminAddUserToGroupOutput{}, nil
+}
+
+func (ma MockCognitoClient) AdminRemoveUserFromGroup(ctx context.Context, params *cognitoidentityprovider.AdminRemoveUserFromGroupInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminRemoveUserFromGroupOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminRemoveUserFromGroup error")
+	}
+	return &cognitoidentityprovider.AdminRemoveUserFromGroupOutput{}, nil
+}
+
+var mockGroups = []string{"admin", "member"}
+
+func (ma MockCognitoClient) AdminListGroupsForUser(ctx context.Context, params *cognitoidentityprovider.AdminListGroupsForUserInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminListGroupsForUserOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminListGroupsForUser error")
+	}
+	// Serve one group per page to exercise pagination
+	i := 0
+	if params.NextToken != nil {
+		fmt.Sscan(*params.NextToken, &i)
+	}
+	o := &cognitoidentityprovider.AdminListGroupsForUserOutput{
+		Groups: []types.GroupType{{GroupName: &mockGroups[i]}},
+	}
+	if i+1 < len(mockGroups) {
+		o.NextToken = aws.String(fmt.Sprint(i + 1))
+	}
+	return o, nil
+}
+
+func (ma MockCognitoClient) UpdateUserAttributes(ctx context.Context, params *cognitoidentityprovider.UpdateUserAttributesInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.UpdateUserAttributesOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("UpdateUserAttributes error")
+	}
+	return &cognitoidentityprovider.UpdateUserAttributesOutput{}, nil
+}
+
+var mockEmails = []string{"abc@gmail.com", "def@gmail.com"}
+
+func (ma MockCognitoClient) GetUser(ctx context.Context, params *cognitoidentityprovider.GetUserInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.GetUserOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("GetUser error")
+	}
+	e := mockEmails[0]
+	if ma.getUserCalls != nil {
+		e = mockEmails[min(*ma.getUserCalls, len(mockEmails)-1)]
+		*ma.getUserCalls++
+	}
+	return &cognitoidentityprovider.GetUserOutput{
+		UserAttributes: []types.AttributeType{
+			{Name: aws.String("sub"), Value: aws.String("mockSub")},
+			{Name: aws.String("email"), Value: aws.String(e)},
+			{Name: aws.String(UserIDAttribute), Value: aws.String("mockUserID")},
+		},
+	}, nil
+}
+
+func (ma MockCognitoClient) VerifyUserAttribute(ctx context.Context, params *cognitoidentityprovider.VerifyUserAttributeInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.VerifyUserAttributeOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("VerifyUserAttribute error")
+	}
+	if aws.ToString(params.Code) == "000000" {
+		return nil, &types.ExpiredCodeException{Message: aws.String("Invalid code provided, please request a code again.")}
+	}
+	return &cognitoidentityprovider.VerifyUserAttributeOutput{}, nil
+}
+
+func (ma MockCognitoClient) RespondToAuthChallenge(ctx context.Context, params *cognitoidentityprovider.RespondToAuthChallengeInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.RespondToAuthChallengeOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("RespondToAuthChallenge error")
+	}
+	return &cognitoidentityprovider.RespondToAuthChallengeOutput{
+		AuthenticationResult: &types.AuthenticationResultType{
+			AccessToken: &mockToken,
+		},
+	}, nil
+}
+
+func (ma MockCognitoClient) ForgotPassword(ctx context.Context, params *cognitoidentityprovider.ForgotPasswordInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ForgotPasswordOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("ForgotPassword error")
+	}
+	if aws.ToString(params.Username) == "unknown@gmail.com" {
+		return nil, &types.UserNotFoundException{Message: aws.String("Username/client id combination not found.")}
+	}
+	return &cognitoidentityprovider.ForgotPasswordOutput{}, nil
+}
+
+func (ma MockCognitoClient) ConfirmForgotPassword(ctx context.Context, params *cognitoidentityprovider.ConfirmForgotPasswordInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ConfirmForgotPasswordOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("ConfirmForgotPassword error")
+	}
+	if aws.ToString(params.ConfirmationCode) == "000000" {
+		return nil, &types.CodeMismatchException{Message: aws.String("Invalid verification code provided, please try again.")}
+	}
+	return &cognitoidentityprovider.ConfirmForgotPasswordOutput{}, nil
+}
+
+func (ma MockCognitoClient) ChangePassword(ctx context.Context, params *cognitoidentityprovider.ChangePasswordInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ChangePasswordOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("ChangePassword error")
+	}
+	if aws.ToString(params.PreviousPassword) == "wrong" {
+		return nil, &types.NotAuthorizedException{Message: aws.String("Incorrect username or password.")}
+	}
+	return &cognitoidentityprovider.ChangePasswordOutput{}, nil
+}
+
+// Two pages, the second of which has a user who hasn't confirmed their sign up
+func (ma MockCognitoClient) ListUsers(ctx context.Context, params *cognitoidentityprovider.ListUsersInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.ListUsersOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("ListUsers error")
+	}
+	user := func(sub string, email string, status types.UserStatusType) types.UserType {
+		u := types.UserType{UserStatus: status, Attributes: []types.AttributeType{
+			{Name: aws.String("sub"), Value: aws.String(sub)},
+			{Name: aws.String("email"), Value: aws.String(email)},
+		}}
+		if status == types.UserStatusTypeConfirmed {
+			u.Attributes = append(u.Attributes, types.AttributeType{Name: aws.String(UserIDAttribute), Value: aws.String("mockUserID")})
+		}
+		return u
+	}
+	if params.PaginationToken == nil {
+		return &cognitoidentityprovider.ListUsersOutput{
+			Users:           []types.UserType{user("mockSub1", mockEmails[0], types.UserStatusTypeConfirmed)},
+			PaginationToken: aws.String("page2"),
+		}, nil
+	}
+	return &cognitoidentityprovider.ListUsersOutput{
+		Users: []types.UserType{user("mockSub2", mockEmails[1], types.UserStatusTypeUnconfirmed)},
+	}, nil
+}
+
+// Only the first of the mock emails has a bk-user-api record
+func (ma MockCognitoClient) AdminGetUser(ctx context.Context, params *cognitoidentityprovider.AdminGetUserInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminGetUserOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminGetUser error")
+	}
+	attrs := []types.AttributeType{{Name: aws.String("email"), Value: params.Username}}
+	if aws.ToString(params.Username) == mockEmails[0] {
+		attrs = append(attrs, types.AttributeType{Name: aws.String(UserIDAttribute), Value: aws.String("mockUserID")})
+	}
+	return &cognitoidentityprovider.AdminGetUserOutput{UserAttributes: attrs}, nil
+}
+
+func (ma MockCognitoClient) AdminUpdateUserAttributes(ctx context.Context, params *cognitoidentityprovider.AdminUpdateUserAttributesInput, optFns ...func(*cognitoidentityprovider.Options)) (*cognitoidentityprovider.AdminUpdateUserAttributesOutput, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("AdminUpdateUserAttributes error")
+	}
+	return &cognitoidentityprovider.AdminUpdateUserAttributesOutput{}, nil
+}
+
 /*
 Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
 */
 func TestSignIn(t *testing.T) {
 	type test struct {
-		Name             string
-		RequestBody      map[string]string
-		ExpectedError    bool
-		ExpectedResponse map[string]string
+		Name                string
+		RequestBody         map[string]string
+		ExpectedError       bool
+		NewPasswordRequired bool
+		Challenge           types.ChallengeNameType
+		NoResult            bool
+		ExpectedResponse    map[string]string
 	}
 
 	tests := []test{
@@ -72,6 +285,42 @@ func TestSignIn(t *testing.T) {
 				"token":   mockToken,
 			},
 		},
+		{
+			Name: "Sign in new password required",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"password": "TempPassword1",
+			},
+			NewPasswordRequired: true,
+			ExpectedResponse: map[string]string{
+				"challenge": "NEW_PASSWORD_REQUIRED",
+				"session":   mockSession,
+				"message":   newPasswordRequiredMessage,
+			},
+		},
+		{
+			Name: "Sign in MFA challenge",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"password": "password",
+			},
+			Challenge: types.ChallengeNameTypeSoftwareTokenMfa,
+			ExpectedResponse: map[string]string{
+				"challenge": "SOFTWARE_TOKEN_MFA",
+				"session":   mockSession,
+				"message":   challengeMessage,
+			},
+		},
+		{
+			Name: "Sign in without tokens or a challenge",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"password": "password",
+			},
+			NoResult:         true,
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
 		{
 			Name: "Sign in cognito client error",
 			RequestBody: map[string]string{
@@ -97,7 +346,10 @@ func TestSignIn(t *testing.T) {
 			}
 
 			m := MockCognitoClient{
-				isError: tt.ExpectedError,
+				isError:             tt.ExpectedError && !tt.NoResult,
+				newPasswordRequired: tt.NewPasswordRequired,
+				challenge:           tt.Challenge,
+				noResult:            tt.NoResult,
 			}
 
 			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
@@ -105,10 +357,13 @@ func TestSignIn(t *testing.T) {
 				t.Fatalf("Failed to initialise handler")
 			}
 
-			r, err := ca.SignIn(tt.RequestBody)
+			r, err := ca.SignIn(context.Background(), tt.RequestBody)
 			if err != nil && !tt.ExpectedError {
 				t.Fatalf("Unexpected handler error %v", err)
 			}
+			if err == nil && tt.ExpectedError {
+				t.Fatalf("Expected an error")
+			}
 			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
 				t.Fatalf("Unexpected response %v", r)
 			}
@@ -135,6 +390,40 @@ func TestSignUp(t *testing.T) {
 				"message": signUpSuccessMessage,
 			},
 		},
+		{
+			Name: "Sign up with attributes success",
+			RequestBody: map[string]string{
+				"email":            "abc@gmail.com",
+				"password":         "password",
+				"name":             "Abc Def",
+				"locale":           "en-GB",
+				"marketingConsent": "false",
+				"tenant":           "bk",
+			},
+			ExpectedResponse: map[string]string{
+				"message": signUpSuccessMessage,
+			},
+		},
+		{
+			Name: "Sign up invalid attribute error",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"password": "password",
+				"locale":   "english",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Sign up privileged attribute error",
+			RequestBody: map[string]string{
+				"email":          "abc@gmail.com",
+				"password":       "password",
+				"email_verified": "true",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
 		{
 			Name: "Sign up cognito client error",
 			RequestBody: map[string]string{
@@ -168,7 +457,7 @@ func TestSignUp(t *testing.T) {
 				t.Fatalf("Failed to initialise handler")
 			}
 
-			r, err := ca.SignUp(tt.RequestBody)
+			r, err := ca.SignUp(context.Background(), tt.RequestBody)
 			if err != nil && !tt.ExpectedError {
 				t.Fatalf("Unexpected handler error %v", err)
 			}
@@ -231,7 +520,7 @@ func TestVerifyEmail(t *testing.T) {
 				t.Fatalf("Failed to initialise handler")
 			}
 
-			r, err := ca.VerifyEmail(tt.RequestBody)
+			r, err := ca.VerifyEmail(context.Background(), tt.RequestBody)
 			if err != nil && !tt.ExpectedError {
 				t.Fatalf("Unexpected handler error %v", err)
 			}
@@ -292,7 +581,139 @@ func TestAdminDelete(t *testing.T) {
 				t.Fatalf("Failed to initialise handler")
 			}
 
-			r, err := ca.AdminDelete(tt.RequestBody)
+			r, err := ca.AdminDelete(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestAdminInvite(t *testing.T) {
+	type test struct {
+		Name                      string
+		RequestBody               map[string]string
+		ExpectedError             bool
+		ExpectedTemporaryPassword bool
+		ExpectedMessage           string
+	}
+
+	tests := []test{
+		{
+			Name: "Admin invite with temporary password success",
+			RequestBody: map[string]string{
+				"email":             "abc@gmail.com",
+				"temporaryPassword": "TempPassword1",
+			},
+			ExpectedMessage: adminInviteSuccessMessage,
+		},
+		{
+			Name: "Admin invite suppressed message success",
+			RequestBody: map[string]string{
+				"email": "abc@gmail.com",
+			},
+			ExpectedTemporaryPassword: true,
+			ExpectedMessage:           adminInviteSuccessMessage,
+		},
+		{
+			Name: "Admin invite cognito client error",
+			RequestBody: map[string]string{
+				"email": "abc@gmail.com",
+			},
+			ExpectedError: true,
+		},
+		{
+			Name:          "Admin invite invalid request body error",
+			RequestBody:   map[string]string{},
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.AdminInvite(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if r["message"] != tt.ExpectedMessage {
+				t.Fatalf("Unexpected response %v", r)
+			}
+			if _, ok := r["temporaryPassword"]; ok != tt.ExpectedTemporaryPassword {
+				t.Fatalf("Unexpected temporary password in response %v", r)
+			}
+		})
+	}
+}
+
+func TestCompleteNewPassword(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Complete new password success",
+			RequestBody: map[string]string{
+				"email":       "abc@gmail.com",
+				"newPassword": "Password123",
+				"session":     mockSession,
+			},
+			ExpectedResponse: map[string]string{
+				"message": signInSuccessMessage,
+				"token":   mockToken,
+			},
+		},
+		{
+			Name: "Complete new password cognito client error",
+			RequestBody: map[string]string{
+				"email":       "abc@gmail.com",
+				"newPassword": "Password123",
+				"session":     mockSession,
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Complete new password invalid request body error",
+			RequestBody: map[string]string{
+				"email": "abc@gmail.com",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.CompleteNewPassword(context.Background(), tt.RequestBody)
 			if err != nil && !tt.ExpectedError {
 				t.Fatalf("Unexpected handler error %v", err)
 			}
@@ -302,3 +723,715 @@ func TestAdminDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestRefresh(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Refresh success",
+			RequestBody: map[string]string{
+				"refreshToken": "mockRefreshToken",
+			},
+			ExpectedResponse: map[string]string{
+				"message":   signInSuccessMessage,
+				"token":     mockToken,
+				"expiresIn": "3600",
+			},
+		},
+		{
+			Name: "Refresh cognito client error",
+			RequestBody: map[string]string{
+				"refreshToken": "mockRefreshToken",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name:             "Refresh invalid request body error",
+			RequestBody:      map[string]string{},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.Refresh(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	type test struct {
+		Name             string
+		Method           func(Adapter) auth.AdapterHandler
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	add := func(ca Adapter) auth.AdapterHandler { return ca.AddUserToGroup }
+	remove := func(ca Adapter) auth.AdapterHandler { return ca.RemoveUserFromGroup }
+	list := func(ca Adapter) auth.AdapterHandler { return ca.ListGroupsForUser }
+
+	tests := []test{
+		{
+			Name:             "Add user to group success",
+			Method:           add,
+			RequestBody:      map[string]string{"email": "abc@gmail.com", "group": "admin"},
+			ExpectedResponse: map[string]string{"message": addUserToGroupSuccessMessage},
+		},
+		{
+			Name:          "Add user to group cognito client error",
+			Method:        add,
+			RequestBody:   map[string]string{"email": "abc@gmail.com", "group": "admin"},
+			ExpectedError: true,
+		},
+		{
+			Name:          "Add user to group invalid request body error",
+			Method:        add,
+			RequestBody:   map[string]string{"email": "abc@gmail.com"},
+			ExpectedError: true,
+		},
+		{
+			Name:             "Remove user from group success",
+			Method:           remove,
+			RequestBody:      map[string]string{"email": "abc@gmail.com", "group": "admin"},
+			ExpectedResponse: map[string]string{"message": removeUserFromGroupSuccessMessage},
+		},
+		{
+			Name:          "Remove user from group cognito client error",
+			Method:        remove,
+			RequestBody:   map[string]string{"email": "abc@gmail.com", "group": "admin"},
+			ExpectedError: true,
+		},
+		{
+			Name:             "List groups for user success",
+			Method:           list,
+			RequestBody:      map[string]string{"email": "abc@gmail.com"},
+			ExpectedResponse: map[string]string{"groups": "admin,member"},
+		},
+		{
+			Name:          "List groups for user cognito client error",
+			Method:        list,
+			RequestBody:   map[string]string{"email": "abc@gmail.com"},
+			ExpectedError: true,
+		},
+		{
+			Name:          "List groups for user invalid request body error",
+			Method:        list,
+			RequestBody:   map[string]string{},
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := tt.Method(ca)(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestUpdateAttributes(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ClientError      bool
+		ExpectedError    error
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Update attributes success",
+			RequestBody: map[string]string{
+				"accessToken":      mockToken,
+				"locale":           "fr",
+				"marketingConsent": "true",
+			},
+			ExpectedResponse: map[string]string{
+				"message": updateAttributesSuccessMessage,
+			},
+		},
+		{
+			Name: "Update immutable attribute error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"tenant":      "other",
+			},
+			ExpectedError: auth.ErrInvalidRequest,
+		},
+		{
+			Name: "Update invalid attribute value error",
+			RequestBody: map[string]string{
+				"accessToken":      mockToken,
+				"marketingConsent": "yes",
+			},
+			ExpectedError: auth.ErrInvalidRequest,
+		},
+		{
+			Name: "Update no attributes error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+			},
+			ExpectedError: auth.ErrInvalidRequest,
+		},
+		{
+			Name: "Update attributes cognito client error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"name":        "Abc",
+			},
+			ClientError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ClientError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.UpdateAttributes(context.Background(), tt.RequestBody)
+			if tt.ExpectedError != nil && !errors.Is(err, tt.ExpectedError) {
+				t.Fatalf("Expected error %v, got %v", tt.ExpectedError, err)
+			}
+			if err != nil && tt.ExpectedError == nil && !tt.ClientError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Change email success",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"email":       "def@gmail.com",
+			},
+			ExpectedResponse: map[string]string{
+				"message": changeEmailSuccessMessage,
+			},
+		},
+		{
+			Name: "Change email cognito client error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"email":       "def@gmail.com",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Change email invalid request body error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.ChangeEmail(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Confirm email change success",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"code":        "123456",
+			},
+			ExpectedResponse: map[string]string{
+				"message":       confirmEmailChangeSuccessMessage,
+				"previousEmail": "abc@gmail.com",
+				"email":         "def@gmail.com",
+				"userId":        "mockUserID",
+			},
+		},
+		{
+			Name: "Confirm email change cognito client error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"code":        "123456",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Confirm email change invalid request body error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			calls := 0
+			m := MockCognitoClient{
+				isError:      tt.ExpectedError,
+				getUserCalls: &calls,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.ConfirmEmailChange(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestConfirmEmailChangeExpiredCode(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+	_, err = ca.ConfirmEmailChange(context.Background(), map[string]string{
+		"accessToken": mockToken,
+		"code":        "000000",
+	})
+
+	var re auth.RequestError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected request error, got %v", err)
+	}
+	if re.Code != auth.ErrCodeInvalidCode {
+		t.Fatalf("Unexpected error code %v", re.Code)
+	}
+}
+
+func TestSignUpTriggerRejection(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+
+	_, err = ca.SignUp(context.Background(), map[string]string{
+		"email":    "abc@mailinator.com",
+		"password": "password",
+	})
+
+	var re auth.RequestError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected request error, got %v", err)
+	}
+	if re.Code != auth.ErrCodeDisposableEmail {
+		t.Fatalf("Unexpected error code %v", re.Code)
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name:        "Forgot password success",
+			RequestBody: map[string]string{"email": "abc@gmail.com"},
+			ExpectedResponse: map[string]string{
+				"message": forgotPasswordSuccessMessage,
+			},
+		},
+		{
+			Name:             "Forgot password cognito client error",
+			RequestBody:      map[string]string{"email": "abc@gmail.com"},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name:             "Forgot password invalid request body error",
+			RequestBody:      map[string]string{},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.ForgotPassword(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+// Unknown users look the same as known ones
+func TestForgotPasswordUnknownUser(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+
+	r, err := ca.ForgotPassword(context.Background(), map[string]string{"email": "unknown@gmail.com"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if r["message"] != forgotPasswordSuccessMessage {
+		t.Fatalf("Unexpected response %v", r)
+	}
+}
+
+func TestConfirmForgotPassword(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Confirm forgot password success",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"code":     "123456",
+				"password": "Password123",
+			},
+			ExpectedResponse: map[string]string{
+				"message": resetPasswordSuccessMessage,
+			},
+		},
+		{
+			Name: "Confirm forgot password cognito client error",
+			RequestBody: map[string]string{
+				"email":    "abc@gmail.com",
+				"code":     "123456",
+				"password": "Password123",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Confirm forgot password invalid request body error",
+			RequestBody: map[string]string{
+				"email": "abc@gmail.com",
+				"code":  "123456",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.ConfirmForgotPassword(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestConfirmForgotPasswordCodeMismatch(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+
+	_, err = ca.ConfirmForgotPassword(context.Background(), map[string]string{
+		"email":    "abc@gmail.com",
+		"code":     "000000",
+		"password": "Password123",
+	})
+
+	var re auth.RequestError
+	if !errors.As(err, &re) {
+		t.Fatalf("Expected request error, got %v", err)
+	}
+	if re.Code != auth.ErrCodeInvalidCode {
+		t.Fatalf("Unexpected error code %v", re.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	type test struct {
+		Name             string
+		RequestBody      map[string]string
+		ExpectedError    bool
+		ExpectedResponse map[string]string
+	}
+
+	tests := []test{
+		{
+			Name: "Change password success",
+			RequestBody: map[string]string{
+				"accessToken":      mockToken,
+				"previousPassword": "Password123",
+				"password":         "Password456",
+			},
+			ExpectedResponse: map[string]string{
+				"message": changePasswordSuccessMessage,
+				"email":   mockEmails[0],
+			},
+		},
+		{
+			Name: "Change password cognito client error",
+			RequestBody: map[string]string{
+				"accessToken":      mockToken,
+				"previousPassword": "Password123",
+				"password":         "Password456",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+		{
+			Name: "Change password invalid request body error",
+			RequestBody: map[string]string{
+				"accessToken": mockToken,
+				"password":    "Password456",
+			},
+			ExpectedError:    true,
+			ExpectedResponse: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockCognitoClient{
+				isError: tt.ExpectedError,
+			}
+
+			ca := NewAdapter(m, "MockClientId", "mockPoolID", l)
+
+			r, err := ca.ChangePassword(context.Background(), tt.RequestBody)
+			if err != nil && !tt.ExpectedError {
+				t.Fatalf("Unexpected handler error %v", err)
+			}
+			if !reflect.DeepEqual(r, tt.ExpectedResponse) {
+				t.Fatalf("Unexpected response %v", r)
+			}
+		})
+	}
+}
+
+func TestChangePasswordWrongPreviousPassword(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+
+	_, err = ca.ChangePassword(context.Background(), map[string]string{
+		"accessToken":      mockToken,
+		"previousPassword": "wrong",
+		"password":         "Password456",
+	})
+	if !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("Expected invalid token error, got %v", err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+	users, err := ca.ListUsers(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []auth.User{
+		{ID: "mockSub1", Email: mockEmails[0], Confirmed: true, UserID: "mockUserID"},
+		{ID: "mockSub2", Email: mockEmails[1], Confirmed: false},
+	}, users)
+
+	ca = NewAdapter(MockCognitoClient{isError: true}, "MockClientId", "mockPoolID", l)
+	_, err = ca.ListUsers(context.Background())
+	assert.Error(t, err)
+}
+
+func TestUserID(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", l)
+	id, err := ca.UserID(context.Background(), mockEmails[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "mockUserID", id)
+
+	// No record yet
+	id, err = ca.UserID(context.Background(), mockEmails[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "", id)
+	assert.NoError(t, ca.SetUserID(context.Background(), mockEmails[1], "mockUserID2"))
+
+	ca = NewAdapter(MockCognitoClient{isError: true}, "MockClientId", "mockPoolID", l)
+	_, err = ca.UserID(context.Background(), mockEmails[0])
+	assert.Error(t, err)
+	assert.Error(t, ca.SetUserID(context.Background(), mockEmails[1], "mockUserID2"))
+}
+
+// Nothing the adapter logs should contain tokens, passwords, codes or email addresses
+func TestLogsRedacted(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	ca := NewAdapter(MockCognitoClient{}, "MockClientId", "mockPoolID", zap.New(core))
+
+	_, err := ca.SignIn(context.Background(), map[string]string{"email": "abc@gmail.com", "password": "Abcabc123"})
+	assert.NoError(t, err)
+	_, err = ca.SignUp(context.Background(), map[string]string{"email": "abc@gmail.com", "password": "Abcabc123"})
+	assert.NoError(t, err)
+	_, err = ca.VerifyEmail(context.Background(), map[string]string{"email": "abc@gmail.com", "code": "123456"})
+	assert.NoError(t, err)
+	_, err = ca.AdminInvite(context.Background(), map[string]string{"email": "abc@gmail.com", "temporaryPassword": "Abcabc123"})
+	assert.NoError(t, err)
+	_, err = ca.ChangeEmail(context.Background(), map[string]string{"accessToken": mockToken, "email": "def@gmail.com"})
+	assert.NoError(t, err)
+
+	assert.NotZero(t, logs.Len())
+	for _, e := range logs.All() {
+		out := e.Message + fmt.Sprint(e.ContextMap())
+		for _, s := range []string{mockToken, "abc@gmail.com", "def@gmail.com", "Abcabc123", "123456"} {
+			assert.NotContains(t, out, s)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cognito
+
+import (
+	"crypto/rand"
+	"math/big"
+)
+
+const (
+	lowerChars = "abcdefghijkmnopqrstuvwxyz"
+	upperChars = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	digitChars = "23456789"
+
+	temporaryPasswordLength = 16
+)
+
+// Generates a random password that satisfies the user pool's password policy (see cdk/cdk.go)
+func temporaryPassword() (string, error) {
+	all := lowerChars + upperChars + digitChars
+	// Guarantee one of each required character class, then fill the rest from the full set
+	sets := []string{lowerChars, upperChars, digitChars}
+	for len(sets) < temporaryPasswordLength {
+		sets = append(sets, all)
+	}
+
+	p := make([]byte, len(sets))
+	for i, set := range sets {
+		c, err := randomChar(set)
+		if err != nil {
+			return "", err
+		}
+		p[i] = c
+	}
+
+	// Shuffle so the guaranteed characters aren't always at the start
+	for i := len(p) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		p[i], p[j.Int64()] = p[j.Int64()], p[i]
+	}
+
+	return string(p), nil
+}
+
+func randomChar(set string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+	if err != nil {
+		return 0, err
+	}
+	return set[n.Int64()], nil
+}
@@ -0,0 +1,115 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+const (
+	SpecVersion = "1.0"
+	Source      = "bk-auth-api"
+)
+
+/*
+Event types, versioned so that a breaking change to the data can be published alongside the old version while
+consumers move over
+*/
+const (
+	TypeUserSignedUp    = "com.benjaminkitson.auth.UserSignedUp.v1"
+	TypeUserVerified    = "com.benjaminkitson.auth.UserVerified.v1"
+	TypeUserDeleted     = "com.benjaminkitson.auth.UserDeleted.v1"
+	TypePasswordChanged = "com.benjaminkitson.auth.PasswordChanged.v1"
+	TypeEmailChanged    = "com.benjaminkitson.auth.EmailChanged.v1"
+)
+
+// A CloudEvents 1.0 event in the structured JSON format
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// The data of every user event. UserID is the bk-user-api ID, which new users don't have until they're verified
+type UserData struct {
+	Email  string `json:"email"`
+	UserID string `json:"userId,omitempty"`
+}
+
+// How a password was changed
+const (
+	PasswordChangedByUser  = "change"
+	PasswordChangedByReset = "reset"
+)
+
+type PasswordChangedData struct {
+	Email  string `json:"email"`
+	Method string `json:"method"`
+}
+
+/*
+Published whenever a change is confirmed, even one that's already been published, so consumers should set the email
+on the user with UserID rather than look for PreviousEmail
+*/
+type EmailChangedData struct {
+	Email         string `json:"email"`
+	PreviousEmail string `json:"previousEmail"`
+	UserID        string `json:"userId,omitempty"`
+}
+
+func New(eventType string, subject string, data interface{}) (Event, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              newID(),
+		Source:          Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Data:            b,
+	}, nil
+}
+
+// The data types below always marshal, so the typed constructors can't fail
+func mustNew(eventType string, subject string, data interface{}) Event {
+	e, _ := New(eventType, subject, data)
+	return e
+}
+
+func UserSignedUp(email string) Event {
+	return mustNew(TypeUserSignedUp, email, UserData{Email: email})
+}
+
+func UserVerified(email string, userID string) Event {
+	return mustNew(TypeUserVerified, email, UserData{Email: email, UserID: userID})
+}
+
+func UserDeleted(email string, userID string) Event {
+	return mustNew(TypeUserDeleted, email, UserData{Email: email, UserID: userID})
+}
+
+func PasswordChanged(email string, method string) Event {
+	return mustNew(TypePasswordChanged, email, PasswordChangedData{Email: email, Method: method})
+}
+
+func EmailChanged(email string, previousEmail string, userID string) Event {
+	return mustNew(TypeEmailChanged, email, EmailChangedData{Email: email, PreviousEmail: previousEmail, UserID: userID})
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
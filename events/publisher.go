@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event) error
+}
+
+type EventBridgeClient interface {
+	PutEvents(context.Context, *eventbridge.PutEventsInput, ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// The most entries a single PutEvents call accepts
+const maxEventBridgeBatch = 10
+
+/*
+Puts events on an EventBridge bus. The whole CloudEvent is the detail, and its type the detail type, so rules can
+match on either.
+*/
+type EventBridgePublisher struct {
+	client EventBridgeClient
+	bus    string
+}
+
+func NewEventBridgePublisher(c EventBridgeClient, bus string) EventBridgePublisher {
+	return EventBridgePublisher{
+		client: c,
+		bus:    bus,
+	}
+}
+
+func (p EventBridgePublisher) Publish(ctx context.Context, events ...Event) error {
+	entries := make([]ebtypes.PutEventsRequestEntry, 0, len(events))
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ebtypes.PutEventsRequestEntry{
+			EventBusName: aws.String(p.bus),
+			Source:       aws.String(e.Source),
+			DetailType:   aws.String(e.Type),
+			Detail:       aws.String(string(b)),
+			Time:         aws.Time(e.Time),
+		})
+	}
+
+	for len(entries) > 0 {
+		n := min(len(entries), maxEventBridgeBatch)
+		output, err := p.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries[:n]})
+		if err != nil {
+			return err
+		}
+		if output.FailedEntryCount > 0 {
+			return fmt.Errorf("%d events not put on %s", output.FailedEntryCount, p.bus)
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+type SNSClient interface {
+	Publish(context.Context, *sns.PublishInput, ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// Publishes each event to an SNS topic, with its type as a message attribute for subscription filter policies
+type SNSPublisher struct {
+	client SNSClient
+	topic  string
+}
+
+func NewSNSPublisher(c SNSClient, topicARN string) SNSPublisher {
+	return SNSPublisher{
+		client: c,
+		topic:  topicARN,
+	}
+}
+
+func (p SNSPublisher) Publish(ctx context.Context, events ...Event) error {
+	for _, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = p.client.Publish(ctx, &sns.PublishInput{
+			TopicArn: aws.String(p.topic),
+			Message:  aws.String(string(b)),
+			MessageAttributes: map[string]snstypes.MessageAttributeValue{
+				"type": {DataType: aws.String("String"), StringValue: aws.String(e.Type)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keeps published events in memory, for tests
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, events ...Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, events...)
+	return nil
+}
+
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Event{}, p.events...)
+}
+
+// Drops every event, for when nothing is configured to receive them
+type discard struct{}
+
+func (discard) Publish(context.Context, ...Event) error {
+	return nil
+}
+
+var Discard Publisher = discard{}
+
+/*
+Publishes to the EventBridge bus named by EVENT_BUS_NAME if it's set, or otherwise the SNS topic in EVENT_TOPIC_ARN.
+With neither set, events are discarded.
+*/
+func PublisherFromEnv(ctx context.Context) (Publisher, error) {
+	bus, topic := os.Getenv("EVENT_BUS_NAME"), os.Getenv("EVENT_TOPIC_ARN")
+	if bus == "" && topic == "" {
+		return Discard, nil
+	}
+	sdkConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bus != "" {
+		return NewEventBridgePublisher(eventbridge.NewFromConfig(sdkConfig), bus), nil
+	}
+	return NewSNSPublisher(sns.NewFromConfig(sdkConfig), topic), nil
+}
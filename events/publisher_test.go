@@ -0,0 +1,134 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockEventBridgeClient struct {
+	isError     bool
+	failEntries bool
+	calls       *[]*eventbridge.PutEventsInput
+}
+
+func (m MockEventBridgeClient) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	*m.calls = append(*m.calls, params)
+	if m.isError {
+		return nil, fmt.Errorf("PutEvents error")
+	}
+	if m.failEntries {
+		return &eventbridge.PutEventsOutput{FailedEntryCount: 1}, nil
+	}
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+type MockSNSClient struct {
+	isError bool
+	calls   *[]*sns.PublishInput
+}
+
+func (m MockSNSClient) Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	*m.calls = append(*m.calls, params)
+	if m.isError {
+		return nil, fmt.Errorf("Publish error")
+	}
+	return &sns.PublishOutput{MessageId: aws.String("1")}, nil
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(TypeUserSignedUp, "abc@gmail.com", func() {})
+	assert.Error(t, err)
+}
+
+func TestEvent(t *testing.T) {
+	e := UserVerified("abc@gmail.com", "mockUserID")
+
+	b, err := json.Marshal(e)
+	assert.NoError(t, err)
+
+	// The CloudEvents required attributes
+	m := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "1.0", m["specversion"])
+	assert.NotEmpty(t, m["id"])
+	assert.Equal(t, Source, m["source"])
+	assert.Equal(t, TypeUserVerified, m["type"])
+	assert.Equal(t, "abc@gmail.com", m["subject"])
+	assert.Equal(t, map[string]interface{}{"email": "abc@gmail.com", "userId": "mockUserID"}, m["data"])
+
+	e2 := UserVerified("abc@gmail.com", "mockUserID")
+	assert.NotEqual(t, e.ID, e2.ID)
+}
+
+func TestEventBridgePublisher(t *testing.T) {
+	events := []Event{}
+	for i := 0; i < 11; i++ {
+		events = append(events, UserSignedUp(fmt.Sprintf("%d@gmail.com", i)))
+	}
+
+	calls := []*eventbridge.PutEventsInput{}
+	p := NewEventBridgePublisher(MockEventBridgeClient{calls: &calls}, "users")
+	assert.NoError(t, p.Publish(context.Background(), events...))
+
+	// Split into batches EventBridge accepts
+	assert.Len(t, calls, 2)
+	assert.Len(t, calls[0].Entries, 10)
+	assert.Len(t, calls[1].Entries, 1)
+	entry := calls[0].Entries[0]
+	assert.Equal(t, "users", aws.ToString(entry.EventBusName))
+	assert.Equal(t, Source, aws.ToString(entry.Source))
+	assert.Equal(t, TypeUserSignedUp, aws.ToString(entry.DetailType))
+
+	var detail Event
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(entry.Detail)), &detail))
+	assert.Equal(t, events[0].ID, detail.ID)
+
+	calls = []*eventbridge.PutEventsInput{}
+	p = NewEventBridgePublisher(MockEventBridgeClient{calls: &calls, failEntries: true}, "users")
+	assert.Error(t, p.Publish(context.Background(), events[0]))
+
+	p = NewEventBridgePublisher(MockEventBridgeClient{calls: &calls, isError: true}, "users")
+	assert.Error(t, p.Publish(context.Background(), events[0]))
+}
+
+func TestSNSPublisher(t *testing.T) {
+	e := PasswordChanged("abc@gmail.com", PasswordChangedByReset)
+
+	calls := []*sns.PublishInput{}
+	p := NewSNSPublisher(MockSNSClient{calls: &calls}, "arn:aws:sns:eu-west-2:123456789012:users")
+	assert.NoError(t, p.Publish(context.Background(), e))
+
+	assert.Len(t, calls, 1)
+	assert.Equal(t, "arn:aws:sns:eu-west-2:123456789012:users", aws.ToString(calls[0].TopicArn))
+	assert.Equal(t, TypePasswordChanged, aws.ToString(calls[0].MessageAttributes["type"].StringValue))
+
+	var m Event
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(calls[0].Message)), &m))
+	assert.Equal(t, e.ID, m.ID)
+
+	p = NewSNSPublisher(MockSNSClient{calls: &calls, isError: true}, "arn:aws:sns:eu-west-2:123456789012:users")
+	assert.Error(t, p.Publish(context.Background(), e))
+}
+
+func TestMemoryPublisher(t *testing.T) {
+	p := NewMemoryPublisher()
+	e := UserDeleted("abc@gmail.com", "mockUserID")
+
+	assert.NoError(t, p.Publish(context.Background(), e))
+	assert.Equal(t, []Event{e}, p.Events())
+}
+
+func TestPublisherFromEnv(t *testing.T) {
+	t.Setenv("EVENT_BUS_NAME", "")
+	t.Setenv("EVENT_TOPIC_ARN", "")
+	p, err := PublisherFromEnv(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, Discard, p)
+}
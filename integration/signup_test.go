@@ -19,6 +19,11 @@ import (
 )
 
 func AuthPost(p string, body map[string]string) (models.User, error) {
+	return AuthPostWithToken(p, body, "")
+}
+
+// Admin routes sit behind the Cognito authorizer, which expects an ID token
+func AuthPostWithToken(p string, body map[string]string, idToken string) (models.User, error) {
 	r, err := url.Parse(env.AuthURL)
 	if err != nil {
 		return models.User{}, err
@@ -35,6 +40,11 @@ func AuthPost(p string, body map[string]string) (models.User, error) {
 		return models.User{}, err
 	}
 
+	req.Header.Set("Content-Type", "application/json")
+	if idToken != "" {
+		req.Header.Set("Authorization", idToken)
+	}
+
 	c := http.Client{}
 
 	res, err := c.Do(req)
@@ -129,10 +139,10 @@ func TestSignUp(t *testing.T) {
 			t.Logf("Verified email address for user %v", u.UserID)
 
 			t.Logf("Cleaning up created user...")
-			r, err := AuthPost("admin-delete", map[string]string{
+			r, err := AuthPostWithToken("admin-delete", map[string]string{
 				"id":    u.UserID,
 				"email": u.Email,
-			})
+			}, env.AdminIDToken)
 			if err != nil {
 				t.Log(err.Error())
 			}
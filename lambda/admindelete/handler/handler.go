@@ -3,11 +3,15 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
 	"github.com/benjaminkitson/bk-auth-api/utils/auth"
 	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
 	"go.uber.org/zap"
 )
 
@@ -15,50 +19,82 @@ type UserAPIClient interface {
 	DeleteUser(ctx context.Context, id string) (string, error)
 }
 
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+	"id":    {validation.Required, validation.MaxLength(64)},
+}
+
 type handler struct {
 	delete        auth.AdapterHandler
 	logger        *zap.Logger
+	publisher     userevents.Publisher
 	userAPIClient UserAPIClient
 }
 
-func NewHandler(logger *zap.Logger, d auth.AdapterHandler, c UserAPIClient) (handler, error) {
+func NewHandler(logger *zap.Logger, d auth.AdapterHandler, c UserAPIClient, publisher userevents.Publisher) (handler, error) {
 	return handler{
 		delete:        d,
 		logger:        logger,
+		publisher:     publisher,
 		userAPIClient: c,
 	}, nil
 }
 
-// TODO: understand how different methods are dealt with (post vs get etc)
-// TODO: probably incorporate some sort of request body validation prior to calling cognito or whichever auth provider
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	err := auth.RequireRole(request, auth.RoleAdmin)
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		handler.logger.Error("No verified claims on request")
+		return utils.RESPONSE_401, nil
+	}
+	if err != nil {
+		handler.logger.Error("Caller is not an admin", logging.Email("caller", auth.Caller(request)))
+		return utils.RESPONSE_403, nil
+	}
 
-func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// TODO: Path check? Not sure if needed
 	// handler.logger.Error("invalid path", zap.String("path", request.Path))
 	// return utils.RESPONSE_400, nil
 
 	bodyMap := make(map[string]string)
 
-	err := json.Unmarshal([]byte(request.Body), &bodyMap)
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
 	if err != nil {
 		handler.logger.Error("Error parsing request body", zap.Error(err))
-		return utils.RESPONSE_500, fmt.Errorf("error parsing request body")
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid admin delete request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
 	}
 
 	// TODO: Might want to return more detailed information when these things go wrong? Maybe in some cases
 	// For now we don't actually use the response
-	_, err = handler.delete(bodyMap)
+	_, err = handler.delete(ctx, bodyMap)
 	if err != nil {
 		handler.logger.Error("Error deleting user from auth provider by email", zap.Error(err))
 		return utils.RESPONSE_500, nil
 	}
 
-	id, err := handler.userAPIClient.DeleteUser(context.Background(), bodyMap["id"])
+	id, err := handler.userAPIClient.DeleteUser(ctx, bodyMap["id"])
 	if err != nil {
 		// TODO: Error response doesn't work as expected here
 		handler.logger.Error("Error deleting user record from db", zap.Error(err))
 		return utils.RESPONSE_500, nil
 	}
+
+	if err := handler.publisher.Publish(ctx, userevents.UserDeleted(bodyMap["email"], id)); err != nil {
+		// The user is gone regardless, so this isn't worth failing the request over
+		handler.logger.Error("Failed to publish user deleted event", zap.Error(err))
+	}
+
 	rm := map[string]string{"id": id}
 
 	r, err := json.Marshal(rm)
@@ -3,9 +3,13 @@ package handler
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -14,7 +18,7 @@ type MockAdapter struct {
 	isError bool
 }
 
-func (ma MockAdapter) Delete(body map[string]string) (map[string]string, error) {
+func (ma MockAdapter) Delete(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if ma.isError {
 		return nil, fmt.Errorf("Auth provider error")
 	}
@@ -43,6 +47,7 @@ func TestHandler(t *testing.T) {
 		AdapterError       bool
 		UserAPIClientError bool
 		SecretsGetterError bool
+		Groups             string
 		RequestBody        string
 		RequestPath        string
 		ExpectedStatusCode int
@@ -51,24 +56,47 @@ func TestHandler(t *testing.T) {
 	tests := []test{
 		{
 			Name:               "Verify email success",
-			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			Groups:             "admin",
+			RequestBody:        "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 200,
 		},
+		{
+			Name:               "Verify email malformed body",
+			Groups:             "admin",
+			RequestBody:        "{\"email\": ",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 400,
+		},
 		{
 			Name:               "Verify email auth provider adapter error",
 			AdapterError:       true,
-			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			Groups:             "admin",
+			RequestBody:        "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 500,
 		},
 		{
 			Name:               "Verify email user api client error",
 			UserAPIClientError: true,
-			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			Groups:             "admin",
+			RequestBody:        "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 500,
 		},
+		{
+			Name:               "Caller is not an admin",
+			Groups:             "support",
+			RequestBody:        "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "No verified claims",
+			RequestBody:        "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 401,
+		},
 		// {
 		// 	Name:               "Invalid path supplied",
 		// 	RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"password\"}",
@@ -92,18 +120,65 @@ func TestHandler(t *testing.T) {
 				isError: tt.UserAPIClientError,
 			}
 
-			h, err := NewHandler(l, m.Delete, c)
+			p := userevents.NewMemoryPublisher()
+			h, err := NewHandler(l, m.Delete, c, p)
 			assert.Nil(t, err)
 
 			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
 				// This test should probably fail if the body isn't the correct format?
 				Body: tt.RequestBody,
 			}
+			if tt.Groups != "" {
+				req.RequestContext.Authorizer = map[string]interface{}{
+					"claims": map[string]interface{}{"cognito:groups": tt.Groups, "email": "admin@gmail.com"},
+				}
+			}
 
 			r, err := h.Handle(context.Background(), req)
 			assert.Nil(t, err)
 
 			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+
+			// Only successful requests publish an event
+			if tt.ExpectedStatusCode == 200 {
+				assert.Len(t, p.Events(), 1)
+				assert.Equal(t, userevents.TypeUserDeleted, p.Events()[0].Type)
+			} else {
+				assert.Empty(t, p.Events())
+			}
 		})
 	}
 }
+
+// Deletions are audited with the admin who made them, from the authorizer's claims
+func TestAudit(t *testing.T) {
+	h, err := NewHandler(zap.NewNop(), MockAdapter{}.Delete, MockUserAPIClient{}, userevents.NewMemoryPublisher())
+	assert.Nil(t, err)
+
+	p := filepath.Join(t.TempDir(), "audit.jsonl")
+	recorder := audit.NewRecorder(audit.NewFileSink(p), audit.DefaultQueueSize)
+
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       "{\"id\": \"123\", \"email\": \"abc@gmail.com\"}",
+	}
+	req.RequestContext.Authorizer = map[string]interface{}{
+		"claims": map[string]interface{}{"cognito:groups": "admin", "email": "admin@gmail.com"},
+	}
+
+	r, err := recorder.Wrap(audit.ActionAdminDelete, h.Handle)(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.NoError(t, recorder.Flush(context.Background()))
+
+	events, err := audit.ReadFile(p)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.ActionAdminDelete, events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, logging.HashEmail("admin@gmail.com"), events[0].Actor)
+	assert.Equal(t, logging.HashEmail("abc@gmail.com"), events[0].Subject)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"name":   {validation.Attribute},
+	"locale": {validation.MaxLength(35)},
+}
+
+type handler struct {
+	updateAttributes auth.AdapterHandler
+	logger           *zap.Logger
+	session          utils.SessionConfig
+}
+
+/*
+Lets signed in users update their own profile attributes, authenticated by their access token
+*/
+func NewHandler(logger *zap.Logger, u auth.AdapterHandler, session utils.SessionConfig) (handler, error) {
+	return handler{
+		updateAttributes: u,
+		logger:           logger,
+		session:          session,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	t, err := handler.session.AccessToken(request)
+	if errors.Is(err, utils.ErrCSRF) {
+		handler.logger.Error("Session cookie without a valid CSRF token", zap.Error(err))
+		return utils.RESPONSE_403, nil
+	}
+	if t == "" {
+		handler.logger.Error("No access token supplied")
+		return utils.RESPONSE_401, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid attributes request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+	// The token always comes from the header, never from the body
+	bodyMap["accessToken"] = t
+
+	d, err := handler.updateAttributes(ctx, bodyMap)
+	if errors.Is(err, auth.ErrInvalidRequest) {
+		handler.logger.Error("Invalid attributes", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("attributes error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) UpdateAttributes(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	if _, ok := body["tenant"]; ok {
+		return nil, fmt.Errorf("%w: attribute tenant cannot be set", auth.ErrInvalidRequest)
+	}
+	return map[string]string{
+		"message": "Successfully updated attributes",
+	}, nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		Authorization      string
+		Cookie             string
+		CSRFToken          string
+		RequestBody        string
+		ExpectedStatusCode int
+	}
+
+	tests := []test{
+		{
+			Name:               "Update attributes success",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Update attributes malformed body",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Update privileged attribute",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"tenant\": \"other\"}",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Update attributes no access token",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Update attributes session cookie",
+			Cookie:             "bk_access_token=token; bk_csrf=csrf",
+			CSRFToken:          "csrf",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Update attributes session cookie without CSRF token",
+			Cookie:             "bk_access_token=token; bk_csrf=csrf",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "Update attributes session cookie with wrong CSRF token",
+			Cookie:             "bk_access_token=token; bk_csrf=csrf",
+			CSRFToken:          "other",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "Update attributes auth provider adapter error",
+			AdapterError:       true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"locale\": \"en-GB\"}",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			h, err := NewHandler(l, m.UpdateAttributes, utils.SessionConfig{Cookies: true})
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers: map[string]string{
+					"authorization": tt.Authorization,
+					"Content-Type":  "application/json",
+					"Cookie":        tt.Cookie,
+					"X-CSRF-Token":  tt.CSRFToken,
+				},
+				Body: tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+		})
+	}
+}
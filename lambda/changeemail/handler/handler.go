@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+}
+
+type handler struct {
+	changeEmail auth.AdapterHandler
+	logger      *zap.Logger
+	session     utils.SessionConfig
+}
+
+/*
+Starts an email address change for signed in users, authenticated by their access token. The address isn't changed
+until the code sent to the new address is confirmed through the confirm email handler.
+*/
+func NewHandler(logger *zap.Logger, c auth.AdapterHandler, session utils.SessionConfig) (handler, error) {
+	return handler{
+		changeEmail: c,
+		logger:      logger,
+		session:     session,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	t, err := handler.session.AccessToken(request)
+	if errors.Is(err, utils.ErrCSRF) {
+		handler.logger.Error("Session cookie without a valid CSRF token", zap.Error(err))
+		return utils.RESPONSE_403, nil
+	}
+	if t == "" {
+		handler.logger.Error("No access token supplied")
+		return utils.RESPONSE_401, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid change email request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+	bodyMap["accessToken"] = t
+
+	d, err := handler.changeEmail(ctx, bodyMap)
+	var re auth.RequestError
+	if errors.As(err, &re) {
+		handler.logger.Error("Email change rejected", zap.String("code", re.Code))
+		return utils.RESPONSE_ERROR(400, re.Code, re.Message), nil
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("change email error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
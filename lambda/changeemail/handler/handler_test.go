@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) ChangeEmail(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{
+		"message": "Verification code sent to new email address",
+	}, nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		Authorization      string
+		RequestBody        string
+		ExpectedStatusCode int
+	}
+
+	tests := []test{
+		{
+			Name:               "Change email success",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"email\": \"def@gmail.com\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Change email malformed body",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Change email no access token",
+			RequestBody:        "{\"email\": \"def@gmail.com\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Change email auth provider adapter error",
+			AdapterError:       true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"email\": \"def@gmail.com\"}",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			h, err := NewHandler(l, m.ChangeEmail, utils.SessionConfig{})
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Authorization": tt.Authorization, "Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+		})
+	}
+}
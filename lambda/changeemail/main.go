@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/benjaminkitson/bk-auth-api/lambda/changeemail/handler"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+	}
+	session := utils.SessionConfigFromEnv()
+
+	start.API(string(audit.ActionEmailChange), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		h, err := handler.NewHandler(inv.Logger, ca.ChangeEmail, session)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+type PasswordChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error)
+	Reset(ctx context.Context, keys ...ratelimit.Key) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"previousPassword": {validation.Required, validation.ExistingPassword},
+	"password":         {validation.Required, validation.Password},
+}
+
+type handler struct {
+	changePassword auth.AdapterHandler
+	limiter        RateLimiter
+	logger         *zap.Logger
+	passwords      PasswordChecker
+	publisher      userevents.Publisher
+	session        utils.SessionConfig
+}
+
+/*
+Changes the password of a signed in user, authenticated by their access token. The new password is screened against
+known breaches before it reaches the auth provider. The request doesn't name the user, so attempts at the previous
+password are limited by access token and IP rather than email.
+*/
+func NewHandler(logger *zap.Logger, c auth.AdapterHandler, passwords PasswordChecker, session utils.SessionConfig, publisher userevents.Publisher, l RateLimiter) (handler, error) {
+	return handler{
+		changePassword: c,
+		limiter:        l,
+		logger:         logger,
+		passwords:      passwords,
+		publisher:      publisher,
+		session:        session,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	t, err := handler.session.AccessToken(request)
+	if errors.Is(err, utils.ErrCSRF) {
+		handler.logger.Error("Session cookie without a valid CSRF token", zap.Error(err))
+		return utils.RESPONSE_403, nil
+	}
+	if t == "" {
+		handler.logger.Error("No access token supplied")
+		return utils.RESPONSE_401, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid change password request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	keys := []ratelimit.Key{ratelimit.IP(request.RequestContext.Identity.SourceIP), ratelimit.Token(t)}
+	wait, err := handler.limiter.Allow(ctx, keys...)
+	if err != nil {
+		// An unavailable store shouldn't stop everyone from changing their password
+		handler.logger.Error("Failed to check rate limit", zap.Error(err))
+	}
+	if wait > 0 {
+		handler.logger.Warn("Rate limited change password request", zap.String("sourceIp", request.RequestContext.Identity.SourceIP), zap.Duration("retryAfter", wait))
+		return utils.RESPONSE_429(wait), nil
+	}
+
+	breached, err := handler.passwords.Breached(ctx, bodyMap["password"])
+	if err != nil {
+		handler.logger.Error("Password breach check failed", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	if breached {
+		handler.logger.Info("Password change to breached password rejected")
+		return utils.RESPONSE_PASSWORD_BREACHED, nil
+	}
+	bodyMap["accessToken"] = t
+
+	d, err := handler.changePassword(ctx, bodyMap)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		handler.logger.Error("Password change rejected", zap.Error(err))
+		return utils.RESPONSE_401, nil
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	err = handler.limiter.Reset(ctx, ratelimit.Token(t))
+	if err != nil {
+		handler.logger.Error("Failed to reset rate limit", zap.Error(err))
+	}
+
+	if err := handler.publisher.Publish(ctx, userevents.PasswordChanged(d["email"], userevents.PasswordChangedByUser)); err != nil {
+		// The password has changed regardless, so this isn't worth failing the request over
+		handler.logger.Error("Failed to publish password changed event", zap.Error(err))
+	}
+
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("change password error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) ChangePassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	if body["previousPassword"] == "wrong" {
+		return nil, fmt.Errorf("%w: Incorrect username or password.", auth.ErrInvalidToken)
+	}
+	return map[string]string{
+		"message": "Successfully changed password",
+	}, nil
+}
+
+type MockPasswordChecker struct {
+	isError bool
+}
+
+func (mc MockPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	if mc.isError {
+		return false, fmt.Errorf("Password checker error")
+	}
+	return password == "Password1", nil
+}
+
+type MockRateLimiter struct {
+	isError    bool
+	retryAfter time.Duration
+	keys       *[]ratelimit.Key
+}
+
+func (m MockRateLimiter) Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error) {
+	if m.keys != nil {
+		*m.keys = append(*m.keys, keys...)
+	}
+	if m.isError {
+		return 0, fmt.Errorf("Rate limit store error")
+	}
+	return m.retryAfter, nil
+}
+
+func (m MockRateLimiter) Reset(ctx context.Context, keys ...ratelimit.Key) error {
+	return nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		CheckerError       bool
+		Authorization      string
+		RequestBody        string
+		RateLimited        bool
+		RateLimiterError   bool
+		ExpectedStatusCode int
+		ExpectedCode       string
+	}
+
+	tests := []test{
+		{
+			Name:               "Change password success",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Change password malformed body",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Change password no access token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Change password doesn't meet policy",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"defdef456\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Change password breached password",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Password1\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodePasswordBreached,
+		},
+		{
+			Name:               "Change password wrong previous password",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"wrong\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Change password password checker error",
+			CheckerError:       true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Change password auth provider adapter error",
+			AdapterError:       true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Change password rate limited",
+			RateLimited:        true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 429,
+		},
+		{
+			Name:               "Change password rate limiter error",
+			RateLimiterError:   true,
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"previousPassword\": \"Abcabc123\", \"password\": \"Defdef456\"}",
+			ExpectedStatusCode: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			p := userevents.NewMemoryPublisher()
+			keys := []ratelimit.Key{}
+			rl := MockRateLimiter{isError: tt.RateLimiterError, keys: &keys}
+			if tt.RateLimited {
+				rl.retryAfter = 90 * time.Second
+			}
+
+			h, err := NewHandler(l, m.ChangePassword, MockPasswordChecker{isError: tt.CheckerError}, utils.SessionConfig{}, p, rl)
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Authorization": tt.Authorization, "Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			if tt.RateLimited {
+				// Limited by the user as well as the IP
+				assert.Contains(t, keys, ratelimit.Token("token"))
+			}
+
+			// Only successful requests publish an event
+			if tt.ExpectedStatusCode == 200 {
+				assert.Len(t, p.Events(), 1)
+				assert.Equal(t, userevents.TypePasswordChanged, p.Events()[0].Type)
+			} else {
+				assert.Empty(t, p.Events())
+			}
+			if tt.ExpectedCode != "" {
+				assert.Contains(t, r.Body, tt.ExpectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+type Outbox interface {
+	Send(ctx context.Context, e outbox.Entry) (outbox.Sent, error)
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"code": {validation.Required, validation.Code},
+}
+
+type handler struct {
+	confirmEmailChange auth.AdapterHandler
+	logger             *zap.Logger
+	outbox             Outbox
+	session            utils.SessionConfig
+}
+
+/*
+Confirms an email address change with the code sent to the new address. The change is only published once the auth
+provider has accepted the code, since both admin delete and the integration tests look users up by email. It goes
+through the outbox, so bk-user-api hears about it even if publishing fails the first time.
+*/
+func NewHandler(logger *zap.Logger, c auth.AdapterHandler, o Outbox, session utils.SessionConfig) (handler, error) {
+	return handler{
+		confirmEmailChange: c,
+		logger:             logger,
+		outbox:             o,
+		session:            session,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	t, err := handler.session.AccessToken(request)
+	if errors.Is(err, utils.ErrCSRF) {
+		handler.logger.Error("Session cookie without a valid CSRF token", zap.Error(err))
+		return utils.RESPONSE_403, nil
+	}
+	if t == "" {
+		handler.logger.Error("No access token supplied")
+		return utils.RESPONSE_401, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid confirm email request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+	bodyMap["accessToken"] = t
+
+	d, err := handler.confirmEmailChange(ctx, bodyMap)
+	var re auth.RequestError
+	if errors.As(err, &re) {
+		handler.logger.Error("Email change confirmation rejected", zap.String("code", re.Code))
+		return utils.RESPONSE_ERROR(400, re.Code, re.Message), nil
+	}
+	if err != nil {
+		handler.logger.Error("Error confirming email change", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	// Written even if the address is unchanged, in case this is a retry of a confirmation the outbox didn't get
+	_, err = handler.outbox.Send(ctx, outbox.PublishEvent(userevents.EmailChanged(d["email"], d["previousEmail"], d["userId"])))
+	if err != nil {
+		handler.logger.Error("Error writing email change to the outbox", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	r, err := json.Marshal(map[string]string{"email": d["email"]})
+	if err != nil {
+		handler.logger.Error("confirm email error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	return utils.RESPONSE_200(string(r)), nil
+}
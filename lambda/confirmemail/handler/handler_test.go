@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError   bool
+	unchanged bool
+}
+
+func (ma MockAdapter) ConfirmEmailChange(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	if body["code"] == "000000" {
+		return nil, auth.RequestError{Code: auth.ErrCodeInvalidCode, Message: "Invalid or expired code"}
+	}
+	r := map[string]string{
+		"message":       "Successfully changed email address",
+		"previousEmail": "abc@gmail.com",
+		"email":         "def@gmail.com",
+		"userId":        "mockUserID",
+	}
+	if ma.unchanged {
+		r["email"] = r["previousEmail"]
+	}
+	return r, nil
+}
+
+type MockStore struct {
+	*outbox.MemoryStore
+}
+
+func (m MockStore) Put(ctx context.Context, e outbox.Entry) error {
+	return fmt.Errorf("Outbox store error")
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		Unchanged          bool
+		OutboxError        bool
+		Authorization      string
+		RequestBody        string
+		ExpectedStatusCode int
+		ExpectedEvents     int
+	}
+
+	tests := []test{
+		{
+			Name:               "Confirm email success",
+			Authorization:      "Bearer token",
+			ExpectedStatusCode: 200,
+			ExpectedEvents:     1,
+		},
+		{
+			Name:               "Confirm email malformed body",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"code\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Confirm email unchanged address",
+			Unchanged:          true,
+			Authorization:      "Bearer token",
+			ExpectedStatusCode: 200,
+			ExpectedEvents:     1,
+		},
+		{
+			Name:               "Confirm email invalid code",
+			Authorization:      "Bearer token",
+			RequestBody:        "{\"code\": \"000000\"}",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Confirm email no access token",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Confirm email auth provider adapter error",
+			AdapterError:       true,
+			Authorization:      "Bearer token",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Confirm email outbox error",
+			OutboxError:        true,
+			Authorization:      "Bearer token",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError:   tt.AdapterError,
+				unchanged: tt.Unchanged,
+			}
+
+			var store outbox.Store = outbox.NewMemoryStore()
+			if tt.OutboxError {
+				store = MockStore{outbox.NewMemoryStore()}
+			}
+			p := userevents.NewMemoryPublisher()
+			o := outbox.New(l, outbox.Config{Store: store, DeadLetters: outbox.NewMemoryDeadLetterQueue(), Retry: outbox.DefaultRetryPolicy}, outbox.Deliverers{
+				outbox.KindPublishEvent: outbox.NewEventDeliverer(p),
+			})
+
+			h, err := NewHandler(l, m.ConfirmEmailChange, o, utils.SessionConfig{})
+			assert.Nil(t, err)
+
+			body := tt.RequestBody
+			if body == "" {
+				body = "{\"code\": \"123456\"}"
+			}
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Authorization": tt.Authorization, "Content-Type": "application/json"},
+				Body:       body,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			assert.Len(t, p.Events(), tt.ExpectedEvents)
+			for _, e := range p.Events() {
+				assert.Equal(t, userevents.TypeEmailChanged, e.Type)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/confirmemail/handler"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+	}
+	session := utils.SessionConfigFromEnv()
+	publisher, err := userevents.PublisherFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise event publisher, events will be dropped: %v", err)
+		publisher = userevents.Discard
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+
+	start.API(string(audit.ActionEmailChangeConfirm), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		// bk-user-api picks the change up from the event, see handler.NewHandler
+		ob := outbox.New(inv.Logger, outboxConfig, outbox.Deliverers{
+			outbox.KindPublishEvent: outbox.NewEventDeliverer(publisher),
+		})
+
+		h, err := handler.NewHandler(inv.Logger, ca.ConfirmEmailChange, ob, session)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.uber.org/zap"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+const defaultLocale = "en"
+
+// Maps Cognito trigger sources to template names. Anything else (e.g. MFA codes) keeps Cognito's default message.
+var messages = map[string]string{
+	"CustomMessage_SignUp":              "signup",
+	"CustomMessage_ResendCode":          "resend",
+	"CustomMessage_ForgotPassword":      "forgotpassword",
+	"CustomMessage_AdminCreateUser":     "invite",
+	"CustomMessage_UpdateUserAttribute": "verifyattribute",
+	"CustomMessage_VerifyUserAttribute": "verifyattribute",
+}
+
+/*
+Each message has an HTML template, defining "subject" and "content" blocks that are rendered into the locale's
+layout, and a plain text template used for SMS. Templates are keyed by locale and then message name.
+*/
+type templates struct {
+	html map[string]map[string]*template.Template
+	text map[string]map[string]*texttemplate.Template
+}
+
+type data struct {
+	Code     string
+	Locale   string
+	Name     string
+	Username string
+}
+
+type handler struct {
+	logger    *zap.Logger
+	templates templates
+}
+
+func NewHandler(logger *zap.Logger) (handler, error) {
+	t, err := loadTemplates()
+	if err != nil {
+		return handler{}, err
+	}
+	return handler{
+		logger:    logger,
+		templates: t,
+	}, nil
+}
+
+func loadTemplates() (templates, error) {
+	t := templates{
+		html: map[string]map[string]*template.Template{},
+		text: map[string]map[string]*texttemplate.Template{},
+	}
+
+	locales, err := fs.ReadDir(templateFS, "templates")
+	if err != nil {
+		return t, err
+	}
+
+	for _, l := range locales {
+		locale := l.Name()
+		t.html[locale] = map[string]*template.Template{}
+		t.text[locale] = map[string]*texttemplate.Template{}
+
+		for _, name := range messages {
+			dir := "templates/" + locale + "/"
+			h, err := template.ParseFS(templateFS, dir+"layout.html", dir+name+".html")
+			if err != nil {
+				return t, fmt.Errorf("parsing %v %v html template: %w", locale, name, err)
+			}
+			t.html[locale][name] = h
+
+			p, err := texttemplate.ParseFS(templateFS, dir+name+".txt")
+			if err != nil {
+				return t, fmt.Errorf("parsing %v %v text template: %w", locale, name, err)
+			}
+			t.text[locale][name] = p
+		}
+	}
+
+	if _, ok := t.html[defaultLocale]; !ok {
+		return t, fmt.Errorf("no templates for default locale %v", defaultLocale)
+	}
+	return t, nil
+}
+
+/*
+Picks the closest locale we have templates for, trying e.g. "fr-CA", then "fr", then falling back to the default
+*/
+func (t templates) locale(requested string) string {
+	requested = strings.ReplaceAll(strings.ToLower(requested), "_", "-")
+	if _, ok := t.html[requested]; ok {
+		return requested
+	}
+	base, _, _ := strings.Cut(requested, "-")
+	if _, ok := t.html[base]; ok {
+		return base
+	}
+	return defaultLocale
+}
+
+func (handler handler) Handle(_ context.Context, event events.CognitoEventUserPoolsCustomMessage) (events.CognitoEventUserPoolsCustomMessage, error) {
+	name, ok := messages[event.TriggerSource]
+	if !ok {
+		handler.logger.Info("No template for trigger source, using default message", zap.String("triggerSource", event.TriggerSource))
+		return event, nil
+	}
+
+	requested, _ := event.Request.UserAttributes["locale"].(string)
+	d := data{
+		Code:     event.Request.CodeParameter,
+		Locale:   handler.templates.locale(requested),
+		Username: event.Request.UsernameParameter,
+	}
+	d.Name, _ = event.Request.UserAttributes["name"].(string)
+
+	h := handler.templates.html[d.Locale][name]
+
+	var subject bytes.Buffer
+	err := h.ExecuteTemplate(&subject, "subject", d)
+	if err != nil {
+		handler.logger.Error("Failed to render subject", zap.Error(err))
+		return event, err
+	}
+
+	var body bytes.Buffer
+	err = h.ExecuteTemplate(&body, "layout", d)
+	if err != nil {
+		handler.logger.Error("Failed to render email", zap.Error(err))
+		return event, err
+	}
+
+	var sms bytes.Buffer
+	err = handler.templates.text[d.Locale][name].Execute(&sms, d)
+	if err != nil {
+		handler.logger.Error("Failed to render sms", zap.Error(err))
+		return event, err
+	}
+
+	event.Response.EmailSubject = subject.String()
+	event.Response.EmailMessage = body.String()
+	event.Response.SMSMessage = strings.TrimSpace(sms.String())
+
+	return event, nil
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+/*
+Renders each message and compares it to the golden file in testdata. Run with -update after changing a template.
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name          string
+		TriggerSource string
+		Attributes    map[string]interface{}
+	}
+
+	tests := []test{
+		{
+			Name:          "signup_en",
+			TriggerSource: "CustomMessage_SignUp",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com"},
+		},
+		{
+			Name:          "signup_fr",
+			TriggerSource: "CustomMessage_SignUp",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com", "locale": "fr", "name": "Zoë"},
+		},
+		{
+			Name:          "resend_en",
+			TriggerSource: "CustomMessage_ResendCode",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com", "name": "<b>Abc</b>"},
+		},
+		{
+			Name:          "forgotpassword_fr_ca",
+			TriggerSource: "CustomMessage_ForgotPassword",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com", "locale": "fr-CA"},
+		},
+		{
+			Name:          "invite_en",
+			TriggerSource: "CustomMessage_AdminCreateUser",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com"},
+		},
+		{
+			Name:          "verifyattribute_unknown_locale",
+			TriggerSource: "CustomMessage_UpdateUserAttribute",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com", "locale": "de-DE"},
+		},
+		{
+			Name:          "authentication_unchanged",
+			TriggerSource: "CustomMessage_Authentication",
+			Attributes:    map[string]interface{}{"email": "abc@gmail.com"},
+		},
+	}
+
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+
+	h, err := NewHandler(l)
+	assert.Nil(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			e := events.CognitoEventUserPoolsCustomMessage{}
+			e.TriggerSource = tt.TriggerSource
+			e.Request.UserAttributes = tt.Attributes
+			e.Request.CodeParameter = "{####}"
+			e.Request.UsernameParameter = "{username}"
+
+			r, err := h.Handle(context.Background(), e)
+			assert.Nil(t, err)
+
+			// Cognito rejects messages that leave out the placeholders it fills in
+			if _, ok := messages[tt.TriggerSource]; ok {
+				assert.Contains(t, r.Response.EmailMessage, "{####}")
+				assert.Contains(t, r.Response.SMSMessage, "{####}")
+			}
+			if tt.TriggerSource == "CustomMessage_AdminCreateUser" {
+				assert.Contains(t, r.Response.EmailMessage, "{username}")
+			}
+
+			got := fmt.Sprintf("subject: %v\n\n-- email --\n%v\n\n-- sms --\n%v\n", r.Response.EmailSubject, r.Response.EmailMessage, r.Response.SMSMessage)
+
+			golden := filepath.Join("testdata", tt.Name+".golden")
+			if *update {
+				err = os.WriteFile(golden, []byte(got), 0644)
+				assert.Nil(t, err)
+			}
+
+			want, err := os.ReadFile(golden)
+			assert.Nil(t, err)
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+func TestEveryLocaleHasEveryTemplate(t *testing.T) {
+	tpl, err := loadTemplates()
+	assert.Nil(t, err)
+
+	for locale := range tpl.html {
+		for _, name := range messages {
+			assert.NotNil(t, tpl.html[locale][name], "%v missing html %v", locale, name)
+			assert.NotNil(t, tpl.text[locale][name], "%v missing text %v", locale, name)
+		}
+	}
+}
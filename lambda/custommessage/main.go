@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/custommessage/handler"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	start.Event("custom_message", func(ctx context.Context, inv start.Invocation) (func(context.Context, events.CognitoEventUserPoolsCustomMessage) (events.CognitoEventUserPoolsCustomMessage, error), error) {
+		h, err := handler.NewHandler(inv.Logger)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	})
+}
@@ -2,28 +2,18 @@ package main
 
 import (
 	"context"
-	"fmt"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
 	"github.com/benjaminkitson/bk-user-api/lambda/fallback/handler"
-	"go.uber.org/zap"
 )
 
 func main() {
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		logger, err := zap.NewProduction()
+	start.API("fallback", func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		h, err := handler.NewHandler(inv.Logger)
 		if err != nil {
-			fmt.Printf("Failed to initialise logger: %v", err)
-			logger = &zap.Logger{}
+			return nil, err
 		}
-		defer logger.Sync()
-
-		h, err := handler.NewHandler(logger)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
-		}
-
-		return h.Handle(ctx, request)
+		return h.Handle, nil
 	})
 }
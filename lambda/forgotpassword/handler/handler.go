@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error)
+	Reset(ctx context.Context, keys ...ratelimit.Key) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+}
+
+type handler struct {
+	forgotPassword auth.AdapterHandler
+	limiter        RateLimiter
+	logger         *zap.Logger
+}
+
+/*
+Starts a password reset by sending a code to the user's email, which is then used with the reset password handler.
+Limited by email as well as IP, so that nobody's inbox can be flooded with codes.
+*/
+func NewHandler(logger *zap.Logger, f auth.AdapterHandler, l RateLimiter) (handler, error) {
+	return handler{
+		forgotPassword: f,
+		limiter:        l,
+		logger:         logger,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err := json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid forgot password request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	keys := []ratelimit.Key{ratelimit.IP(request.RequestContext.Identity.SourceIP), ratelimit.Email(bodyMap["email"])}
+	wait, err := handler.limiter.Allow(ctx, keys...)
+	if err != nil {
+		// An unavailable store shouldn't stop everyone from resetting their password
+		handler.logger.Error("Failed to check rate limit", zap.Error(err))
+	}
+	if wait > 0 {
+		handler.logger.Warn("Rate limited forgot password request", zap.String("sourceIp", request.RequestContext.Identity.SourceIP), zap.Duration("retryAfter", wait))
+		return utils.RESPONSE_429(wait), nil
+	}
+
+	d, err := handler.forgotPassword(ctx, bodyMap)
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("forgot password error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) ForgotPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{
+		"message": "If the account exists, a password reset code has been sent",
+	}, nil
+}
+
+type MockRateLimiter struct {
+	isError    bool
+	retryAfter time.Duration
+	keys       *[]ratelimit.Key
+}
+
+func (m MockRateLimiter) Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error) {
+	if m.keys != nil {
+		*m.keys = append(*m.keys, keys...)
+	}
+	if m.isError {
+		return 0, fmt.Errorf("Rate limit store error")
+	}
+	return m.retryAfter, nil
+}
+
+func (m MockRateLimiter) Reset(ctx context.Context, keys ...ratelimit.Key) error {
+	return nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		RequestBody        string
+		RateLimited        bool
+		RateLimiterError   bool
+		ExpectedStatusCode int
+		ExpectedCode       string
+	}
+
+	tests := []test{
+		{
+			Name:               "Forgot password success",
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Forgot password malformed body",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Forgot password invalid email",
+			RequestBody:        "{\"email\": \"abc\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Forgot password auth provider adapter error",
+			AdapterError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Forgot password rate limited",
+			RateLimited:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 429,
+		},
+		{
+			Name:               "Forgot password rate limiter error",
+			RateLimiterError:   true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			keys := []ratelimit.Key{}
+			rl := MockRateLimiter{isError: tt.RateLimiterError, keys: &keys}
+			if tt.RateLimited {
+				rl.retryAfter = 90 * time.Second
+			}
+
+			h, err := NewHandler(l, m.ForgotPassword, rl)
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			if tt.RateLimited {
+				// Limited by the user as well as the IP
+				assert.Contains(t, keys, ratelimit.Email("abc@gmail.com"))
+			}
+			if tt.ExpectedCode != "" {
+				assert.Contains(t, r.Body, tt.ExpectedCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/benjaminkitson/bk-auth-api/lambda/forgotpassword/handler"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+		appconfig.RateLimit
+	}
+
+	// Only used without a RATE_LIMIT_TABLE, it lives outside the handler function to last between invocations
+	memoryStore := ratelimit.NewMemoryStore()
+
+	start.API(string(audit.ActionPasswordResetRequest), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		var store ratelimit.Store = memoryStore
+		if cfg.RateLimit.Table != "" {
+			ds, err := ratelimit.NewDynamoDBStore(dynamodb.NewFromConfig(sdkConfig), cfg.RateLimit.Table)
+			if err != nil {
+				return nil, fmt.Errorf("initialising rate limit store: %w", err)
+			}
+			store = ds
+		}
+		limiter := ratelimit.NewLimiter(inv.Logger, store, ratelimit.DefaultPolicies)
+
+		h, err := handler.NewHandler(inv.Logger, ca.ForgotPassword, limiter)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
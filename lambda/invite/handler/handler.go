@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"go.uber.org/zap"
+)
+
+type UserAPIClient interface {
+	CreateUser(ctx context.Context, email string) (models.User, error)
+}
+
+// Keeps the ID of the user's bk-user-api record with the auth provider's user
+type UserIDRecorder interface {
+	SetUserID(ctx context.Context, email string, id string) error
+}
+
+type InvitationSender interface {
+	SendInvitation(ctx context.Context, email string, temporaryPassword string) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email":             {validation.Required, validation.Email},
+	"temporaryPassword": {validation.Password},
+}
+
+type handler struct {
+	invite        auth.AdapterHandler
+	logger        *zap.Logger
+	mailer        InvitationSender
+	userAPIClient UserAPIClient
+	userIDs       UserIDRecorder
+}
+
+func NewHandler(logger *zap.Logger, i auth.AdapterHandler, m InvitationSender, c UserAPIClient, ids UserIDRecorder) (handler, error) {
+	return handler{
+		invite:        i,
+		logger:        logger,
+		mailer:        m,
+		userAPIClient: c,
+		userIDs:       ids,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	err := auth.RequireRole(request, auth.RoleAdmin)
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		handler.logger.Error("No verified claims on request")
+		return utils.RESPONSE_401, nil
+	}
+	if err != nil {
+		handler.logger.Error("Caller is not an admin", logging.Email("caller", auth.Caller(request)))
+		return utils.RESPONSE_403, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid invite request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	d, err := handler.invite(ctx, bodyMap)
+	if err != nil {
+		handler.logger.Error("Error inviting user", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	// The auth provider only hands back a temporary password when it hasn't sent the invitation itself
+	if p, ok := d["temporaryPassword"]; ok {
+		err = handler.mailer.SendInvitation(ctx, bodyMap["email"], p)
+		if err != nil {
+			handler.logger.Error("Error sending invitation", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+	}
+
+	u, err := handler.userAPIClient.CreateUser(ctx, bodyMap["email"])
+	if err != nil {
+		handler.logger.Error("Error creating user", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	err = handler.userIDs.SetUserID(ctx, bodyMap["email"], u.UserID)
+	if err != nil {
+		handler.logger.Error("Error recording user ID", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	r, err := json.Marshal(u)
+	if err != nil {
+		handler.logger.Error("invite error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	return utils.RESPONSE_200(string(r)), nil
+}
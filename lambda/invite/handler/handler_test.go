@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError  bool
+	suppress bool
+}
+
+func (ma MockAdapter) Invite(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	r := map[string]string{
+		"message": "Successfully invited user",
+	}
+	if ma.suppress {
+		r["temporaryPassword"] = "TempPassword1"
+	}
+	return r, nil
+}
+
+type MockMailer struct {
+	isError bool
+	sent    *int
+}
+
+func (m MockMailer) SendInvitation(ctx context.Context, email string, temporaryPassword string) error {
+	if m.isError {
+		return fmt.Errorf("Mailer error")
+	}
+	*m.sent++
+	return nil
+}
+
+type MockUserAPIClient struct {
+	isError bool
+}
+
+func (c MockUserAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	if c.isError {
+		return models.User{}, fmt.Errorf("API Client Error")
+	}
+	return models.User{
+		Email: email,
+	}, nil
+}
+
+type MockUserIDRecorder struct {
+	isError bool
+}
+
+func (r MockUserIDRecorder) SetUserID(ctx context.Context, email string, id string) error {
+	if r.isError {
+		return fmt.Errorf("AdminUpdateUserAttributes error")
+	}
+	return nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		Groups             string
+		AdapterError       bool
+		Suppress           bool
+		MailerError        bool
+		UserAPIClientError bool
+		UserIDError        bool
+		RequestBody        string
+		ExpectedStatusCode int
+		ExpectedSent       int
+	}
+
+	tests := []test{
+		{
+			Name:               "Invite success",
+			Groups:             "admin",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"temporaryPassword\": \"TempPassword1\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Invite malformed body",
+			Groups:             "admin",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Invite with own email success",
+			Groups:             "admin",
+			Suppress:           true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 200,
+			ExpectedSent:       1,
+		},
+		{
+			Name:               "Invite auth provider adapter error",
+			Groups:             "admin",
+			AdapterError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Invite mailer error",
+			Groups:             "admin",
+			Suppress:           true,
+			MailerError:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Invite user api client error",
+			Groups:             "admin",
+			UserAPIClientError: true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"temporaryPassword\": \"TempPassword1\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Invite record user ID error",
+			Groups:             "admin",
+			UserIDError:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"temporaryPassword\": \"TempPassword1\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Invite caller is not an admin",
+			Groups:             "member",
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "Invite no verified claims",
+			RequestBody:        "{\"email\": \"abc@gmail.com\"}",
+			ExpectedStatusCode: 401,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError:  tt.AdapterError,
+				suppress: tt.Suppress,
+			}
+
+			sent := 0
+			ml := MockMailer{
+				isError: tt.MailerError,
+				sent:    &sent,
+			}
+
+			c := MockUserAPIClient{
+				isError: tt.UserAPIClientError,
+			}
+
+			h, err := NewHandler(l, m.Invite, ml, c, MockUserIDRecorder{isError: tt.UserIDError})
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+			if tt.Groups != "" {
+				req.RequestContext.Authorizer = map[string]interface{}{
+					"claims": map[string]interface{}{"cognito:groups": tt.Groups},
+				}
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			assert.Equal(t, tt.ExpectedSent, sent)
+		})
+	}
+}
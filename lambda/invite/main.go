@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/benjaminkitson/bk-auth-api/lambda/invite/handler"
+	"github.com/benjaminkitson/bk-auth-api/mailer"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+	"github.com/benjaminkitson/bk-user-api/userapiclient"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+		appconfig.UserAPI
+		// Must be from an SES verified identity
+		InviteFromAddress string `config:"INVITE_FROM_ADDRESS,required"`
+	}
+
+	start.API(string(audit.ActionInvite), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		uc, err := userapiclient.NewClient(cfg.UserAPI.URL, inv.Logger)
+		if err != nil {
+			return nil, err
+		}
+
+		ses := sesv2.NewFromConfig(sdkConfig)
+		m, err := mailer.NewSESMailer(inv.Logger, ses, cfg.InviteFromAddress)
+		if err != nil {
+			return nil, fmt.Errorf("initialising mailer: %w", err)
+		}
+
+		h, err := handler.NewHandler(inv.Logger, ca.AdminInvite, m, inv.UserAPI(uc), ca)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+type PasswordChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email":       {validation.Required, validation.Email},
+	"newPassword": {validation.Required, validation.Password},
+	"session":     {validation.Required, validation.MaxLength(2048)},
+}
+
+type handler struct {
+	completeNewPassword auth.AdapterHandler
+	logger              *zap.Logger
+	passwords           PasswordChecker
+}
+
+/*
+Completes sign in for invited users, who have to replace their temporary password the first time they sign in. The new
+password is screened against known breaches before it reaches the auth provider.
+*/
+func NewHandler(logger *zap.Logger, c auth.AdapterHandler, passwords PasswordChecker) (handler, error) {
+	return handler{
+		completeNewPassword: c,
+		logger:              logger,
+		passwords:           passwords,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err := json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid new password request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	breached, err := handler.passwords.Breached(ctx, bodyMap["newPassword"])
+	if err != nil {
+		handler.logger.Error("Password breach check failed", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	if breached {
+		handler.logger.Info("New password with breached password rejected")
+		return utils.RESPONSE_PASSWORD_BREACHED, nil
+	}
+
+	d, err := handler.completeNewPassword(ctx, bodyMap)
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("new password error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
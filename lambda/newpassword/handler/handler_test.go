@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) CompleteNewPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{
+		"message": "Successfully signed in!",
+	}, nil
+}
+
+type MockPasswordChecker struct {
+	isError bool
+}
+
+func (mc MockPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	if mc.isError {
+		return false, fmt.Errorf("Password checker error")
+	}
+	return password == "Password1", nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		CheckerError       bool
+		RequestBody        string
+		ExpectedStatusCode int
+		ExpectedCode       string
+	}
+
+	tests := []test{
+		{
+			Name:               "New password success",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"newPassword\": \"Password123\", \"session\": \"session\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "New password malformed body",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "New password breached password",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"newPassword\": \"Password1\", \"session\": \"session\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodePasswordBreached,
+		},
+		{
+			Name:               "New password password checker error",
+			CheckerError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"newPassword\": \"Password123\", \"session\": \"session\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "New password auth provider adapter error",
+			AdapterError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"newPassword\": \"Password123\", \"session\": \"session\"}",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			h, err := NewHandler(l, m.CompleteNewPassword, MockPasswordChecker{isError: tt.CheckerError})
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			if tt.ExpectedCode != "" {
+				assert.Contains(t, r.Body, tt.ExpectedCode)
+			}
+		})
+	}
+}
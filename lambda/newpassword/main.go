@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/breach"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/benjaminkitson/bk-auth-api/lambda/newpassword/handler"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+	}
+	breachConfig := breach.ConfigFromEnv()
+	// Kept between invocations, so the range API connection or range file is reused
+	ranges, rangesErr := breachConfig.RangeClient()
+
+	start.API(string(audit.ActionNewPassword), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		if rangesErr != nil {
+			return nil, fmt.Errorf("initialising password range client: %w", rangesErr)
+		}
+		pc := breach.NewChecker(inv.Logger, ranges, breachConfig)
+
+		h, err := handler.NewHandler(inv.Logger, ca.CompleteNewPassword, pc)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"go.uber.org/zap"
+)
+
+type Relay interface {
+	Relay(ctx context.Context, limit int) (outbox.Summary, error)
+}
+
+// Enough to get through a backlog in a few runs without getting near the Lambda timeout
+const BatchSize = 100
+
+type handler struct {
+	logger *zap.Logger
+	relay  Relay
+}
+
+/*
+Delivers outbox entries that weren't delivered inline, or whose last attempt failed, on a schedule. Entries that run
+out of attempts go to the dead-letter queue.
+*/
+func NewHandler(logger *zap.Logger, r Relay) (handler, error) {
+	return handler{
+		logger: logger,
+		relay:  r,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, event events.CloudWatchEvent) (outbox.Summary, error) {
+	s, err := handler.relay.Relay(ctx, BatchSize)
+	if err != nil {
+		handler.logger.Error("Outbox relay failed", zap.Error(err), zap.Any("summary", s))
+		return s, err
+	}
+
+	if s.Dead > 0 {
+		handler.logger.Error("Outbox entries dead-lettered", zap.Any("summary", s))
+	} else {
+		handler.logger.Info("Outbox relay finished", zap.Any("summary", s))
+	}
+	return s, nil
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockRelay struct {
+	isError bool
+	limit   *int
+}
+
+func (m MockRelay) Relay(ctx context.Context, limit int) (outbox.Summary, error) {
+	*m.limit = limit
+	if m.isError {
+		return outbox.Summary{Delivered: 1}, fmt.Errorf("Relay error")
+	}
+	return outbox.Summary{Delivered: 2, Retried: 1}, nil
+}
+
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name            string
+		RelayError      bool
+		ExpectedError   bool
+		ExpectedSummary outbox.Summary
+	}
+
+	tests := []test{
+		{
+			Name:            "Entries relayed",
+			ExpectedSummary: outbox.Summary{Delivered: 2, Retried: 1},
+		},
+		{
+			Name:            "Relay fails",
+			RelayError:      true,
+			ExpectedError:   true,
+			ExpectedSummary: outbox.Summary{Delivered: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			limit := 0
+			h, err := NewHandler(l, MockRelay{isError: tt.RelayError, limit: &limit})
+			assert.Nil(t, err)
+
+			s, err := h.Handle(context.Background(), events.CloudWatchEvent{})
+			assert.Equal(t, tt.ExpectedError, err != nil)
+			assert.Equal(t, tt.ExpectedSummary, s)
+			assert.Equal(t, BatchSize, limit)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/outboxrelay/handler"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+	"github.com/benjaminkitson/bk-user-api/userapiclient"
+)
+
+func main() {
+	var cfg struct {
+		UserPoolID string `config:"COGNITO_USER_POOL_ID,required"`
+		appconfig.UserAPI
+	}
+	publisher, err := userevents.PublisherFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise event publisher, events will be dropped: %v", err)
+		publisher = userevents.Discard
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+
+	start.Event("outbox_relay", func(ctx context.Context, inv start.Invocation) (func(context.Context, events.CloudWatchEvent) (outbox.Summary, error), error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		// Record IDs are kept on the Cognito user, which doesn't need the app client
+		ca := cognito.NewAdapter(cc, "", cfg.UserPoolID, inv.Logger)
+
+		uc, err := userapiclient.NewClient(cfg.UserAPI.URL, inv.Logger)
+		if err != nil {
+			return nil, err
+		}
+
+		ob := outbox.New(inv.Logger, outboxConfig, outbox.Deliverers{
+			outbox.KindCreateUser:   outbox.NewUserDeliverer(inv.UserAPI(uc), ca),
+			outbox.KindPublishEvent: outbox.NewEventDeliverer(publisher),
+		})
+
+		h, err := handler.NewHandler(inv.Logger, ob)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg))
+}
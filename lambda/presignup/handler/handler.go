@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"go.uber.org/zap"
+)
+
+//go:embed disposable_domains.txt
+var disposableDomainList string
+
+/*
+Email domain policy for self sign up. Domains match themselves and any of their subdomains.
+If Allowed is non-empty, only those domains may sign up. Denied domains and the bundled disposable domains are always
+rejected, and Trusted domains are confirmed and verified without an email code.
+*/
+type Policy struct {
+	Allowed []string `config:"ALLOWED_EMAIL_DOMAINS"`
+	Denied  []string `config:"DENIED_EMAIL_DOMAINS"`
+	Trusted []string `config:"TRUSTED_EMAIL_DOMAINS"`
+}
+
+func lowerDomains(domains []string) []string {
+	lower := []string{}
+	for _, d := range domains {
+		lower = append(lower, strings.ToLower(d))
+	}
+	return lower
+}
+
+type handler struct {
+	disposable []string
+	logger     *zap.Logger
+	policy     Policy
+}
+
+func NewHandler(logger *zap.Logger, p Policy) (handler, error) {
+	disposable := []string{}
+	s := bufio.NewScanner(strings.NewReader(disposableDomainList))
+	for s.Scan() {
+		l := strings.TrimSpace(s.Text())
+		if l != "" && !strings.HasPrefix(l, "#") {
+			disposable = append(disposable, l)
+		}
+	}
+
+	return handler{
+		disposable: disposable,
+		logger:     logger,
+		policy: Policy{
+			Allowed: lowerDomains(p.Allowed),
+			Denied:  lowerDomains(p.Denied),
+			Trusted: lowerDomains(p.Trusted),
+		},
+	}, nil
+}
+
+var errDomainNotAllowed = auth.RequestError{
+	Code:    auth.ErrCodeEmailDomainNotAllowed,
+	Message: "Sign ups from this email domain are not allowed",
+}
+
+var errDisposableEmail = auth.RequestError{
+	Code:    auth.ErrCodeDisposableEmail,
+	Message: "Disposable email addresses are not allowed",
+}
+
+/*
+Rejections are returned as errors, which Cognito relays to the sign up caller (see cognito.Adapter.SignUp)
+*/
+func (handler handler) Handle(_ context.Context, event events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error) {
+	// Admins invite whoever they like
+	if event.TriggerSource == "PreSignUp_AdminCreateUser" {
+		return event, nil
+	}
+
+	_, domain, ok := strings.Cut(strings.ToLower(event.Request.UserAttributes["email"]), "@")
+	if !ok || domain == "" {
+		handler.logger.Error("No email domain in sign up")
+		return event, errDomainNotAllowed
+	}
+
+	if len(handler.policy.Allowed) > 0 && !matchesAny(domain, handler.policy.Allowed) {
+		handler.logger.Info("Rejected sign up from domain not on allow list", zap.String("domain", domain))
+		return event, errDomainNotAllowed
+	}
+	if matchesAny(domain, handler.policy.Denied) {
+		handler.logger.Info("Rejected sign up from denied domain", zap.String("domain", domain))
+		return event, errDomainNotAllowed
+	}
+	if matchesAny(domain, handler.disposable) {
+		handler.logger.Info("Rejected sign up from disposable domain", zap.String("domain", domain))
+		return event, errDisposableEmail
+	}
+
+	if matchesAny(domain, handler.policy.Trusted) {
+		handler.logger.Info("Auto confirming sign up from trusted domain", zap.String("domain", domain))
+		event.Response.AutoConfirmUser = true
+		event.Response.AutoVerifyEmail = true
+	}
+
+	return event, nil
+}
+
+func matchesAny(domain string, domains []string) bool {
+	for _, d := range domains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+/*
+Tests the email domain policy applied to sign ups
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name                string
+		Policy              Policy
+		TriggerSource       string
+		Email               string
+		ExpectedErrorCode   string
+		ExpectedAutoConfirm bool
+	}
+
+	tests := []test{
+		{
+			Name:  "Ordinary domain",
+			Email: "abc@gmail.com",
+		},
+		{
+			Name:              "Disposable domain",
+			Email:             "abc@mailinator.com",
+			ExpectedErrorCode: auth.ErrCodeDisposableEmail,
+		},
+		{
+			Name:              "Disposable subdomain",
+			Email:             "abc@eu.yopmail.com",
+			ExpectedErrorCode: auth.ErrCodeDisposableEmail,
+		},
+		{
+			Name:              "Denied domain",
+			Policy:            Policy{Denied: []string{"example.com"}},
+			Email:             "abc@Example.com",
+			ExpectedErrorCode: auth.ErrCodeEmailDomainNotAllowed,
+		},
+		{
+			Name:              "Domain not on allow list",
+			Policy:            Policy{Allowed: []string{"benjaminkitson.com"}},
+			Email:             "abc@gmail.com",
+			ExpectedErrorCode: auth.ErrCodeEmailDomainNotAllowed,
+		},
+		{
+			Name:   "Domain on allow list",
+			Policy: Policy{Allowed: []string{"benjaminkitson.com"}},
+			Email:  "abc@benjaminkitson.com",
+		},
+		{
+			Name:   "Domain on allow list in another case",
+			Policy: Policy{Allowed: []string{"BenjaminKitson.com"}},
+			Email:  "abc@benjaminkitson.com",
+		},
+		{
+			Name:                "Trusted domain",
+			Policy:              Policy{Trusted: []string{"benjaminkitson.com"}},
+			Email:               "abc@staff.benjaminkitson.com",
+			ExpectedAutoConfirm: true,
+		},
+		{
+			Name:              "Missing email",
+			ExpectedErrorCode: auth.ErrCodeEmailDomainNotAllowed,
+		},
+		{
+			Name:          "Admin created user",
+			TriggerSource: "PreSignUp_AdminCreateUser",
+			Email:         "abc@mailinator.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			h, err := NewHandler(l, tt.Policy)
+			assert.Nil(t, err)
+
+			e := events.CognitoEventUserPoolsPreSignup{}
+			e.TriggerSource = "PreSignUp_SignUp"
+			if tt.TriggerSource != "" {
+				e.TriggerSource = tt.TriggerSource
+			}
+			e.Request.UserAttributes = map[string]string{"email": tt.Email}
+
+			r, err := h.Handle(context.Background(), e)
+			if tt.ExpectedErrorCode == "" {
+				assert.Nil(t, err)
+			} else {
+				var re auth.RequestError
+				assert.ErrorAs(t, err, &re)
+				assert.Equal(t, tt.ExpectedErrorCode, re.Code)
+			}
+			assert.Equal(t, tt.ExpectedAutoConfirm, r.Response.AutoConfirmUser)
+			assert.Equal(t, tt.ExpectedAutoConfirm, r.Response.AutoVerifyEmail)
+		})
+	}
+}
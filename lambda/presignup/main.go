@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/presignup/handler"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		handler.Policy
+	}
+
+	start.Event("pre_sign_up", func(ctx context.Context, inv start.Invocation) (func(context.Context, events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error), error) {
+		h, err := handler.NewHandler(inv.Logger, cfg.Policy)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg))
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"go.uber.org/zap"
+)
+
+// Claims added to the ID token
+const (
+	UserIDClaim = "bk:user_id"
+	RolesClaim  = "bk:roles"
+)
+
+// Loaded with appconfig
+type Config struct {
+	// "open" still issues tokens (without the user ID) to users who haven't got a record yet, "closed" refuses to
+	FailMode string `config:"USER_ID_FAIL_MODE" default:"closed"`
+	// Claims to remove from issued tokens, comma separated
+	SuppressedClaims []string `config:"SUPPRESSED_CLAIMS"`
+}
+
+func (c Config) FailOpen() bool {
+	return c.FailMode == "open"
+}
+
+type handler struct {
+	config Config
+	logger *zap.Logger
+}
+
+/*
+Adds the user's bk-user-api ID and roles to their tokens, so that downstream services don't have to look them up.
+The ID is recorded on the user when their record is created, see outbox.UserDeliverer.
+*/
+func NewHandler(logger *zap.Logger, config Config) (handler, error) {
+	return handler{
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, event events.CognitoEventUserPoolsPreTokenGen) (events.CognitoEventUserPoolsPreTokenGen, error) {
+	// Leave the groups claim as it is, otherwise the override would replace it
+	event.Response.ClaimsOverrideDetails.GroupOverrideDetails = event.Request.GroupConfiguration
+	event.Response.ClaimsOverrideDetails.ClaimsToSuppress = handler.config.SuppressedClaims
+
+	claims := map[string]string{
+		RolesClaim: strings.Join(event.Request.GroupConfiguration.GroupsToOverride, ","),
+	}
+
+	// Only missing until the outbox has created the record, which the relay retries if it fails inline
+	id := event.Request.UserAttributes[cognito.UserIDAttribute]
+	if id == "" {
+		if !handler.config.FailOpen() {
+			handler.logger.Error("User has no record yet, refusing to issue token")
+			return event, fmt.Errorf("user has no bk-user-api record yet")
+		}
+		handler.logger.Warn("User has no record yet, issuing token without user ID")
+		event.Response.ClaimsOverrideDetails.ClaimsToAddOrOverride = claims
+		return event, nil
+	}
+
+	claims[UserIDClaim] = id
+	event.Response.ClaimsOverrideDetails.ClaimsToAddOrOverride = claims
+
+	return event, nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+/*
+Tests the claims added to tokens, for users with and without a bk-user-api record
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name           string
+		UserID         string
+		FailMode       string
+		ExpectedError  bool
+		ExpectedClaims map[string]string
+	}
+
+	tests := []test{
+		{
+			Name:           "Claims added",
+			UserID:         "mockUserID",
+			ExpectedClaims: map[string]string{UserIDClaim: "mockUserID", RolesClaim: "admin,member"},
+		},
+		{
+			Name:          "No record yet fail closed",
+			ExpectedError: true,
+		},
+		{
+			Name:           "No record yet fail open",
+			FailMode:       "open",
+			ExpectedClaims: map[string]string{RolesClaim: "admin,member"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			h, err := NewHandler(l, Config{
+				FailMode:         tt.FailMode,
+				SuppressedClaims: []string{"custom:marketing_consent"},
+			})
+			assert.Nil(t, err)
+
+			e := events.CognitoEventUserPoolsPreTokenGen{}
+			e.Request.UserAttributes = map[string]string{"email": "abc@gmail.com"}
+			if tt.UserID != "" {
+				e.Request.UserAttributes[cognito.UserIDAttribute] = tt.UserID
+			}
+			e.Request.GroupConfiguration.GroupsToOverride = []string{"admin", "member"}
+
+			r, err := h.Handle(context.Background(), e)
+			assert.Equal(t, tt.ExpectedError, err != nil)
+			if !tt.ExpectedError {
+				d := r.Response.ClaimsOverrideDetails
+				assert.Equal(t, tt.ExpectedClaims, d.ClaimsToAddOrOverride)
+				assert.Equal(t, []string{"custom:marketing_consent"}, d.ClaimsToSuppress)
+				assert.Equal(t, []string{"admin", "member"}, d.GroupOverrideDetails.GroupsToOverride)
+			}
+		})
+	}
+}
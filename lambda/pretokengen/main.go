@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/pretokengen/handler"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		handler.Config
+	}
+
+	start.Event("pre_token_generation", func(ctx context.Context, inv start.Invocation) (func(context.Context, events.CognitoEventUserPoolsPreTokenGen) (events.CognitoEventUserPoolsPreTokenGen, error), error) {
+		h, err := handler.NewHandler(inv.Logger, cfg.Config)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg))
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/benjaminkitson/bk-auth-api/reconcile"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"go.uber.org/zap"
+)
+
+type Reconciler interface {
+	Run(ctx context.Context, mode string) (reconcile.Report, error)
+}
+
+type Output interface {
+	Save(ctx context.Context, r reconcile.Report) error
+}
+
+// The schedule sends a dry run, repairs are run by invoking the Lambda with {"mode": "repair"}
+type Request struct {
+	Mode string `json:"mode"`
+}
+
+type handler struct {
+	logger     *zap.Logger
+	output     Output
+	reconciler Reconciler
+}
+
+/*
+Reports where Cognito and bk-user-api disagree about who the users are, and optionally repairs it. Emails are logged
+hashed so they can be matched against audit events, the saved reports have them in full.
+*/
+func NewHandler(logger *zap.Logger, r Reconciler, o Output) (handler, error) {
+	return handler{
+		logger:     logger,
+		output:     o,
+		reconciler: r,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request Request) (reconcile.Report, error) {
+	mode := request.Mode
+	if mode == "" {
+		mode = reconcile.ModeDryRun
+	}
+
+	r, err := handler.reconciler.Run(ctx, mode)
+	if err != nil {
+		handler.logger.Error("Failed to reconcile users", zap.String("mode", mode), zap.Error(err))
+		return r, err
+	}
+
+	if err := handler.output.Save(ctx, r); err != nil {
+		handler.logger.Error("Failed to save reconciliation report", zap.Error(err))
+		return r, err
+	}
+
+	if r.Clean() {
+		handler.logger.Info("Cognito and bk-user-api agree", zap.String("mode", mode))
+		return r, nil
+	}
+
+	drift := make([]string, len(r.Drift))
+	for i, d := range r.Drift {
+		drift[i] = d.Kind + " " + logging.HashEmail(d.CognitoEmail)
+	}
+	dead := make([]string, len(r.DeadEntries))
+	for i, e := range r.DeadEntries {
+		dead[i] = e.ID
+	}
+	handler.logger.Warn("Cognito and bk-user-api disagree",
+		zap.String("mode", mode),
+		zap.Any("counts", r.Counts()),
+		zap.Strings("drift", drift),
+		zap.Strings("deadEntries", dead),
+	)
+	return r, nil
+}
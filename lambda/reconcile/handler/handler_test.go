@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/benjaminkitson/bk-auth-api/reconcile"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type MockReconciler struct {
+	isError bool
+	clean   bool
+	mode    *string
+}
+
+func (m MockReconciler) Run(ctx context.Context, mode string) (reconcile.Report, error) {
+	*m.mode = mode
+	if m.isError {
+		return reconcile.Report{}, fmt.Errorf("Reconciler error")
+	}
+	r := reconcile.Report{Mode: mode, Drift: []reconcile.Drift{}}
+	if !m.clean {
+		r.Drift = append(r.Drift,
+			reconcile.Drift{Kind: reconcile.DriftMissingRecord, Sub: "sub1", CognitoEmail: "abc@gmail.com"},
+			reconcile.Drift{Kind: reconcile.DriftMissingRecord, Sub: "sub2", CognitoEmail: "def@gmail.com"},
+		)
+	}
+	return r, nil
+}
+
+type MockOutput struct {
+	isError bool
+	saved   *[]reconcile.Report
+}
+
+func (m MockOutput) Save(ctx context.Context, r reconcile.Report) error {
+	if m.isError {
+		return fmt.Errorf("Output error")
+	}
+	*m.saved = append(*m.saved, r)
+	return nil
+}
+
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name            string
+		Request         Request
+		ReconcilerError bool
+		OutputError     bool
+		Clean           bool
+		ExpectedMode    string
+		ExpectedError   bool
+		ExpectedWarning bool
+	}
+
+	tests := []test{
+		{
+			Name:            "Scheduled dry run",
+			ExpectedMode:    reconcile.ModeDryRun,
+			ExpectedWarning: true,
+		},
+		{
+			Name:            "Repair",
+			Request:         Request{Mode: reconcile.ModeRepair},
+			ExpectedMode:    reconcile.ModeRepair,
+			ExpectedWarning: true,
+		},
+		{
+			Name:         "Nothing to report",
+			Clean:        true,
+			ExpectedMode: reconcile.ModeDryRun,
+		},
+		{
+			Name:            "Reconciler error",
+			ReconcilerError: true,
+			ExpectedMode:    reconcile.ModeDryRun,
+			ExpectedError:   true,
+		},
+		{
+			Name:          "Output error",
+			OutputError:   true,
+			ExpectedMode:  reconcile.ModeDryRun,
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			core, logs := observer.New(zap.InfoLevel)
+
+			mode := ""
+			saved := []reconcile.Report{}
+			h, err := NewHandler(zap.New(core), MockReconciler{isError: tt.ReconcilerError, clean: tt.Clean, mode: &mode}, MockOutput{isError: tt.OutputError, saved: &saved})
+			assert.Nil(t, err)
+
+			_, err = h.Handle(context.Background(), tt.Request)
+			assert.Equal(t, tt.ExpectedError, err != nil)
+			assert.Equal(t, tt.ExpectedMode, mode)
+			if !tt.ExpectedError {
+				assert.Len(t, saved, 1)
+			}
+
+			l := logs.FilterMessage("Cognito and bk-user-api disagree").All()
+			if !tt.ExpectedWarning {
+				assert.Empty(t, l)
+				return
+			}
+
+			// Logged hashed, never as they are
+			assert.Len(t, l, 1)
+			assert.Equal(t, []interface{}{
+				reconcile.DriftMissingRecord + " " + logging.HashEmail("abc@gmail.com"),
+				reconcile.DriftMissingRecord + " " + logging.HashEmail("def@gmail.com"),
+			}, l[0].ContextMap()["drift"])
+			assert.NotContains(t, fmt.Sprint(l[0].ContextMap()), "@gmail.com")
+		})
+	}
+}
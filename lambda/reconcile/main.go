@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	"github.com/benjaminkitson/bk-auth-api/lambda/reconcile/handler"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/reconcile"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		UserPoolID string `config:"COGNITO_USER_POOL_ID,required"`
+		// Reports aren't saved without one
+		ReportBucket string `config:"REPORT_BUCKET"`
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+
+	start.Event("reconcile", func(ctx context.Context, inv start.Invocation) (func(context.Context, handler.Request) (reconcile.Report, error), error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		// Listing users doesn't need the app client
+		ca := cognito.NewAdapter(cc, "", cfg.UserPoolID, inv.Logger)
+
+		var output handler.Output = reconcile.Discard
+		if cfg.ReportBucket != "" {
+			output = reconcile.NewS3Output(s3.NewFromConfig(sdkConfig), cfg.ReportBucket, "reconciliation/")
+		}
+
+		rc := reconcile.NewReconciler(inv.Logger, ca, outboxConfig.Store)
+		h, err := handler.NewHandler(inv.Logger, rc, output)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg))
+}
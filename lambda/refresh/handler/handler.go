@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"refreshToken": {validation.MaxLength(4096)},
+}
+
+type handler struct {
+	refresh auth.AdapterHandler
+	logger  *zap.Logger
+	session utils.SessionConfig
+}
+
+/*
+Issues new access and ID tokens for a refresh token, taken from the body or, in cookie mode, the refresh token cookie
+*/
+func NewHandler(logger *zap.Logger, r auth.AdapterHandler, session utils.SessionConfig) (handler, error) {
+	return handler{
+		refresh: r,
+		logger:  logger,
+		session: session,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	// Cookie mode clients have nothing to send in the body
+	if request.Body != "" {
+		err := json.Unmarshal([]byte(request.Body), &bodyMap)
+		if err != nil {
+			handler.logger.Error("Error parsing request body", zap.Error(err))
+			return utils.RESPONSE_400, nil
+		}
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid refresh request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	if bodyMap["refreshToken"] == "" {
+		t, err := handler.session.RefreshToken(request)
+		if errors.Is(err, utils.ErrCSRF) {
+			handler.logger.Error("Session cookie without a valid CSRF token", zap.Error(err))
+			return utils.RESPONSE_403, nil
+		}
+		bodyMap["refreshToken"] = t
+	}
+	if bodyMap["refreshToken"] == "" {
+		handler.logger.Error("No refresh token supplied")
+		return utils.RESPONSE_401, nil
+	}
+
+	d, err := handler.refresh(ctx, bodyMap)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		handler.logger.Error("Refresh token rejected", zap.Error(err))
+		return utils.RESPONSE_401, nil
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	var cookies []string
+	if handler.session.Cookies {
+		cookies, d, err = handler.session.ForRequest(request).TokenCookies(d)
+		if err != nil {
+			handler.logger.Error("Failed to create session cookies", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+	}
+
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("refresh error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.WithCookies(utils.RESPONSE_200(string(r)), cookies), nil
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) Refresh(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	if body["refreshToken"] != "mockRefreshToken" {
+		return nil, fmt.Errorf("%w: Invalid Refresh Token", auth.ErrInvalidToken)
+	}
+	return map[string]string{
+		"message":   "Successfully signed in!",
+		"token":     "mockToken",
+		"expiresIn": "3600",
+	}, nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		Cookies            bool
+		Cookie             string
+		CSRFToken          string
+		RequestBody        string
+		ExpectedStatusCode int
+		ExpectedCookies    int
+	}
+
+	tests := []test{
+		{
+			Name:               "Refresh success",
+			RequestBody:        "{\"refreshToken\": \"mockRefreshToken\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Refresh malformed body",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Refresh cookie mode",
+			Cookies:            true,
+			Cookie:             "bk_refresh_token=mockRefreshToken; bk_csrf=csrf",
+			CSRFToken:          "csrf",
+			ExpectedStatusCode: 200,
+			ExpectedCookies:    1,
+		},
+		{
+			Name:               "Refresh cookie mode without CSRF token",
+			Cookies:            true,
+			Cookie:             "bk_refresh_token=mockRefreshToken; bk_csrf=csrf",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "Refresh cookie outside cookie mode",
+			Cookie:             "bk_refresh_token=mockRefreshToken; bk_csrf=csrf",
+			CSRFToken:          "csrf",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Refresh token rejected",
+			RequestBody:        "{\"refreshToken\": \"revoked\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Refresh auth provider adapter error",
+			AdapterError:       true,
+			RequestBody:        "{\"refreshToken\": \"mockRefreshToken\"}",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			h, err := NewHandler(l, m.Refresh, utils.SessionConfig{Cookies: tt.Cookies, RefreshPath: "/refresh"})
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers: map[string]string{
+					"Content-Type": "application/json",
+					"Cookie":       tt.Cookie,
+					"X-CSRF-Token": tt.CSRFToken,
+				},
+				Body: tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			assert.Len(t, r.MultiValueHeaders["Set-Cookie"], tt.ExpectedCookies)
+			if tt.ExpectedStatusCode == 200 {
+				assert.Equal(t, !tt.Cookies, strings.Contains(r.Body, "mockToken"))
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+type PasswordChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error)
+	Reset(ctx context.Context, keys ...ratelimit.Key) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email":    {validation.Required, validation.Email},
+	"code":     {validation.Required, validation.Code},
+	"password": {validation.Required, validation.Password},
+}
+
+type handler struct {
+	resetPassword auth.AdapterHandler
+	limiter       RateLimiter
+	logger        *zap.Logger
+	passwords     PasswordChecker
+	publisher     userevents.Publisher
+}
+
+/*
+Sets a new password using the code sent by the forgot password handler. The new password is screened against known
+breaches before it reaches the auth provider, and attempts are limited by email and IP so the code can't be guessed.
+*/
+func NewHandler(logger *zap.Logger, r auth.AdapterHandler, passwords PasswordChecker, publisher userevents.Publisher, l RateLimiter) (handler, error) {
+	return handler{
+		resetPassword: r,
+		limiter:       l,
+		logger:        logger,
+		passwords:     passwords,
+		publisher:     publisher,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err := json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid reset password request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	// Limited by email too, as code guessing is spread across many IPs
+	keys := []ratelimit.Key{ratelimit.IP(request.RequestContext.Identity.SourceIP), ratelimit.Email(bodyMap["email"])}
+	wait, err := handler.limiter.Allow(ctx, keys...)
+	if err != nil {
+		// An unavailable store shouldn't stop everyone from resetting their password
+		handler.logger.Error("Failed to check rate limit", zap.Error(err))
+	}
+	if wait > 0 {
+		handler.logger.Warn("Rate limited reset password request", zap.String("sourceIp", request.RequestContext.Identity.SourceIP), zap.Duration("retryAfter", wait))
+		return utils.RESPONSE_429(wait), nil
+	}
+
+	breached, err := handler.passwords.Breached(ctx, bodyMap["password"])
+	if err != nil {
+		handler.logger.Error("Password breach check failed", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	if breached {
+		handler.logger.Info("Password reset with breached password rejected")
+		return utils.RESPONSE_PASSWORD_BREACHED, nil
+	}
+
+	d, err := handler.resetPassword(ctx, bodyMap)
+	var re auth.RequestError
+	if errors.As(err, &re) {
+		handler.logger.Error("Password reset rejected", zap.String("code", re.Code))
+		return utils.RESPONSE_ERROR(400, re.Code, re.Message), nil
+	}
+	if err != nil {
+		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	err = handler.limiter.Reset(ctx, ratelimit.Email(bodyMap["email"]))
+	if err != nil {
+		handler.logger.Error("Failed to reset rate limit", zap.Error(err))
+	}
+
+	if err := handler.publisher.Publish(ctx, userevents.PasswordChanged(bodyMap["email"], userevents.PasswordChangedByReset)); err != nil {
+		// The password has changed regardless, so this isn't worth failing the request over
+		handler.logger.Error("Failed to publish password changed event", zap.Error(err))
+	}
+
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("reset password error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) ConfirmForgotPassword(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	if body["code"] == "000000" {
+		return nil, auth.RequestError{Code: auth.ErrCodeInvalidCode, Message: "Invalid or expired code"}
+	}
+	return map[string]string{
+		"message": "Successfully reset password",
+	}, nil
+}
+
+type MockPasswordChecker struct {
+	isError bool
+}
+
+func (mc MockPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	if mc.isError {
+		return false, fmt.Errorf("Password checker error")
+	}
+	return password == "Password1", nil
+}
+
+type MockRateLimiter struct {
+	isError    bool
+	retryAfter time.Duration
+	keys       *[]ratelimit.Key
+}
+
+func (m MockRateLimiter) Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error) {
+	if m.keys != nil {
+		*m.keys = append(*m.keys, keys...)
+	}
+	if m.isError {
+		return 0, fmt.Errorf("Rate limit store error")
+	}
+	return m.retryAfter, nil
+}
+
+func (m MockRateLimiter) Reset(ctx context.Context, keys ...ratelimit.Key) error {
+	return nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		CheckerError       bool
+		RequestBody        string
+		RateLimited        bool
+		RateLimiterError   bool
+		ExpectedStatusCode int
+		ExpectedCode       string
+	}
+
+	tests := []test{
+		{
+			Name:               "Reset password success",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Reset password malformed body",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Reset password doesn't meet policy",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"abcabc123\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Reset password missing code",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Reset password breached password",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Password1\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodePasswordBreached,
+		},
+		{
+			Name:               "Reset password wrong code",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"000000\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeInvalidCode,
+		},
+		{
+			Name:               "Reset password password checker error",
+			CheckerError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Reset password auth provider adapter error",
+			AdapterError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 500,
+		},
+		{
+			Name:               "Reset password rate limited",
+			RateLimited:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 429,
+		},
+		{
+			Name:               "Reset password rate limiter error",
+			RateLimiterError:   true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\", \"password\": \"Abcabc123\"}",
+			ExpectedStatusCode: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			p := userevents.NewMemoryPublisher()
+			keys := []ratelimit.Key{}
+			rl := MockRateLimiter{isError: tt.RateLimiterError, keys: &keys}
+			if tt.RateLimited {
+				rl.retryAfter = 90 * time.Second
+			}
+
+			h, err := NewHandler(l, m.ConfirmForgotPassword, MockPasswordChecker{isError: tt.CheckerError}, p, rl)
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
+				Body:       tt.RequestBody,
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			if tt.RateLimited {
+				// Limited by the user as well as the IP
+				assert.Contains(t, keys, ratelimit.Email("abc@gmail.com"))
+			}
+
+			// Only successful requests publish an event
+			if tt.ExpectedStatusCode == 200 {
+				assert.Len(t, p.Events(), 1)
+				assert.Equal(t, userevents.TypePasswordChanged, p.Events()[0].Type)
+			} else {
+				assert.Empty(t, p.Events())
+			}
+			if tt.ExpectedCode != "" {
+				assert.Contains(t, r.Body, tt.ExpectedCode)
+			}
+		})
+	}
+}
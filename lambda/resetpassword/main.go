@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/breach"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/lambda/resetpassword/handler"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
+)
+
+func main() {
+	var cfg struct {
+		appconfig.Cognito
+		appconfig.RateLimit
+	}
+	publisher, err := userevents.PublisherFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise event publisher, events will be dropped: %v", err)
+		publisher = userevents.Discard
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+	breachConfig := breach.ConfigFromEnv()
+	// Kept between invocations, so the range API connection or range file is reused
+	ranges, rangesErr := breachConfig.RangeClient()
+
+	// Only used without a RATE_LIMIT_TABLE, it lives outside the handler function to last between invocations
+	memoryStore := ratelimit.NewMemoryStore()
+
+	start.API(string(audit.ActionPasswordReset), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		var store ratelimit.Store = memoryStore
+		if cfg.RateLimit.Table != "" {
+			ds, err := ratelimit.NewDynamoDBStore(dynamodb.NewFromConfig(sdkConfig), cfg.RateLimit.Table)
+			if err != nil {
+				return nil, fmt.Errorf("initialising rate limit store: %w", err)
+			}
+			store = ds
+		}
+		limiter := ratelimit.NewLimiter(inv.Logger, store, ratelimit.DefaultPolicies)
+
+		if rangesErr != nil {
+			return nil, fmt.Errorf("initialising password range client: %w", rangesErr)
+		}
+		pc := breach.NewChecker(inv.Logger, ranges, breachConfig)
+
+		// Events are written to the outbox first, so the relay retries any that fail to publish
+		ob := outbox.New(inv.Logger, outboxConfig, outbox.Deliverers{
+			outbox.KindPublishEvent: outbox.NewEventDeliverer(publisher),
+		})
+
+		h, err := handler.NewHandler(inv.Logger, ca.ConfirmForgotPassword, pc, ob.Publisher(), limiter)
+		if err != nil {
+			return nil, err
+		}
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+	"go.uber.org/zap"
+)
+
+var guard = utils.Guard{Methods: []string{http.MethodGet, http.MethodPost, http.MethodDelete}}
+
+var listSchema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+}
+
+var schema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+	"role":  {validation.Required, validation.OneOf(auth.Roles...)},
+}
+
+type handler struct {
+	groupManager auth.GroupManager
+	logger       *zap.Logger
+}
+
+/*
+Manages user roles. GET lists a user's roles, POST grants one and DELETE revokes one. Only admins may call it.
+*/
+func NewHandler(logger *zap.Logger, g auth.GroupManager) (handler, error) {
+	return handler{
+		groupManager: g,
+		logger:       logger,
+	}, nil
+}
+
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
+	// Role changes are security relevant, so attempts are audited as such whether or not they succeed
+	change := handler.groupManager.AddUserToGroup
+	switch request.HTTPMethod {
+	case http.MethodGet:
+		audit.SetSubject(ctx, request.QueryStringParameters["email"])
+	case http.MethodPost:
+		audit.SetAction(ctx, audit.ActionRoleAdd)
+		metrics.SetOperation(ctx, string(audit.ActionRoleAdd))
+	case http.MethodDelete:
+		audit.SetAction(ctx, audit.ActionRoleRemove)
+		metrics.SetOperation(ctx, string(audit.ActionRoleRemove))
+		change = handler.groupManager.RemoveUserFromGroup
+	}
+
+	err := auth.RequireRole(request, auth.RoleAdmin)
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		handler.logger.Error("No verified claims on request")
+		return utils.RESPONSE_401, nil
+	}
+	if err != nil {
+		handler.logger.Error("Caller is not an admin", logging.Email("caller", auth.Caller(request)))
+		return utils.RESPONSE_403, nil
+	}
+
+	if request.HTTPMethod == http.MethodGet {
+		if errs := listSchema.Validate(request.QueryStringParameters); errs != nil {
+			handler.logger.Error("Invalid roles request", zap.Error(errs))
+			return utils.RESPONSE_VALIDATION(errs), nil
+		}
+		d, err := handler.groupManager.ListGroupsForUser(ctx, map[string]string{"email": request.QueryStringParameters["email"]})
+		if err != nil {
+			handler.logger.Error("Error listing groups for user", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+		r, err := json.Marshal(d)
+		if err != nil {
+			handler.logger.Error("roles error", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+		return utils.RESPONSE_200(string(r)), nil
+	}
+
+	bodyMap := make(map[string]string)
+
+	err = json.Unmarshal([]byte(request.Body), &bodyMap)
+	if err != nil {
+		handler.logger.Error("Error parsing request body", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid roles request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	audit.SetDetail(ctx, "role", bodyMap["role"])
+
+	d, err := change(ctx, map[string]string{
+		"email": bodyMap["email"],
+		"group": bodyMap["role"],
+	})
+	if err != nil {
+		handler.logger.Error("Error changing user role", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+
+	r, err := json.Marshal(d)
+	if err != nil {
+		handler.logger.Error("roles error", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	return utils.RESPONSE_200(string(r)), nil
+}
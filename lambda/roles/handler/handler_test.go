@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type MockAdapter struct {
+	isError bool
+}
+
+func (ma MockAdapter) AddUserToGroup(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{"message": "Successfully added user to group"}, nil
+}
+
+func (ma MockAdapter) RemoveUserFromGroup(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{"message": "Successfully removed user from group"}, nil
+}
+
+func (ma MockAdapter) ListGroupsForUser(ctx context.Context, body map[string]string) (map[string]string, error) {
+	if ma.isError {
+		return nil, fmt.Errorf("Auth provider error")
+	}
+	return map[string]string{"groups": "member"}, nil
+}
+
+/*
+Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
+*/
+func TestHandler(t *testing.T) {
+	type test struct {
+		Name               string
+		AdapterError       bool
+		Groups             string
+		Method             string
+		RequestBody        string
+		Query              map[string]string
+		ExpectedStatusCode int
+	}
+
+	tests := []test{
+		{
+			Name:               "Grant role success",
+			Groups:             "admin",
+			Method:             "POST",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"support\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Grant role malformed body",
+			Groups:             "admin",
+			Method:             "POST",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Revoke role success",
+			Groups:             "admin",
+			Method:             "DELETE",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"support\"}",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "List roles success",
+			Groups:             "admin",
+			Method:             "GET",
+			Query:              map[string]string{"email": "abc@gmail.com"},
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "List roles without an email",
+			Groups:             "admin",
+			Method:             "GET",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Unknown role",
+			Groups:             "admin",
+			Method:             "POST",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"superuser\"}",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Caller is not an admin",
+			Groups:             "support",
+			Method:             "POST",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"admin\"}",
+			ExpectedStatusCode: 403,
+		},
+		{
+			Name:               "No verified claims",
+			Method:             "POST",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"admin\"}",
+			ExpectedStatusCode: 401,
+		},
+		{
+			Name:               "Grant role auth provider adapter error",
+			AdapterError:       true,
+			Groups:             "admin",
+			Method:             "POST",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"role\": \"support\"}",
+			ExpectedStatusCode: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			l, err := zap.NewDevelopment()
+			if err != nil {
+				t.Fatalf("Failed to initialise dev logger")
+			}
+
+			m := MockAdapter{
+				isError: tt.AdapterError,
+			}
+
+			h, err := NewHandler(l, m)
+			assert.Nil(t, err)
+
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod:            tt.Method,
+				Headers:               map[string]string{"Content-Type": "application/json"},
+				Body:                  tt.RequestBody,
+				QueryStringParameters: tt.Query,
+			}
+			if tt.Groups != "" {
+				req.RequestContext.Authorizer = map[string]interface{}{
+					"claims": map[string]interface{}{"cognito:groups": tt.Groups, "email": "admin@gmail.com"},
+				}
+			}
+
+			r, err := h.Handle(context.Background(), req)
+			assert.Nil(t, err)
+
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+		})
+	}
+}
+
+// Role changes are audited with who made them, who they were made to, and the role
+func TestAudit(t *testing.T) {
+	h, err := NewHandler(zap.NewNop(), MockAdapter{})
+	assert.Nil(t, err)
+
+	p := filepath.Join(t.TempDir(), "audit.jsonl")
+	recorder := audit.NewRecorder(audit.NewFileSink(p), audit.DefaultQueueSize)
+
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: "DELETE",
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       "{\"email\": \"abc@gmail.com\", \"role\": \"support\"}",
+	}
+	req.RequestContext.Authorizer = map[string]interface{}{
+		"claims": map[string]interface{}{"cognito:groups": "admin", "email": "admin@gmail.com"},
+	}
+
+	r, err := recorder.Wrap(audit.ActionRoleList, h.Handle)(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.NoError(t, recorder.Flush(context.Background()))
+
+	events, err := audit.ReadFile(p)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, audit.ActionRoleRemove, events[0].Action)
+	assert.Equal(t, audit.OutcomeSuccess, events[0].Outcome)
+	assert.Equal(t, logging.HashEmail("admin@gmail.com"), events[0].Actor)
+	assert.Equal(t, logging.HashEmail("abc@gmail.com"), events[0].Subject)
+	assert.Equal(t, map[string]string{"role": "support"}, events[0].Detail)
+}
@@ -3,11 +3,15 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
 	"github.com/benjaminkitson/bk-auth-api/utils/auth"
 	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
 	"github.com/benjaminkitson/bk-user-api/models"
 	"go.uber.org/zap"
 )
@@ -16,23 +20,42 @@ type UserAPIClient interface {
 	CreateUser(ctx context.Context, email string) (models.User, error)
 }
 
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error)
+	Reset(ctx context.Context, keys ...ratelimit.Key) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email":    {validation.Required, validation.Email},
+	"password": {validation.Required, validation.ExistingPassword},
+}
+
 type handler struct {
-	signIn auth.AdapterHandler
-	logger *zap.Logger
+	signIn  auth.AdapterHandler
+	limiter RateLimiter
+	logger  *zap.Logger
+	session utils.SessionConfig
 }
 
-func NewHandler(logger *zap.Logger, si auth.AdapterHandler) (handler, error) {
+func NewHandler(logger *zap.Logger, si auth.AdapterHandler, l RateLimiter, session utils.SessionConfig) (handler, error) {
 	return handler{
-		signIn: si,
-		logger: logger,
+		signIn:  si,
+		limiter: l,
+		logger:  logger,
+		session: session,
 	}, nil
 }
 
 // TODO: make distinction between 400 and 500 errors
-// TODO: understand how different methods are dealt with (post vs get etc)
-// TODO: probably incorporate some sort of request body validation prior to calling cognito or whichever auth provider
 
-func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
+
 	// TODO: Path check? Not sure if needed
 	// handler.logger.Error("invalid path", zap.String("path", request.Path))
 	// return utils.RESPONSE_400, nil
@@ -42,18 +65,54 @@ func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyR
 	err := json.Unmarshal([]byte(request.Body), &bodyMap)
 	if err != nil {
 		handler.logger.Error("Error parsing request body", zap.Error(err))
-		return utils.RESPONSE_500, fmt.Errorf("error parsing request body")
+		return utils.RESPONSE_400, nil
 	}
 
-	d, err := handler.signIn(bodyMap)
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid sign in request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	// Limited by email too, as credential stuffing and code guessing are spread across many IPs
+	keys := []ratelimit.Key{ratelimit.IP(request.RequestContext.Identity.SourceIP), ratelimit.Email(bodyMap["email"])}
+	wait, err := handler.limiter.Allow(ctx, keys...)
+	if err != nil {
+		// An unavailable store shouldn't stop everyone from signing in
+		handler.logger.Error("Failed to check rate limit", zap.Error(err))
+	}
+	if wait > 0 {
+		handler.logger.Warn("Rate limited sign in request", zap.String("sourceIp", request.RequestContext.Identity.SourceIP), zap.Duration("retryAfter", wait))
+		return utils.RESPONSE_429(wait), nil
+	}
+
+	d, err := handler.signIn(ctx, bodyMap)
 	if err != nil {
 		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		// e.g. NotAuthorizedException for a wrong password
+		metrics.SetErrorCode(ctx, metrics.ErrorCode(err))
 		return utils.RESPONSE_500, nil
 	}
+
+	// The IP's attempts still count, it might be trying lots of accounts
+	err = handler.limiter.Reset(ctx, ratelimit.Email(bodyMap["email"]))
+	if err != nil {
+		handler.logger.Error("Failed to reset rate limit", zap.Error(err))
+	}
+
+	// Challenges don't come with tokens, so there's nothing to put in cookies yet
+	var cookies []string
+	if handler.session.Cookies && d["token"] != "" {
+		cookies, d, err = handler.session.ForRequest(request).TokenCookies(d)
+		if err != nil {
+			handler.logger.Error("Failed to create session cookies", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+	}
+
 	r, err := json.Marshal(d)
 	if err != nil {
 		handler.logger.Error("signin error", zap.Error(err))
 		return utils.RESPONSE_500, nil
 	}
-	return utils.RESPONSE_200(string(r)), nil
+	return utils.WithCookies(utils.RESPONSE_200(string(r)), cookies), nil
 }
@@ -3,9 +3,15 @@ package handler
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/smithy-go"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -14,15 +20,34 @@ type MockAdapter struct {
 	isError bool
 }
 
-func (ma MockAdapter) SignIn(body map[string]string) (map[string]string, error) {
+func (ma MockAdapter) SignIn(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if ma.isError {
-		return nil, fmt.Errorf("Auth provider error")
+		return nil, &smithy.GenericAPIError{Code: "NotAuthorizedException", Message: "Incorrect username or password."}
 	}
 	return map[string]string{
-		"message": "Successfully signed in!",
+		"message":      "Successfully signed in!",
+		"token":        "mockToken",
+		"refreshToken": "mockRefreshToken",
+		"idToken":      "mockIdToken",
 	}, nil
 }
 
+type MockRateLimiter struct {
+	isError    bool
+	retryAfter time.Duration
+}
+
+func (m MockRateLimiter) Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error) {
+	if m.isError {
+		return 0, fmt.Errorf("Rate limit store error")
+	}
+	return m.retryAfter, nil
+}
+
+func (m MockRateLimiter) Reset(ctx context.Context, keys ...ratelimit.Key) error {
+	return nil
+}
+
 /*
 Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
 */
@@ -30,8 +55,15 @@ func TestHandler(t *testing.T) {
 	type test struct {
 		Name               string
 		AdapterError       bool
+		Method             string
+		Cookies            bool
+		RateLimited        bool
+		RateLimiterError   bool
 		RequestBody        string
 		ExpectedStatusCode int
+		ExpectedCookies    int
+		ExpectedOutcome    metrics.Outcome
+		ExpectedErrorCode  string
 	}
 
 	tests := []test{
@@ -39,12 +71,60 @@ func TestHandler(t *testing.T) {
 			Name:               "Sign in success",
 			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
 			ExpectedStatusCode: 200,
+			ExpectedOutcome:    metrics.OutcomeSuccess,
+			ExpectedErrorCode:  "None",
+		},
+		{
+			Name:               "Sign in malformed body",
+			RequestBody:        "{\"email\": ",
+			ExpectedStatusCode: 400,
+			ExpectedOutcome:    metrics.OutcomeRejected,
+			ExpectedErrorCode:  "400",
+		},
+		{
+			Name:               "Sign in cookie mode",
+			Cookies:            true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			ExpectedStatusCode: 200,
+			ExpectedCookies:    3,
+			ExpectedOutcome:    metrics.OutcomeSuccess,
+			ExpectedErrorCode:  "None",
 		},
 		{
 			Name:               "Sign in auth provider adapter error",
 			AdapterError:       true,
 			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
 			ExpectedStatusCode: 500,
+			ExpectedOutcome:    metrics.OutcomeFailure,
+			ExpectedErrorCode:  "NotAuthorizedException",
+		},
+		{
+			Name:               "Sign in wrong method",
+			Method:             "GET",
+			ExpectedStatusCode: 405,
+			ExpectedOutcome:    metrics.OutcomeRejected,
+			ExpectedErrorCode:  "405",
+		},
+		{
+			Name:               "Sign in preflight",
+			Method:             "OPTIONS",
+			ExpectedStatusCode: 204,
+		},
+		{
+			Name:               "Sign in rate limited",
+			RateLimited:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			ExpectedStatusCode: 429,
+			ExpectedOutcome:    metrics.OutcomeDenied,
+			ExpectedErrorCode:  "RATE_LIMITED",
+		},
+		{
+			Name:               "Sign in rate limiter error",
+			RateLimiterError:   true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			ExpectedStatusCode: 200,
+			ExpectedOutcome:    metrics.OutcomeSuccess,
+			ExpectedErrorCode:  "None",
 		},
 		// TODO: Ascertain if any kind of path check is really needed
 		// {
@@ -65,18 +145,56 @@ func TestHandler(t *testing.T) {
 				isError: tt.AdapterError,
 			}
 
-			h, err := NewHandler(l, m.SignIn)
+			rl := MockRateLimiter{isError: tt.RateLimiterError}
+			if tt.RateLimited {
+				rl.retryAfter = 90 * time.Second
+			}
+
+			h, err := NewHandler(l, m.SignIn, rl, utils.SessionConfig{Cookies: tt.Cookies, RefreshPath: "/refresh"})
 			assert.Nil(t, err)
 
+			method := tt.Method
+			if method == "" {
+				method = "POST"
+			}
+
 			req := events.APIGatewayProxyRequest{
+				HTTPMethod: method,
+				Headers:    map[string]string{"Content-Type": "application/json"},
 				// This test should probably fail if the body isn't the correct format?
-				Body: tt.RequestBody,
+				Body:           tt.RequestBody,
+				Resource:       "/signin",
+				RequestContext: events.APIGatewayProxyRequestContext{Path: "/prod/signin"},
 			}
 
-			r, err := h.Handle(context.Background(), req)
+			sink := metrics.NewTestSink()
+			r, err := metrics.New(sink).Wrap("sign_in", h.Handle)(context.Background(), req)
 			assert.Nil(t, err)
 
 			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			assert.Len(t, r.MultiValueHeaders["Set-Cookie"], tt.ExpectedCookies)
+			for _, c := range r.MultiValueHeaders["Set-Cookie"] {
+				// Served under the stage without a custom domain
+				if strings.HasPrefix(c, utils.RefreshTokenCookie+"=") {
+					assert.Contains(t, c, "Path=/prod/refresh")
+				}
+			}
+			if tt.RateLimited {
+				assert.Equal(t, "90", r.Headers["Retry-After"])
+			}
+			// Preflights aren't counted
+			if tt.ExpectedOutcome != "" {
+				d := metrics.Dimensions{Operation: "sign_in", Outcome: tt.ExpectedOutcome, ErrorCode: tt.ExpectedErrorCode}
+				assert.Equal(t, 1.0, sink.Sum(metrics.MetricRequests, d))
+			} else {
+				assert.Empty(t, sink.Entries())
+			}
+			// Tokens go in either the body or cookies, never both
+			if tt.ExpectedStatusCode == 200 {
+				assert.Equal(t, !tt.Cookies, strings.Contains(r.Body, "mockToken"))
+				assert.Equal(t, !tt.Cookies, strings.Contains(r.Body, "mockRefreshToken"))
+				assert.Contains(t, r.Body, "mockIdToken")
+			}
 		})
 	}
 }
@@ -4,56 +4,49 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
 	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
-	"github.com/benjaminkitson/bk-auth-api/cognitoadapter/env"
 	"github.com/benjaminkitson/bk-auth-api/lambda/signin/handler"
-	"github.com/benjaminkitson/bk-auth-api/secrets"
-	"go.uber.org/zap"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
 )
 
 func main() {
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		logger, err := zap.NewProduction()
+	var cfg struct {
+		appconfig.Cognito
+		appconfig.RateLimit
+	}
+	// Only used without a RATE_LIMIT_TABLE, it lives outside the handler function to last between invocations
+	memoryStore := ratelimit.NewMemoryStore()
+	session := utils.SessionConfigFromEnv()
+
+	start.API(string(audit.ActionSignIn), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
 		if err != nil {
-			fmt.Printf("Failed to initialise logger: %v", err)
-			logger = &zap.Logger{}
-		}
-		defer logger.Sync()
-
-		sdkConfig, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			logger.Error("Failed to intialise SDK config", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
-		}
-
-		sm := secretsmanager.NewFromConfig(sdkConfig)
-		sc, err := secrets.NewSecretsClient(logger, sm)
-		if err != nil {
-			logger.Error("failed to initialise secrets client", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
 
 		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
-		// TODO: investigate just storing this as an env var from the CDK
-		ccid, err := sc.GetSecret("COGNITO_CLIENT")
-		if err != nil {
-			logger.Error("Failed to get cognito client id", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		var store ratelimit.Store = memoryStore
+		if cfg.RateLimit.Table != "" {
+			ds, err := ratelimit.NewDynamoDBStore(dynamodb.NewFromConfig(sdkConfig), cfg.RateLimit.Table)
+			if err != nil {
+				return nil, fmt.Errorf("initialising rate limit store: %w", err)
+			}
+			store = ds
 		}
+		limiter := ratelimit.NewLimiter(inv.Logger, store, ratelimit.DefaultPolicies)
 
-		p := env.PoolID
-		ca := cognito.NewAdapter(cc, ccid, p, logger)
-
-		h, err := handler.NewHandler(logger, ca.SignIn)
+		h, err := handler.NewHandler(inv.Logger, ca.SignIn, limiter, session)
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
-
-		return h.Handle(ctx, request)
-	})
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
 }
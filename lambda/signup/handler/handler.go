@@ -3,11 +3,15 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"net/http"
 
 	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
 	"github.com/benjaminkitson/bk-auth-api/utils/auth"
 	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
 	"github.com/benjaminkitson/bk-user-api/models"
 	"go.uber.org/zap"
 )
@@ -16,23 +20,40 @@ type UserAPIClient interface {
 	CreateUser(ctx context.Context, email string) (models.User, error)
 }
 
+type PasswordChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email":    {validation.Required, validation.Email},
+	"password": {validation.Required, validation.Password},
+}
+
 type handler struct {
-	signUp auth.AdapterHandler
-	logger *zap.Logger
+	signUp    auth.AdapterHandler
+	logger    *zap.Logger
+	passwords PasswordChecker
+	publisher userevents.Publisher
 }
 
 // TODO: The adapterHandler being tied to the cognito package sort of defeats the purpose
-func NewHandler(logger *zap.Logger, su auth.AdapterHandler) (handler, error) {
+func NewHandler(logger *zap.Logger, su auth.AdapterHandler, passwords PasswordChecker, publisher userevents.Publisher) (handler, error) {
 	return handler{
-		signUp: su,
-		logger: logger,
+		signUp:    su,
+		logger:    logger,
+		passwords: passwords,
+		publisher: publisher,
 	}, nil
 }
 
-// TODO: understand how different methods are dealt with (post vs get etc)
-// TODO: probably incorporate some sort of request body validation prior to calling cognito or whichever auth provider
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
 
-func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// TODO: Path check? Not sure if needed
 	// handler.logger.Error("invalid path", zap.String("path", request.Path))
 	// return utils.RESPONSE_400, nil
@@ -42,14 +63,45 @@ func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyR
 	err := json.Unmarshal([]byte(request.Body), &bodyMap)
 	if err != nil {
 		handler.logger.Error("Error parsing request body", zap.Error(err))
-		return utils.RESPONSE_500, fmt.Errorf("error parsing request body")
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid sign up request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	breached, err := handler.passwords.Breached(ctx, bodyMap["password"])
+	if err != nil {
+		handler.logger.Error("Password breach check failed", zap.Error(err))
+		return utils.RESPONSE_500, nil
+	}
+	if breached {
+		handler.logger.Info("Sign up with breached password rejected")
+		return utils.RESPONSE_PASSWORD_BREACHED, nil
 	}
 
-	d, err := handler.signUp(bodyMap)
+	d, err := handler.signUp(ctx, bodyMap)
+	var re auth.RequestError
+	if errors.As(err, &re) {
+		handler.logger.Error("Sign up rejected", zap.String("code", re.Code))
+		return utils.RESPONSE_ERROR(400, re.Code, re.Message), nil
+	}
+	if errors.Is(err, auth.ErrInvalidRequest) {
+		handler.logger.Error("Invalid sign up request", zap.Error(err))
+		return utils.RESPONSE_400, nil
+	}
 	if err != nil {
 		handler.logger.Error("Failed to get response body from Cognito adapter", zap.Error(err))
+		metrics.SetErrorCode(ctx, metrics.ErrorCode(err))
 		return utils.RESPONSE_500, nil
 	}
+
+	if err := handler.publisher.Publish(ctx, userevents.UserSignedUp(bodyMap["email"])); err != nil {
+		// The user has signed up regardless, so this isn't worth failing the request over
+		handler.logger.Error("Failed to publish user signed up event", zap.Error(err))
+	}
+
 	r, err := json.Marshal(d)
 	if err != nil {
 		handler.logger.Error("signup error", zap.Error(err))
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -14,15 +16,32 @@ type MockAdapter struct {
 	isError bool
 }
 
-func (ma MockAdapter) SignUp(body map[string]string) (map[string]string, error) {
+func (ma MockAdapter) SignUp(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if ma.isError {
 		return nil, fmt.Errorf("Auth provider error")
 	}
+	if body["email"] == "abc@mailinator.com" {
+		return nil, auth.RequestError{Code: auth.ErrCodeDisposableEmail, Message: "Disposable email addresses are not allowed"}
+	}
+	if _, ok := body["email_verified"]; ok {
+		return nil, fmt.Errorf("%w: attribute email_verified cannot be set", auth.ErrInvalidRequest)
+	}
 	return map[string]string{
 		"message": "Successfully signed up!",
 	}, nil
 }
 
+type MockPasswordChecker struct {
+	isError bool
+}
+
+func (mc MockPasswordChecker) Breached(ctx context.Context, password string) (bool, error) {
+	if mc.isError {
+		return false, fmt.Errorf("Password checker error")
+	}
+	return password == "Password1", nil
+}
+
 /*
 Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
 */
@@ -30,23 +49,78 @@ func TestHandler(t *testing.T) {
 	type test struct {
 		Name               string
 		AdapterError       bool
+		CheckerError       bool
 		RequestBody        string
 		RequestPath        string
 		ExpectedStatusCode int
+		ExpectedCode       string
 	}
 
 	tests := []test{
 
 		{
 			Name:               "Sign up success",
-			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 200,
+		},
+		{
+			Name:               "Sign up malformed body",
+			RequestBody:        "{\"email\": ",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Sign up with attributes success",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\", \"locale\": \"en-GB\", \"tenant\": \"bk\"}",
 			RequestPath:        "/signup",
 			ExpectedStatusCode: 200,
 		},
+		{
+			Name:               "Sign up privileged attribute",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\", \"email_verified\": \"true\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Sign up rejected email domain",
+			RequestBody:        "{\"email\": \"abc@mailinator.com\", \"password\": \"Abcabc123\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeDisposableEmail,
+		},
+		{
+			Name:               "Sign up password doesn't meet policy",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Sign up invalid email",
+			RequestBody:        "{\"email\": \"abc\", \"password\": \"Abcabc123\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodeValidationFailed,
+		},
+		{
+			Name:               "Sign up breached password",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Password1\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 400,
+			ExpectedCode:       auth.ErrCodePasswordBreached,
+		},
+		{
+			Name:               "Sign up password checker error",
+			CheckerError:       true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\"}",
+			RequestPath:        "/signup",
+			ExpectedStatusCode: 500,
+		},
 		{
 			Name:               "Sign up auth provider adapter error",
 			AdapterError:       true,
-			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"abcabc123\"}",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"Abcabc123\"}",
 			RequestPath:        "/signup",
 			ExpectedStatusCode: 500,
 		},
@@ -69,10 +143,13 @@ func TestHandler(t *testing.T) {
 				isError: tt.AdapterError,
 			}
 
-			h, err := NewHandler(l, m.SignUp)
+			p := userevents.NewMemoryPublisher()
+			h, err := NewHandler(l, m.SignUp, MockPasswordChecker{isError: tt.CheckerError}, p)
 			assert.Nil(t, err)
 
 			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
 				// This test should probably fail if the body isn't the correct format?
 				Body: tt.RequestBody,
 			}
@@ -81,6 +158,17 @@ func TestHandler(t *testing.T) {
 			assert.Nil(t, err)
 
 			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+
+			// Only successful requests publish an event
+			if tt.ExpectedStatusCode == 200 {
+				assert.Len(t, p.Events(), 1)
+				assert.Equal(t, userevents.TypeUserSignedUp, p.Events()[0].Type)
+			} else {
+				assert.Empty(t, p.Events())
+			}
+			if tt.ExpectedCode != "" {
+				assert.Contains(t, r.Body, tt.ExpectedCode)
+			}
 		})
 	}
 }
@@ -3,57 +3,61 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/breach"
 	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
-	"github.com/benjaminkitson/bk-auth-api/cognitoadapter/env"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
 	"github.com/benjaminkitson/bk-auth-api/lambda/signup/handler"
-	"github.com/benjaminkitson/bk-auth-api/secrets"
-	"go.uber.org/zap"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
 )
 
 func main() {
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		logger, err := zap.NewProduction()
+	var cfg struct {
+		appconfig.Cognito
+	}
+	publisher, err := userevents.PublisherFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise event publisher, events will be dropped: %v", err)
+		publisher = userevents.Discard
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+	breachConfig := breach.ConfigFromEnv()
+	// Kept between invocations, so the range API connection or range file is reused
+	ranges, rangesErr := breachConfig.RangeClient()
+
+	start.API(string(audit.ActionSignUp), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
 		if err != nil {
-			fmt.Printf("Failed to initialise logger: %v", err)
-			logger = &zap.Logger{}
-		}
-		defer logger.Sync()
-
-		sdkConfig, err := config.LoadDefaultConfig(context.TODO())
-		if err != nil {
-			logger.Error("Failed to intialise SDK config", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
-		}
-
-		sm := secretsmanager.NewFromConfig(sdkConfig)
-		sc, err := secrets.NewSecretsClient(logger, sm)
-		if err != nil {
-			logger.Error("failed to initialise secrets client", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
 
 		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
-		// TODO: investigate just storing this as an env var from the CDK
-		ccid, err := sc.GetSecret("COGNITO_CLIENT")
-		if err != nil {
-			logger.Error("Failed to get cognito client id", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
+
+		if rangesErr != nil {
+			return nil, fmt.Errorf("initialising password range client: %w", rangesErr)
 		}
+		pc := breach.NewChecker(inv.Logger, ranges, breachConfig)
 
-		p := env.PoolID
-		ca := cognito.NewAdapter(cc, ccid, p, logger)
+		// Events are written to the outbox first, so the relay retries any that fail to publish
+		ob := outbox.New(inv.Logger, outboxConfig, outbox.Deliverers{
+			outbox.KindPublishEvent: outbox.NewEventDeliverer(publisher),
+		})
 
-		h, err := handler.NewHandler(logger, ca.SignUp)
+		h, err := handler.NewHandler(inv.Logger, ca.SignUp, pc, ob.Publisher())
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
-
-		return h.Handle(ctx, request)
-	})
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
 }
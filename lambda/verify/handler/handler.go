@@ -3,37 +3,61 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
 	"github.com/benjaminkitson/bk-auth-api/utils/auth"
 	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
-	"github.com/benjaminkitson/bk-user-api/models"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
 	"go.uber.org/zap"
 )
 
-type UserAPIClient interface {
-	CreateUser(ctx context.Context, email string) (models.User, error)
+type Outbox interface {
+	Send(ctx context.Context, e outbox.Entry) (outbox.Sent, error)
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error)
+	Reset(ctx context.Context, keys ...ratelimit.Key) error
+}
+
+var guard = utils.Guard{Methods: []string{http.MethodPost}}
+
+var schema = validation.Schema{
+	"email": {validation.Required, validation.Email},
+	"code":  {validation.Required, validation.Code},
 }
 
 type handler struct {
 	authProviderAdapter auth.EmailVerifier
+	limiter             RateLimiter
 	logger              *zap.Logger
-	userAPIClient       UserAPIClient
+	outbox              Outbox
 }
 
-func NewHandler(logger *zap.Logger, a auth.EmailVerifier, c UserAPIClient) (handler, error) {
+/*
+Confirms the user's email, then creates their bk-user-api record through the outbox, so that if creating it fails the
+relay creates it later rather than the two getting out of sync
+*/
+func NewHandler(logger *zap.Logger, a auth.EmailVerifier, o Outbox, l RateLimiter) (handler, error) {
 	return handler{
 		authProviderAdapter: a,
+		limiter:             l,
 		logger:              logger,
-		userAPIClient:       c,
+		outbox:              o,
 	}, nil
 }
 
-// TODO: understand how different methods are dealt with (post vs get etc)
-// TODO: probably incorporate some sort of request body validation prior to calling cognito or whichever auth provider
+func (handler handler) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if r, ok := guard.Check(&request); !ok {
+		handler.logger.Info("Request stopped by guard", zap.String("method", request.HTTPMethod), zap.Int("statusCode", r.StatusCode))
+		return r, nil
+	}
 
-func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// TODO: Path check? Not sure if needed
 	// handler.logger.Error("invalid path", zap.String("path", request.Path))
 	// return utils.RESPONSE_400, nil
@@ -43,28 +67,56 @@ func (handler handler) Handle(_ context.Context, request events.APIGatewayProxyR
 	err := json.Unmarshal([]byte(request.Body), &bodyMap)
 	if err != nil {
 		handler.logger.Error("Error parsing request body", zap.Error(err))
-		return utils.RESPONSE_500, fmt.Errorf("error parsing request body")
+		return utils.RESPONSE_400, nil
+	}
+
+	if errs := schema.Validate(bodyMap); errs != nil {
+		handler.logger.Error("Invalid verify request", zap.Error(errs))
+		return utils.RESPONSE_VALIDATION(errs), nil
+	}
+
+	// Limited by email too, as credential stuffing and code guessing are spread across many IPs
+	keys := []ratelimit.Key{ratelimit.IP(request.RequestContext.Identity.SourceIP), ratelimit.Email(bodyMap["email"])}
+	wait, err := handler.limiter.Allow(ctx, keys...)
+	if err != nil {
+		// An unavailable store shouldn't stop everyone from signing in
+		handler.logger.Error("Failed to check rate limit", zap.Error(err))
+	}
+	if wait > 0 {
+		handler.logger.Warn("Rate limited verify request", zap.String("sourceIp", request.RequestContext.Identity.SourceIP), zap.Duration("retryAfter", wait))
+		return utils.RESPONSE_429(wait), nil
 	}
 
 	// TODO: Might want to return more detailed information when these things go wrong? Maybe in some cases
 	// For now we don't actually use the response
-	_, err = handler.authProviderAdapter.VerifyEmail(bodyMap)
+	_, err = handler.authProviderAdapter.VerifyEmail(ctx, bodyMap)
 	if err != nil {
 		handler.logger.Error("Error verifying email", zap.Error(err))
+		metrics.SetErrorCode(ctx, metrics.ErrorCode(err))
 		return utils.RESPONSE_500, nil
 	}
 
-	u, err := handler.userAPIClient.CreateUser(context.Background(), bodyMap["email"])
+	err = handler.limiter.Reset(ctx, ratelimit.Email(bodyMap["email"]))
 	if err != nil {
-		handler.logger.Error("Error creating user", zap.Error(err))
-		return utils.RESPONSE_500, nil
+		handler.logger.Error("Failed to reset rate limit", zap.Error(err))
 	}
 
-	r, err := json.Marshal(u)
+	// The user verified event follows once the record exists, see outbox.UserDeliverer
+	sent, err := handler.outbox.Send(ctx, outbox.CreateUser(bodyMap["email"]))
 	if err != nil {
-		handler.logger.Error("verify email error", zap.Error(err))
+		handler.logger.Error("Error writing user creation to the outbox", zap.Error(err))
 		return utils.RESPONSE_500, nil
 	}
+	if !sent.Delivered {
+		handler.logger.Warn("User record creation left for the outbox relay")
+		r, err := json.Marshal(map[string]string{"email": bodyMap["email"]})
+		if err != nil {
+			handler.logger.Error("verify email error", zap.Error(err))
+			return utils.RESPONSE_500, nil
+		}
+		return utils.RESPONSE_202(string(r)), nil
+	}
 
-	return utils.RESPONSE_200(string(r)), nil
+	// The created user, as bk-user-api returned it
+	return utils.RESPONSE_200(string(sent.Output)), nil
 }
@@ -4,8 +4,12 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
 	"github.com/benjaminkitson/bk-user-api/models"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
@@ -15,7 +19,7 @@ type MockAdapter struct {
 	isError bool
 }
 
-func (ma MockAdapter) VerifyEmail(body map[string]string) (map[string]string, error) {
+func (ma MockAdapter) VerifyEmail(ctx context.Context, body map[string]string) (map[string]string, error) {
 	if ma.isError {
 		return nil, fmt.Errorf("Auth provider error")
 	}
@@ -37,6 +41,42 @@ func (c MockUserAPIClient) CreateUser(ctx context.Context, email string) (models
 	}, nil
 }
 
+// Nobody has a record until it's created
+type MockUserIDStore struct{}
+
+func (s MockUserIDStore) UserID(ctx context.Context, email string) (string, error) {
+	return "", nil
+}
+
+func (s MockUserIDStore) SetUserID(ctx context.Context, email string, id string) error {
+	return nil
+}
+
+type MockRateLimiter struct {
+	isError    bool
+	retryAfter time.Duration
+}
+
+func (m MockRateLimiter) Allow(ctx context.Context, keys ...ratelimit.Key) (time.Duration, error) {
+	if m.isError {
+		return 0, fmt.Errorf("Rate limit store error")
+	}
+	return m.retryAfter, nil
+}
+
+func (m MockRateLimiter) Reset(ctx context.Context, keys ...ratelimit.Key) error {
+	return nil
+}
+
+// An outbox store that can't be written to
+type MockStore struct {
+	*outbox.MemoryStore
+}
+
+func (m MockStore) Put(ctx context.Context, e outbox.Entry) error {
+	return fmt.Errorf("Outbox store error")
+}
+
 /*
 Tests the basic workings of the handler, using a mocked auth provider client that either succeeds or returns some generic error
 */
@@ -45,7 +85,10 @@ func TestHandler(t *testing.T) {
 		Name               string
 		AdapterError       bool
 		UserAPIClientError bool
+		OutboxError        bool
 		SecretsGetterError bool
+		RateLimited        bool
+		RateLimiterError   bool
 		RequestBody        string
 		RequestPath        string
 		ExpectedStatusCode int
@@ -54,24 +97,58 @@ func TestHandler(t *testing.T) {
 	tests := []test{
 		{
 			Name:               "Verify email success",
-			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"1234\"}",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 200,
 		},
+		{
+			Name:               "Verify email malformed body",
+			RequestBody:        "{\"email\": ",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 400,
+		},
 		{
 			Name:               "Verify email auth provider adapter error",
 			AdapterError:       true,
-			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"1234\"}",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 500,
 		},
 		{
+			// The relay creates the user later
 			Name:               "Verify email user api client error",
 			UserAPIClientError: true,
-			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"1234\"}",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 202,
+		},
+		{
+			Name:               "Verify email outbox error",
+			OutboxError:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
 			RequestPath:        "/verify",
 			ExpectedStatusCode: 500,
 		},
+		{
+			Name:               "Verify email invalid code",
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"abc\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Verify email rate limited",
+			RateLimited:        true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 429,
+		},
+		{
+			Name:               "Verify email rate limiter error",
+			RateLimiterError:   true,
+			RequestBody:        "{\"email\": \"abc@gmail.com\", \"code\": \"123456\"}",
+			RequestPath:        "/verify",
+			ExpectedStatusCode: 200,
+		},
 		// {
 		// 	Name:               "Invalid path supplied",
 		// 	RequestBody:        "{\"email\": \"abc@gmail.com\", \"password\": \"password\"}",
@@ -95,10 +172,28 @@ func TestHandler(t *testing.T) {
 				isError: tt.UserAPIClientError,
 			}
 
-			h, err := NewHandler(l, m, c)
+			rl := MockRateLimiter{isError: tt.RateLimiterError}
+			if tt.RateLimited {
+				rl.retryAfter = 90 * time.Second
+			}
+
+			var store outbox.Store = outbox.NewMemoryStore()
+			if tt.OutboxError {
+				store = MockStore{outbox.NewMemoryStore()}
+			}
+			dlq := outbox.NewMemoryDeadLetterQueue()
+			p := userevents.NewMemoryPublisher()
+			o := outbox.New(l, outbox.Config{Store: store, DeadLetters: dlq, Retry: outbox.DefaultRetryPolicy}, outbox.Deliverers{
+				outbox.KindCreateUser:   outbox.NewUserDeliverer(c, MockUserIDStore{}),
+				outbox.KindPublishEvent: outbox.NewEventDeliverer(p),
+			})
+
+			h, err := NewHandler(l, m, o, rl)
 			assert.Nil(t, err)
 
 			req := events.APIGatewayProxyRequest{
+				HTTPMethod: "POST",
+				Headers:    map[string]string{"Content-Type": "application/json"},
 				// This test should probably fail if the body isn't the correct format?
 				Body: tt.RequestBody,
 			}
@@ -107,6 +202,14 @@ func TestHandler(t *testing.T) {
 			assert.Nil(t, err)
 
 			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+
+			// Only requests that create the user publish an event
+			if tt.ExpectedStatusCode == 200 {
+				assert.Len(t, p.Events(), 1)
+				assert.Equal(t, userevents.TypeUserVerified, p.Events()[0].Type)
+			} else {
+				assert.Empty(t, p.Events())
+			}
 		})
 	}
 }
@@ -5,74 +5,72 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
-	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
-	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
 	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
-	"github.com/benjaminkitson/bk-auth-api/cognitoadapter/env"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
 	"github.com/benjaminkitson/bk-auth-api/lambda/verify/handler"
-	"github.com/benjaminkitson/bk-auth-api/secrets"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/ratelimit"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-auth-api/utils/lambda/start"
 	"github.com/benjaminkitson/bk-user-api/userapiclient"
-	"go.uber.org/zap"
 )
 
 func main() {
-	lambda.Start(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		logger, err := zap.NewProduction()
-		if err != nil {
-			fmt.Printf("Failed to initialise logger: %v", err)
-			logger = &zap.Logger{}
-		}
-		defer logger.Sync()
+	var cfg struct {
+		appconfig.Cognito
+		appconfig.RateLimit
+		appconfig.UserAPI
+	}
+	publisher, err := userevents.PublisherFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise event publisher, events will be dropped: %v", err)
+		publisher = userevents.Discard
+	}
+	outboxConfig, err := outbox.ConfigFromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise outbox: %v", err)
+		os.Exit(1)
+	}
+	// Only used without a RATE_LIMIT_TABLE, it lives outside the handler function to last between invocations
+	memoryStore := ratelimit.NewMemoryStore()
 
-		sdkConfig, err := config.LoadDefaultConfig(context.TODO())
+	start.API(string(audit.ActionVerifyEmail), func(ctx context.Context, inv start.Invocation) (utils.APIHandler, error) {
+		sdkConfig, err := inv.AWSConfig(ctx)
 		if err != nil {
-			logger.Error("Failed to intialise SDK config", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
-		}
-
-		sm := secretsmanager.NewFromConfig(sdkConfig)
-		sc, err := secrets.NewSecretsClient(logger, sm)
-		if err != nil {
-			logger.Error("failed to initialise secrets client", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
 
 		cc := cognitoidentityprovider.NewFromConfig(sdkConfig)
-		// TODO: investigate just storing this as an env var from the CDK
-		ccid, err := sc.GetSecret("COGNITO_CLIENT")
-		if err != nil {
-			logger.Error("Failed to get cognito client id", zap.Error(err))
-			return events.APIGatewayProxyResponse{}, err
-		}
+		ca := cognito.NewAdapter(cc, cfg.ClientID, cfg.UserPoolID, inv.Logger)
 
-		p := env.PoolID
-		ca := cognito.NewAdapter(cc, ccid, p, logger)
-
-		c := ssm.NewFromConfig(sdkConfig)
-
-		paramName := os.Getenv("USER_API_PARAMETER_NAME")
-
-		o, err := c.GetParameter(ctx, &ssm.GetParameterInput{Name: &paramName})
+		uc, err := userapiclient.NewClient(cfg.UserAPI.URL, inv.Logger)
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
 
-		n := o.Parameter.Value
-
-		uc, err := userapiclient.NewClient(*n, logger)
-		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
+		var store ratelimit.Store = memoryStore
+		if cfg.RateLimit.Table != "" {
+			ds, err := ratelimit.NewDynamoDBStore(dynamodb.NewFromConfig(sdkConfig), cfg.RateLimit.Table)
+			if err != nil {
+				return nil, fmt.Errorf("initialising rate limit store: %w", err)
+			}
+			store = ds
 		}
+		limiter := ratelimit.NewLimiter(inv.Logger, store, ratelimit.DefaultPolicies)
+
+		ob := outbox.New(inv.Logger, outboxConfig, outbox.Deliverers{
+			outbox.KindCreateUser:   outbox.NewUserDeliverer(inv.UserAPI(uc), ca),
+			outbox.KindPublishEvent: outbox.NewEventDeliverer(publisher),
+		})
 
-		h, err := handler.NewHandler(logger, ca, uc)
+		h, err := handler.NewHandler(inv.Logger, ca, ob, limiter)
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, err
+			return nil, err
 		}
-
-		return h.Handle(ctx, request)
-	})
+		return h.Handle, nil
+	}, start.WithConfig(&cfg), start.WithAudit())
 }
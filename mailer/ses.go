@@ -0,0 +1,65 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"go.uber.org/zap"
+)
+
+type SESClient interface {
+	SendEmail(context.Context, *sesv2.SendEmailInput, ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+type SESMailer struct {
+	client SESClient
+	from   string
+	logger *zap.Logger
+}
+
+/*
+Sends our own emails through SES, for cases where the Cognito generated message is suppressed
+*/
+func NewSESMailer(l *zap.Logger, c SESClient, from string) (SESMailer, error) {
+	if from == "" {
+		return SESMailer{}, fmt.Errorf("no from address supplied")
+	}
+	return SESMailer{
+		client: c,
+		from:   from,
+		logger: l,
+	}, nil
+}
+
+const invitationSubject = "You've been invited to bk"
+const invitationBody = `You've been invited to create an account.
+
+Sign in with your email address and the temporary password below. You'll be asked to choose a new password the first time you sign in.
+
+Temporary password: %v
+`
+
+func (m SESMailer) SendInvitation(ctx context.Context, email string, temporaryPassword string) error {
+	_, err := m.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(m.from),
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(invitationSubject)},
+				Body: &types.Body{
+					Text: &types.Content{Data: aws.String(fmt.Sprintf(invitationBody, temporaryPassword))},
+				},
+			},
+		},
+	})
+	if err != nil {
+		m.logger.Error("Failed to send invitation email", zap.Error(err))
+		return err
+	}
+	return nil
+}
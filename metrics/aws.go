@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+/*
+Records every call made by clients created from the SDK config, e.g. CognitoIdentityProvider.InitiateAuth with the
+error code Cognito gave. The latency includes retries, as that's what callers wait for.
+*/
+func (m Metrics) InstrumentAWS(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(s *middleware.Stack) error {
+		// After the service's own middleware, which puts the operation in the context
+		return s.Initialize.Add(middleware.InitializeMiddlewareFunc("Metrics", func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			start := m.now()
+			out, md, err := next.HandleInitialize(ctx, in)
+			operation := strings.ReplaceAll(awsmiddleware.GetServiceID(ctx), " ", "") + "." + awsmiddleware.GetOperationName(ctx)
+			m.Call(operation, start, err)
+			return out, md, err
+		}), middleware.After)
+	})
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+)
+
+/*
+Records every request the handler serves, apart from CORS preflights, with the outcome and error code of its response.
+The handler can change what's recorded through its context, see SetOperation and SetErrorCode.
+*/
+func (m Metrics) Wrap(operation string, h utils.APIHandler) utils.APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if request.HTTPMethod == http.MethodOptions {
+			return h(ctx, request)
+		}
+
+		start := m.now()
+		d := Dimensions{Operation: operation}
+		res, err := h(context.WithValue(ctx, dimensionsKey{}, &d), request)
+
+		d.Outcome = statusOutcome(res.StatusCode)
+		switch {
+		case d.ErrorCode != "":
+		case err != nil:
+			d.Outcome = OutcomeFailure
+			d.ErrorCode = ErrorCode(err)
+		case d.Outcome != OutcomeSuccess:
+			d.ErrorCode = responseErrorCode(res)
+		}
+		m.request(d, start)
+
+		return res, err
+	}
+}
+
+/*
+Records every invocation of a handler for events other than API requests, e.g. Cognito triggers, which has failed if
+it returns an error
+*/
+func WrapEvent[E any, R any](m Metrics, operation string, h func(context.Context, E) (R, error)) func(context.Context, E) (R, error) {
+	return func(ctx context.Context, event E) (R, error) {
+		start := m.now()
+		d := Dimensions{Operation: operation}
+		res, err := h(context.WithValue(ctx, dimensionsKey{}, &d), event)
+
+		d.Outcome = OutcomeSuccess
+		if err != nil {
+			d.Outcome = OutcomeFailure
+			if d.ErrorCode == "" {
+				d.ErrorCode = ErrorCode(err)
+			}
+		}
+		m.request(d, start)
+
+		return res, err
+	}
+}
+
+func (m Metrics) request(d Dimensions, start time.Time) {
+	m.Put(d,
+		Value{Name: MetricRequests, Unit: UnitCount, Value: 1},
+		Value{Name: MetricRequestLatency, Unit: UnitMilliseconds, Value: milliseconds(m.now().Sub(start))},
+	)
+}
+
+// The code the response gave clients, or its status code if it didn't give one
+func responseErrorCode(r events.APIGatewayProxyResponse) string {
+	body := map[string]interface{}{}
+	if json.Unmarshal([]byte(r.Body), &body) == nil {
+		if c, ok := body["code"].(string); ok && c != "" {
+			return c
+		}
+	}
+	return statusErrorCode(r.StatusCode)
+}
+
+type dimensionsKey struct{}
+
+func dimensionsFrom(ctx context.Context) *Dimensions {
+	d, _ := ctx.Value(dimensionsKey{}).(*Dimensions)
+	return d
+}
+
+// Replaces the operation Wrap was given, for handlers that do more than one thing
+func SetOperation(ctx context.Context, operation string) {
+	if d := dimensionsFrom(ctx); d != nil {
+		d.Operation = operation
+	}
+}
+
+// Records why the request didn't succeed when the response doesn't say, e.g. the Cognito error behind a 500
+func SetErrorCode(ctx context.Context, code string) {
+	if d := dimensionsFrom(ctx); d != nil {
+		d.ErrorCode = code
+	}
+}
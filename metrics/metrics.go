@@ -0,0 +1,254 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"go.uber.org/zap"
+)
+
+// The CloudWatch namespace metrics are published to
+const Namespace = "bk-auth-api"
+
+const (
+	// Every request a handler serves, with the handler's latency
+	MetricRequests       = "Requests"
+	MetricRequestLatency = "RequestLatency"
+	// Every call to Cognito, bk-user-api or any other dependency, with its latency
+	MetricCalls       = "Calls"
+	MetricCallLatency = "CallLatency"
+	// Audit events lost because the recorder's queue was full
+	MetricAuditEventsDropped = "AuditEventsDropped"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// The caller wasn't allowed to do it, e.g. a bad token, a missing role or too many attempts
+	OutcomeDenied Outcome = "denied"
+	// Anything else the caller got wrong, e.g. an invalid request
+	OutcomeRejected Outcome = "rejected"
+	OutcomeFailure  Outcome = "failure"
+)
+
+// EMF needs a value for every dimension
+const noErrorCode = "None"
+
+type Unit string
+
+const (
+	UnitCount        Unit = "Count"
+	UnitMilliseconds Unit = "Milliseconds"
+)
+
+/*
+What a metric is about. Operations are the audit actions for handlers (e.g. sign_up) and Service.Operation for calls
+(e.g. CognitoIdentityProvider.InitiateAuth). ErrorCode is the code clients were given, or the dependency's error code.
+*/
+type Dimensions struct {
+	Operation string
+	Outcome   Outcome
+	ErrorCode string
+}
+
+type Value struct {
+	Name  string
+	Unit  Unit
+	Value float64
+}
+
+// Values recorded together with the same dimensions
+type Entry struct {
+	Time time.Time
+	Dimensions
+	Values []Value
+}
+
+// Somewhere metrics are written
+type Sink interface {
+	Put(e Entry)
+}
+
+/*
+Writes entries in CloudWatch's Embedded Metric Format through the logger, so that CloudWatch Logs extracts the metrics
+from the Lambda's log group without any calls to CloudWatch
+*/
+type LoggerSink struct {
+	logger *zap.Logger
+}
+
+func NewLoggerSink(logger *zap.Logger) LoggerSink {
+	return LoggerSink{logger: logger}
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+func (s LoggerSink) Put(e Entry) {
+	d := emfDirective{
+		Namespace:  Namespace,
+		Dimensions: [][]string{{"Operation", "Outcome", "ErrorCode"}},
+	}
+	fields := []zap.Field{
+		zap.String("Operation", e.Operation),
+		zap.String("Outcome", string(e.Outcome)),
+		zap.String("ErrorCode", e.ErrorCode),
+	}
+	for _, v := range e.Values {
+		d.Metrics = append(d.Metrics, emfMetric{Name: v.Name, Unit: v.Unit})
+		fields = append(fields, zap.Float64(v.Name, v.Value))
+	}
+	fields = append(fields, zap.Any("_aws", emfMetadata{
+		Timestamp:         e.Time.UnixMilli(),
+		CloudWatchMetrics: []emfDirective{d},
+	}))
+	s.logger.Info("metrics", fields...)
+}
+
+// Keeps entries in memory, for tests to make assertions about
+type TestSink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewTestSink() *TestSink {
+	return &TestSink{}
+}
+
+func (s *TestSink) Put(e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, e)
+}
+
+func (s *TestSink) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry{}, s.entries...)
+}
+
+// Every value of the metric recorded with the dimensions
+func (s *TestSink) Values(name string, d Dimensions) []float64 {
+	values := []float64{}
+	for _, e := range s.Entries() {
+		if e.Dimensions != d {
+			continue
+		}
+		for _, v := range e.Values {
+			if v.Name == name {
+				values = append(values, v.Value)
+			}
+		}
+	}
+	return values
+}
+
+// The total of the metric's values with the dimensions, e.g. how many requests there were
+func (s *TestSink) Sum(name string, d Dimensions) float64 {
+	sum := 0.0
+	for _, v := range s.Values(name, d) {
+		sum += v
+	}
+	return sum
+}
+
+type discard struct{}
+
+func (discard) Put(Entry) {}
+
+// A sink that drops everything
+var Discard Sink = discard{}
+
+type Metrics struct {
+	sink Sink
+	now  func() time.Time
+}
+
+func New(sink Sink) Metrics {
+	return Metrics{sink: sink, now: time.Now}
+}
+
+func (m Metrics) Put(d Dimensions, values ...Value) {
+	if d.ErrorCode == "" {
+		d.ErrorCode = noErrorCode
+	}
+	m.sink.Put(Entry{Time: m.now(), Dimensions: d, Values: values})
+}
+
+// Records a call to a dependency that started at start and returned err
+func (m Metrics) Call(operation string, start time.Time, err error) {
+	d := Dimensions{Operation: operation, Outcome: OutcomeSuccess}
+	if err != nil {
+		d.Outcome = OutcomeFailure
+		d.ErrorCode = ErrorCode(err)
+	}
+	m.Put(d,
+		Value{Name: MetricCalls, Unit: UnitCount, Value: 1},
+		Value{Name: MetricCallLatency, Unit: UnitMilliseconds, Value: milliseconds(m.now().Sub(start))},
+	)
+}
+
+/*
+A short code for the error that's safe to use as a dimension: the code of a RequestError or an AWS API error, Timeout
+or Canceled if the context ended, or Error for anything else
+*/
+func ErrorCode(err error) string {
+	var re auth.RequestError
+	var ae smithy.APIError
+	switch {
+	case errors.As(err, &re):
+		return re.Code
+	case errors.As(err, &ae):
+		return ae.ErrorCode()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Timeout"
+	case errors.Is(err, context.Canceled):
+		return "Canceled"
+	default:
+		return "Error"
+	}
+}
+
+// Outcome of a response with the status code
+func statusOutcome(statusCode int) Outcome {
+	switch {
+	case statusCode == 0 || statusCode >= 500:
+		return OutcomeFailure
+	case statusCode < 400:
+		return OutcomeSuccess
+	case statusCode == 401 || statusCode == 403 || statusCode == 429:
+		return OutcomeDenied
+	default:
+		return OutcomeRejected
+	}
+}
+
+func statusErrorCode(statusCode int) string {
+	if statusOutcome(statusCode) == OutcomeSuccess {
+		return ""
+	}
+	return strconv.Itoa(statusCode)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,275 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/smithy-go"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggerSink(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	m := New(NewLoggerSink(logger))
+	m.now = func() time.Time { return now }
+	m.Put(Dimensions{Operation: "sign_in", Outcome: OutcomeDenied, ErrorCode: "RATE_LIMITED"},
+		Value{Name: MetricRequests, Unit: UnitCount, Value: 1},
+		Value{Name: MetricRequestLatency, Unit: UnitMilliseconds, Value: 12.5},
+	)
+
+	var line map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "sign_in", line["Operation"])
+	assert.Equal(t, "denied", line["Outcome"])
+	assert.Equal(t, "RATE_LIMITED", line["ErrorCode"])
+	assert.Equal(t, 1.0, line["Requests"])
+	assert.Equal(t, 12.5, line["RequestLatency"])
+
+	b, err := json.Marshal(line["_aws"])
+	assert.Nil(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{
+		"Timestamp": %d,
+		"CloudWatchMetrics": [{
+			"Namespace": "bk-auth-api",
+			"Dimensions": [["Operation", "Outcome", "ErrorCode"]],
+			"Metrics": [{"Name": "Requests", "Unit": "Count"}, {"Name": "RequestLatency", "Unit": "Milliseconds"}]
+		}]
+	}`, now.UnixMilli()), string(b))
+}
+
+func TestWrap(t *testing.T) {
+	type test struct {
+		Name              string
+		Method            string
+		Response          events.APIGatewayProxyResponse
+		Error             error
+		Operation         string
+		ErrorCode         string
+		ExpectedOperation string
+		ExpectedOutcome   Outcome
+		ExpectedErrorCode string
+	}
+
+	tests := []test{
+		{
+			Name:              "Success",
+			Response:          utils.RESPONSE_200(`{"message": "Successfully signed up!"}`),
+			ExpectedOperation: "sign_up",
+			ExpectedOutcome:   OutcomeSuccess,
+			ExpectedErrorCode: "None",
+		},
+		{
+			Name:              "Rejected with a code",
+			Response:          utils.RESPONSE_ERROR(400, auth.ErrCodeDisposableEmail, "Disposable email addresses can't be used"),
+			ExpectedOperation: "sign_up",
+			ExpectedOutcome:   OutcomeRejected,
+			ExpectedErrorCode: auth.ErrCodeDisposableEmail,
+		},
+		{
+			Name:              "Denied",
+			Response:          utils.RESPONSE_401,
+			ExpectedOperation: "sign_up",
+			ExpectedOutcome:   OutcomeDenied,
+			ExpectedErrorCode: "401",
+		},
+		{
+			Name:              "Failure",
+			Response:          utils.RESPONSE_500,
+			ExpectedOperation: "sign_up",
+			ExpectedOutcome:   OutcomeFailure,
+			ExpectedErrorCode: "500",
+		},
+		{
+			Name:              "Handler error",
+			Error:             fmt.Errorf("handler error"),
+			ExpectedOperation: "sign_up",
+			ExpectedOutcome:   OutcomeFailure,
+			ExpectedErrorCode: "Error",
+		},
+		{
+			Name:              "Set by the handler",
+			Response:          utils.RESPONSE_500,
+			Operation:         "sign_up_again",
+			ErrorCode:         "UsernameExistsException",
+			ExpectedOperation: "sign_up_again",
+			ExpectedOutcome:   OutcomeFailure,
+			ExpectedErrorCode: "UsernameExistsException",
+		},
+		{
+			Name:     "Preflight",
+			Method:   http.MethodOptions,
+			Response: events.APIGatewayProxyResponse{StatusCode: 204},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			sink := NewTestSink()
+			h := New(sink).Wrap("sign_up", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				if tt.Operation != "" {
+					SetOperation(ctx, tt.Operation)
+				}
+				if tt.ErrorCode != "" {
+					SetErrorCode(ctx, tt.ErrorCode)
+				}
+				return tt.Response, tt.Error
+			})
+
+			method := tt.Method
+			if method == "" {
+				method = http.MethodPost
+			}
+			r, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: method})
+			assert.Equal(t, tt.Response, r)
+			assert.Equal(t, tt.Error, err)
+
+			if tt.ExpectedOutcome == "" {
+				assert.Empty(t, sink.Entries())
+				return
+			}
+			d := Dimensions{Operation: tt.ExpectedOperation, Outcome: tt.ExpectedOutcome, ErrorCode: tt.ExpectedErrorCode}
+			assert.Equal(t, []float64{1}, sink.Values(MetricRequests, d))
+			assert.Len(t, sink.Values(MetricRequestLatency, d), 1)
+		})
+	}
+}
+
+func TestWrapEvent(t *testing.T) {
+	sink := NewTestSink()
+	h := WrapEvent(New(sink), "pre_sign_up", func(ctx context.Context, event events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error) {
+		if event.Request.UserAttributes["email"] == "" {
+			return event, auth.RequestError{Code: auth.ErrCodeValidationFailed, Message: "No email"}
+		}
+		return event, nil
+	})
+
+	event := events.CognitoEventUserPoolsPreSignup{}
+	_, err := h(context.Background(), event)
+	assert.Error(t, err)
+	event.Request.UserAttributes = map[string]string{"email": "abc@gmail.com"}
+	_, err = h(context.Background(), event)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1.0, sink.Sum(MetricRequests, Dimensions{Operation: "pre_sign_up", Outcome: OutcomeSuccess, ErrorCode: "None"}))
+	assert.Equal(t, 1.0, sink.Sum(MetricRequests, Dimensions{Operation: "pre_sign_up", Outcome: OutcomeFailure, ErrorCode: auth.ErrCodeValidationFailed}))
+}
+
+func TestErrorCode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+
+	tests := map[error]string{
+		auth.RequestError{Code: auth.ErrCodeInvalidCode}:                                 auth.ErrCodeInvalidCode,
+		fmt.Errorf("wrapped: %w", &smithy.GenericAPIError{Code: "ExpiredCodeException"}): "ExpiredCodeException",
+		ctx.Err():                 "Timeout",
+		context.Canceled:          "Canceled",
+		fmt.Errorf("other error"): "Error",
+	}
+	for err, expected := range tests {
+		assert.Equal(t, expected, ErrorCode(err), err.Error())
+	}
+}
+
+// Answers every request with the status and body
+type MockHTTPClient struct {
+	statusCode int
+	body       string
+}
+
+func (c MockHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: c.statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+		Request:    r,
+	}, nil
+}
+
+func TestInstrumentAWS(t *testing.T) {
+	sink := NewTestSink()
+	m := New(sink)
+
+	for _, c := range []MockHTTPClient{
+		{statusCode: 200, body: `{}`},
+		{statusCode: 400, body: `{"__type": "NotAuthorizedException", "message": "Incorrect username or password."}`},
+	} {
+		cfg := aws.Config{
+			Region:      "eu-west-2",
+			Credentials: aws.AnonymousCredentials{},
+			HTTPClient:  c,
+		}
+		m.InstrumentAWS(&cfg)
+		_, _ = cognitoidentityprovider.NewFromConfig(cfg).InitiateAuth(context.Background(), &cognitoidentityprovider.InitiateAuthInput{
+			AuthFlow: "USER_PASSWORD_AUTH",
+			ClientId: aws.String("client"),
+		})
+	}
+
+	assert.Equal(t, 1.0, sink.Sum(MetricCalls, Dimensions{Operation: "CognitoIdentityProvider.InitiateAuth", Outcome: OutcomeSuccess, ErrorCode: "None"}))
+	assert.Equal(t, 1.0, sink.Sum(MetricCalls, Dimensions{Operation: "CognitoIdentityProvider.InitiateAuth", Outcome: OutcomeFailure, ErrorCode: "NotAuthorizedException"}))
+	assert.Len(t, sink.Entries(), 2)
+}
+
+type MockUserAPIClient struct {
+	isError bool
+}
+
+func (m MockUserAPIClient) err() error {
+	if m.isError {
+		return fmt.Errorf("User API error")
+	}
+	return nil
+}
+
+func (m MockUserAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	return models.User{}, m.err()
+}
+
+func (m MockUserAPIClient) DeleteUser(ctx context.Context, id string) (string, error) {
+	return id, m.err()
+}
+
+
+
+func TestInstrumentUserAPI(t *testing.T) {
+	ctx := context.Background()
+	for _, isError := range []bool{false, true} {
+		sink := NewTestSink()
+		c := New(sink).InstrumentUserAPI(MockUserAPIClient{isError: isError})
+
+		_, err := c.CreateUser(ctx, "abc@gmail.com")
+		assert.Equal(t, isError, err != nil)
+		id, err := c.DeleteUser(ctx, "123")
+		assert.Equal(t, isError, err != nil)
+		assert.Equal(t, "123", id)
+
+		d := Dimensions{Outcome: OutcomeSuccess, ErrorCode: "None"}
+		if isError {
+			d = Dimensions{Outcome: OutcomeFailure, ErrorCode: "Error"}
+		}
+		for _, op := range []string{"CreateUser", "DeleteUser"} {
+			d.Operation = "UserAPI." + op
+			assert.Equal(t, 1.0, sink.Sum(MetricCalls, d), d.Operation)
+			assert.Len(t, sink.Values(MetricCallLatency, d), 1, d.Operation)
+		}
+	}
+}
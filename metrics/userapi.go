@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/benjaminkitson/bk-user-api/models"
+)
+
+// Everything the lambdas call on bk-user-api's client
+type UserAPIClient interface {
+	CreateUser(ctx context.Context, email string) (models.User, error)
+	DeleteUser(ctx context.Context, id string) (string, error)
+}
+
+type userAPIClient struct {
+	client  UserAPIClient
+	metrics Metrics
+}
+
+// Records every call made through the client, as UserAPI.<method>
+func (m Metrics) InstrumentUserAPI(c UserAPIClient) UserAPIClient {
+	return userAPIClient{client: c, metrics: m}
+}
+
+func (c userAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	start := c.metrics.now()
+	u, err := c.client.CreateUser(ctx, email)
+	c.metrics.Call("UserAPI.CreateUser", start, err)
+	return u, err
+}
+
+func (c userAPIClient) DeleteUser(ctx context.Context, id string) (string, error) {
+	start := c.metrics.now()
+	r, err := c.client.DeleteUser(ctx, id)
+	c.metrics.Call("UserAPI.DeleteUser", start, err)
+	return r, err
+}
+
+
+
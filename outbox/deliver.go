@@ -0,0 +1,101 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-user-api/models"
+)
+
+// What a delivered entry produced
+type Result struct {
+	// Handed back to whoever sent the entry, e.g. the created user
+	Output json.RawMessage
+	// Side-effects that depend on this one, written to the outbox once it's delivered
+	Next []Entry
+}
+
+type Deliverer interface {
+	Deliver(ctx context.Context, e Entry) (Result, error)
+}
+
+// The deliverer for each kind of entry. Entries of any other kind go straight to the dead-letter queue
+type Deliverers map[string]Deliverer
+
+type UserAPIClient interface {
+	CreateUser(ctx context.Context, email string) (models.User, error)
+}
+
+// Where the ID of each user's bk-user-api record is kept, e.g. on the Cognito user
+type UserIDStore interface {
+	// "" if the user hasn't got a record yet
+	UserID(ctx context.Context, email string) (string, error)
+	SetUserID(ctx context.Context, email string, id string) error
+}
+
+/*
+Creates bk-user-api records, then publishes that the user is verified since that's the only time records are created.
+bk-user-api doesn't deduplicate and entries can be delivered more than once, so a record is only created for users who
+haven't got an ID recorded yet. One is recorded as soon as the record is created, so a repeat only creates a second
+record if the first attempt failed in between.
+*/
+type UserDeliverer struct {
+	client UserAPIClient
+	ids    UserIDStore
+}
+
+func NewUserDeliverer(c UserAPIClient, ids UserIDStore) UserDeliverer {
+	return UserDeliverer{
+		client: c,
+		ids:    ids,
+	}
+}
+
+func (d UserDeliverer) Deliver(ctx context.Context, e Entry) (Result, error) {
+	var p CreateUserPayload
+	if err := json.Unmarshal(e.Payload, &p); err != nil {
+		return Result{}, err
+	}
+	// Anything but a user without an ID is retried, rather than risk creating a duplicate
+	id, err := d.ids.UserID(ctx, p.Email)
+	if err != nil {
+		return Result{}, err
+	}
+	u := models.User{UserID: id, Email: p.Email}
+	if id == "" {
+		u, err = d.client.CreateUser(ctx, p.Email)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := d.ids.SetUserID(ctx, p.Email, u.UserID); err != nil {
+			return Result{}, err
+		}
+	}
+	b, err := json.Marshal(u)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Output: b,
+		Next:   []Entry{PublishEvent(userevents.UserVerified(p.Email, u.UserID))},
+	}, nil
+}
+
+type EventDeliverer struct {
+	publisher userevents.Publisher
+}
+
+func NewEventDeliverer(p userevents.Publisher) EventDeliverer {
+	return EventDeliverer{
+		publisher: p,
+	}
+}
+
+func (d EventDeliverer) Deliver(ctx context.Context, e Entry) (Result, error) {
+	var event userevents.Event
+	if err := json.Unmarshal(e.Payload, &event); err != nil {
+		return Result{}, err
+	}
+	return Result{}, d.publisher.Publish(ctx, event)
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// Where entries go once the relay has given up on them, for someone to look at and redrive
+type DeadLetterQueue interface {
+	Send(ctx context.Context, e Entry) error
+}
+
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// Sends the whole entry as the message body, with its kind as a message attribute
+type SQSDeadLetterQueue struct {
+	client SQSClient
+	url    string
+}
+
+func NewSQSDeadLetterQueue(c SQSClient, queueURL string) SQSDeadLetterQueue {
+	return SQSDeadLetterQueue{
+		client: c,
+		url:    queueURL,
+	}
+}
+
+func (q SQSDeadLetterQueue) Send(ctx context.Context, e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.url),
+		MessageBody: aws.String(string(b)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"kind": {DataType: aws.String("String"), StringValue: aws.String(e.Kind)},
+		},
+	})
+	return err
+}
+
+// Keeps dead entries in memory, for tests and local development
+type MemoryDeadLetterQueue struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryDeadLetterQueue() *MemoryDeadLetterQueue {
+	return &MemoryDeadLetterQueue{}
+}
+
+func (q *MemoryDeadLetterQueue) Send(_ context.Context, e Entry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries = append(q.entries, e)
+	return nil
+}
+
+func (q *MemoryDeadLetterQueue) Entries() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Entry{}, q.entries...)
+}
@@ -0,0 +1,178 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// The index Due and List query, partitioned by status and sorted by the next attempt
+const StatusIndex = "byStatus"
+
+// How long delivered entries are kept for, dead ones are kept until someone deals with them
+const deliveredRetention = 7 * 24 * time.Hour
+
+/*
+Keeps entries in a DynamoDB table with a string partition key "id", and a StatusIndex global secondary index with a
+string partition key "status" and number sort key "nextAttempt". The table's TTL attribute should be "expiresAt",
+which is how delivered entries get cleaned up.
+*/
+type DynamoDBStore struct {
+	client DynamoDBClient
+	table  string
+}
+
+func NewDynamoDBStore(c DynamoDBClient, table string) (DynamoDBStore, error) {
+	if table == "" {
+		return DynamoDBStore{}, fmt.Errorf("no table name supplied")
+	}
+	return DynamoDBStore{
+		client: c,
+		table:  table,
+	}, nil
+}
+
+func (s DynamoDBStore) Put(ctx context.Context, e Entry) error {
+	item := map[string]types.AttributeValue{
+		"id":          &types.AttributeValueMemberS{Value: e.ID},
+		"kind":        &types.AttributeValueMemberS{Value: e.Kind},
+		"payload":     &types.AttributeValueMemberS{Value: string(e.Payload)},
+		"status":      &types.AttributeValueMemberS{Value: e.Status},
+		"attempts":    &types.AttributeValueMemberN{Value: strconv.Itoa(e.Attempts)},
+		"createdAt":   &types.AttributeValueMemberN{Value: strconv.FormatInt(e.CreatedAt.UnixMilli(), 10)},
+		"nextAttempt": &types.AttributeValueMemberN{Value: strconv.FormatInt(e.NextAttempt.UnixMilli(), 10)},
+		"version":     &types.AttributeValueMemberN{Value: strconv.FormatInt(e.Version+1, 10)},
+	}
+	if e.LastError != "" {
+		item["lastError"] = &types.AttributeValueMemberS{Value: e.LastError}
+	}
+	if e.Status == StatusDelivered {
+		item["expiresAt"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(deliveredRetention).Unix(), 10)}
+	}
+
+	in := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item:      item,
+	}
+	if e.Version == 0 {
+		in.ConditionExpression = aws.String("attribute_not_exists(id)")
+	} else {
+		in.ConditionExpression = aws.String("version = :version")
+		in.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(e.Version, 10)},
+		}
+	}
+
+	_, err := s.client.PutItem(ctx, in)
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s DynamoDBStore) Due(ctx context.Context, now time.Time, limit int) ([]Entry, error) {
+	return s.query(ctx, "#status = :status AND nextAttempt <= :now", map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: StatusPending},
+		":now":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+	}, limit)
+}
+
+func (s DynamoDBStore) List(ctx context.Context, status string) ([]Entry, error) {
+	return s.query(ctx, "#status = :status", map[string]types.AttributeValue{
+		":status": &types.AttributeValueMemberS{Value: status},
+	}, 0)
+}
+
+// Pages through the index until there's nothing left or the limit is reached, a limit of 0 reads everything
+func (s DynamoDBStore) query(ctx context.Context, condition string, values map[string]types.AttributeValue, limit int) ([]Entry, error) {
+	entries := []Entry{}
+	var start map[string]types.AttributeValue
+	for {
+		in := &dynamodb.QueryInput{
+			TableName:                 aws.String(s.table),
+			IndexName:                 aws.String(StatusIndex),
+			KeyConditionExpression:    aws.String(condition),
+			ExpressionAttributeNames:  map[string]string{"#status": "status"},
+			ExpressionAttributeValues: values,
+			ExclusiveStartKey:         start,
+		}
+		if limit > 0 {
+			in.Limit = aws.Int32(int32(limit - len(entries)))
+		}
+		o, err := s.client.Query(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range o.Items {
+			e, err := entry(item)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		if o.LastEvaluatedKey == nil || (limit > 0 && len(entries) >= limit) {
+			return entries, nil
+		}
+		start = o.LastEvaluatedKey
+	}
+}
+
+func entry(item map[string]types.AttributeValue) (Entry, error) {
+	e := Entry{
+		ID:        str(item, "id"),
+		Kind:      str(item, "kind"),
+		Payload:   []byte(str(item, "payload")),
+		Status:    str(item, "status"),
+		LastError: str(item, "lastError"),
+	}
+	attempts, err := number(item, "attempts")
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Attempts = int(attempts)
+	createdAt, err := number(item, "createdAt")
+	if err != nil {
+		return Entry{}, err
+	}
+	e.CreatedAt = time.UnixMilli(createdAt).UTC()
+	nextAttempt, err := number(item, "nextAttempt")
+	if err != nil {
+		return Entry{}, err
+	}
+	e.NextAttempt = time.UnixMilli(nextAttempt).UTC()
+	e.Version, err = number(item, "version")
+	if err != nil {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+// Missing attributes read as ""
+func str(item map[string]types.AttributeValue, name string) string {
+	s, ok := item[name].(*types.AttributeValueMemberS)
+	if !ok {
+		return ""
+	}
+	return s.Value
+}
+
+// Missing attributes read as 0
+func number(item map[string]types.AttributeValue, name string) (int64, error) {
+	n, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(n.Value, 10, 64)
+}
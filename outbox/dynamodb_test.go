@@ -0,0 +1,141 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Just enough of DynamoDB to check the conditional writes and status index queries, a page of one item at a time
+type MockDynamoDBClient struct {
+	isError bool
+	items   map[string]map[string]types.AttributeValue
+}
+
+func (m MockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("PutItem error")
+	}
+	k := params.Item["id"].(*types.AttributeValueMemberS).Value
+	existing, ok := m.items[k]
+	switch aws.ToString(params.ConditionExpression) {
+	case "attribute_not_exists(id)":
+		if ok {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case "version = :version":
+		v := params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value
+		if !ok || existing["version"].(*types.AttributeValueMemberN).Value != v {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	m.items[k] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m MockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("Query error")
+	}
+	status := params.ExpressionAttributeValues[":status"].(*types.AttributeValueMemberS).Value
+	before := int64(-1)
+	if n, ok := params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN); ok {
+		before, _ = strconv.ParseInt(n.Value, 10, 64)
+	}
+
+	matches := []map[string]types.AttributeValue{}
+	for _, item := range m.items {
+		next, _ := number(item, "nextAttempt")
+		if str(item, "status") == status && (before < 0 || next <= before) {
+			matches = append(matches, item)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, _ := number(matches[i], "nextAttempt")
+		b, _ := number(matches[j], "nextAttempt")
+		return a < b
+	})
+
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		for i, item := range matches {
+			if str(item, "id") == str(params.ExclusiveStartKey, "id") {
+				start = i + 1
+			}
+		}
+	}
+	if start >= len(matches) {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	o := &dynamodb.QueryOutput{Items: matches[start : start+1]}
+	if start+1 < len(matches) {
+		o.LastEvaluatedKey = map[string]types.AttributeValue{"id": matches[start]["id"]}
+	}
+	return o, nil
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	m := MockDynamoDBClient{items: map[string]map[string]types.AttributeValue{}}
+	s, err := NewDynamoDBStore(m, "outbox")
+	assert.NoError(t, err)
+
+	now := time.Now()
+	first, second, later := CreateUser("abc@gmail.com"), CreateUser("def@gmail.com"), CreateUser("ghi@gmail.com")
+	first.NextAttempt = now.Add(-time.Minute)
+	second.NextAttempt = now
+	later.NextAttempt = now.Add(time.Minute)
+	for _, e := range []Entry{later, second, first} {
+		assert.NoError(t, s.Put(context.Background(), e))
+	}
+
+	// Read back over several pages, oldest first
+	due, err := s.Due(context.Background(), now, 0)
+	assert.NoError(t, err)
+	assert.Len(t, due, 2)
+	assert.Equal(t, first.ID, due[0].ID)
+	assert.Equal(t, second.ID, due[1].ID)
+	assert.Equal(t, first.Payload, due[0].Payload)
+	assert.Equal(t, int64(1), due[0].Version)
+
+	due, err = s.Due(context.Background(), now, 1)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+
+	// Stale writes are rejected
+	assert.Equal(t, ErrConflict, s.Put(context.Background(), first))
+
+	e := due[0]
+	e.Status = StatusDead
+	e.LastError = "API Client Error"
+	assert.NoError(t, s.Put(context.Background(), e))
+	dead, err := s.List(context.Background(), StatusDead)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "API Client Error", dead[0].LastError)
+
+	// Only delivered entries expire
+	e = dead[0]
+	e.Status = StatusDelivered
+	assert.NoError(t, s.Put(context.Background(), e))
+	assert.NotNil(t, m.items[e.ID]["expiresAt"])
+	assert.Nil(t, m.items[second.ID]["expiresAt"])
+}
+
+func TestDynamoDBStoreErrors(t *testing.T) {
+	_, err := NewDynamoDBStore(MockDynamoDBClient{}, "")
+	assert.Error(t, err)
+
+	s, err := NewDynamoDBStore(MockDynamoDBClient{isError: true}, "outbox")
+	assert.NoError(t, err)
+	assert.Error(t, s.Put(context.Background(), CreateUser("abc@gmail.com")))
+	_, err = s.Due(context.Background(), time.Now(), 10)
+	assert.Error(t, err)
+}
@@ -0,0 +1,81 @@
+package outbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+)
+
+// The side-effects the outbox knows how to deliver, see Deliverer
+const (
+	KindCreateUser   = "create_user"
+	KindPublishEvent = "publish_event"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	// Gave up after too many attempts, a copy is on the dead-letter queue
+	StatusDead = "dead"
+)
+
+// A side-effect, written durably before anything tries to deliver it
+type Entry struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+	Status  string          `json:"status"`
+	// Including the one in progress, an attempt is counted before it's made so a crash mid-delivery still counts
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	// Lets stores reject writes based on a stale read
+	Version int64 `json:"version"`
+}
+
+type CreateUserPayload struct {
+	Email string `json:"email"`
+}
+
+func NewEntry(kind string, payload interface{}) (Entry, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Entry{}, err
+	}
+	now := time.Now().UTC()
+	return Entry{
+		ID:          newID(),
+		Kind:        kind,
+		Payload:     b,
+		Status:      StatusPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}, nil
+}
+
+// The payloads below always marshal, so the typed constructors can't fail
+func mustNew(kind string, payload interface{}) Entry {
+	e, _ := NewEntry(kind, payload)
+	return e
+}
+
+// Creates the bk-user-api record for a newly verified user
+func CreateUser(email string) Entry {
+	return mustNew(KindCreateUser, CreateUserPayload{Email: email})
+}
+
+func PublishEvent(e userevents.Event) Entry {
+	return mustNew(KindPublishEvent, e)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,251 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"go.uber.org/zap"
+)
+
+// How long to wait before each retry, doubling from Base up to Max
+type RetryPolicy struct {
+	// Including the first, inline, attempt
+	MaxAttempts int
+	Base        time.Duration
+	Max         time.Duration
+}
+
+// Gives up after roughly four hours
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 8,
+	Base:        30 * time.Second,
+	Max:         time.Hour,
+}
+
+// The wait after the given number of attempts
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	d := p.Base
+	for i := 1; i < attempts && d < p.Max; i++ {
+		d *= 2
+	}
+	return min(d, p.Max)
+}
+
+type Config struct {
+	Store       Store
+	DeadLetters DeadLetterQueue
+	Retry       RetryPolicy
+}
+
+/*
+Uses the table named by OUTBOX_TABLE and the queue at OUTBOX_DLQ_URL, either of which falls back to memory if it isn't
+set, e.g. when running locally. OUTBOX_MAX_ATTEMPTS overrides the default retry policy's. If they are set but can't be
+used, it's an error rather than a fallback, since entries kept in memory are lost whenever the instance is.
+*/
+func ConfigFromEnv(ctx context.Context) (Config, error) {
+	c := Config{
+		Store:       NewMemoryStore(),
+		DeadLetters: NewMemoryDeadLetterQueue(),
+		Retry:       DefaultRetryPolicy,
+	}
+	if n, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && n > 0 {
+		c.Retry.MaxAttempts = n
+	}
+
+	table, queue := os.Getenv("OUTBOX_TABLE"), os.Getenv("OUTBOX_DLQ_URL")
+	if table == "" && queue == "" {
+		return c, nil
+	}
+	sdkConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return Config{}, err
+	}
+	if table != "" {
+		s, err := NewDynamoDBStore(dynamodb.NewFromConfig(sdkConfig), table)
+		if err != nil {
+			return Config{}, err
+		}
+		c.Store = s
+	}
+	if queue != "" {
+		c.DeadLetters = NewSQSDeadLetterQueue(sqs.NewFromConfig(sdkConfig), queue)
+	}
+	return c, nil
+}
+
+/*
+Writes side-effects to the store before trying them, so that anything which fails, or never gets tried because the
+Lambda timed out, is retried by the relay. Delivery is at least once, so deliverers should cope with repeats where
+they can.
+*/
+type Outbox struct {
+	deadLetters DeadLetterQueue
+	deliverers  Deliverers
+	logger      *zap.Logger
+	now         func() time.Time
+	retry       RetryPolicy
+	store       Store
+}
+
+func New(logger *zap.Logger, c Config, deliverers Deliverers) Outbox {
+	return Outbox{
+		deadLetters: c.DeadLetters,
+		deliverers:  deliverers,
+		logger:      logger,
+		now:         time.Now,
+		retry:       c.Retry,
+		store:       c.Store,
+	}
+}
+
+// What happened to an entry sent inline
+type Sent struct {
+	// False if the first attempt failed, in which case the relay has it
+	Delivered bool
+	Output    []byte
+}
+
+/*
+Writes the entry to the store, then makes the first attempt at delivering it. Only failing to write it is an error,
+once it's written the relay will deliver it eventually.
+*/
+func (o Outbox) Send(ctx context.Context, e Entry) (Sent, error) {
+	if err := o.store.Put(ctx, e); err != nil {
+		return Sent{}, err
+	}
+	e.Version++
+
+	r, _, err := o.deliver(ctx, e)
+	if err != nil {
+		o.logger.Warn("Outbox entry not delivered inline, leaving it for the relay", zap.String("id", e.ID), zap.String("kind", e.Kind), zap.Error(err))
+		return Sent{}, nil
+	}
+	return Sent{Delivered: true, Output: r.Output}, nil
+}
+
+// How a relay run went
+type Summary struct {
+	Delivered int `json:"delivered"`
+	Retried   int `json:"retried"`
+	Dead      int `json:"dead"`
+	// Claimed by something else between being listed and attempted
+	Skipped int `json:"skipped"`
+}
+
+// Attempts up to limit entries that are due, oldest first
+func (o Outbox) Relay(ctx context.Context, limit int) (Summary, error) {
+	due, err := o.store.Due(ctx, o.now(), limit)
+	if err != nil {
+		return Summary{}, err
+	}
+	return o.deliverDue(ctx, due)
+}
+
+func (o Outbox) deliverDue(ctx context.Context, due []Entry) (Summary, error) {
+	s := Summary{}
+	for _, e := range due {
+		if ctx.Err() != nil {
+			return s, ctx.Err()
+		}
+		_, last, err := o.deliver(ctx, e)
+		switch {
+		case errors.Is(err, ErrConflict):
+			s.Skipped++
+		case err == nil:
+			s.Delivered++
+		case last.Status == StatusDead:
+			s.Dead++
+		default:
+			s.Retried++
+		}
+	}
+	return s, nil
+}
+
+/*
+Claims the entry by recording the attempt before making it, so that anything else trying it at the same time gets
+ErrConflict. Returns the entry as it was last written.
+*/
+func (o Outbox) deliver(ctx context.Context, e Entry) (Result, Entry, error) {
+	e.Attempts++
+	e.NextAttempt = o.now().Add(o.retry.Backoff(e.Attempts))
+	if err := o.store.Put(ctx, e); err != nil {
+		return Result{}, e, err
+	}
+	e.Version++
+
+	d, ok := o.deliverers[e.Kind]
+	if !ok {
+		err := fmt.Errorf("no deliverer for %q entries", e.Kind)
+		// Retrying won't help
+		return Result{}, o.failed(ctx, e, err, true), err
+	}
+	r, err := d.Deliver(ctx, e)
+	if err != nil {
+		return Result{}, o.failed(ctx, e, err, false), err
+	}
+
+	// Only delivered once what depends on it is written, otherwise they'd be lost if this Lambda stopped here
+	for _, n := range r.Next {
+		if _, err := o.Send(ctx, n); err != nil {
+			return Result{}, o.failed(ctx, e, err, false), err
+		}
+	}
+
+	e.Status = StatusDelivered
+	e.LastError = ""
+	if err := o.store.Put(ctx, e); err != nil {
+		// It has still been delivered, the relay will just deliver it again
+		o.logger.Error("Failed to mark outbox entry delivered", zap.String("id", e.ID), zap.Error(err))
+	}
+	return r, e, nil
+}
+
+// Records the failure, and dead-letters the entry if it's out of attempts
+func (o Outbox) failed(ctx context.Context, e Entry, cause error, dead bool) Entry {
+	e.LastError = cause.Error()
+	if dead || e.Attempts >= o.retry.MaxAttempts {
+		if err := o.deadLetters.Send(ctx, e); err != nil {
+			// Left pending, so the relay tries it, and the dead-letter queue, again
+			o.logger.Error("Failed to send outbox entry to the dead-letter queue", zap.String("id", e.ID), zap.Error(err))
+		} else {
+			o.logger.Error("Outbox entry dead-lettered", zap.String("id", e.ID), zap.String("kind", e.Kind), zap.Int("attempts", e.Attempts), zap.Error(cause))
+			e.Status = StatusDead
+		}
+	}
+	if err := o.store.Put(ctx, e); err != nil {
+		o.logger.Error("Failed to record outbox delivery failure", zap.String("id", e.ID), zap.Error(err))
+		return e
+	}
+	e.Version++
+	return e
+}
+
+// Publishes events through the outbox, so one that fails to publish is retried rather than lost
+type Publisher struct {
+	outbox Outbox
+}
+
+// The outbox needs an EventDeliverer for the events to go anywhere
+func (o Outbox) Publisher() Publisher {
+	return Publisher{
+		outbox: o,
+	}
+}
+
+func (p Publisher) Publish(ctx context.Context, events ...userevents.Event) error {
+	for _, e := range events {
+		if _, err := p.outbox.Send(ctx, PublishEvent(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
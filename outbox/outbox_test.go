@@ -0,0 +1,251 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	userevents "github.com/benjaminkitson/bk-auth-api/events"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// Counts the records it creates
+type MockUserAPIClient struct {
+	isError *bool
+	created *int
+}
+
+func (c MockUserAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	if *c.isError {
+		return models.User{}, fmt.Errorf("API Client Error")
+	}
+	*c.created++
+	return models.User{UserID: fmt.Sprintf("mockUserID%d", *c.created), Email: email}, nil
+}
+
+// Keeps record IDs by email
+type MockUserIDStore struct {
+	isError bool
+	ids     map[string]string
+}
+
+func (s MockUserIDStore) UserID(ctx context.Context, email string) (string, error) {
+	if s.isError {
+		return "", fmt.Errorf("AdminGetUser error")
+	}
+	return s.ids[email], nil
+}
+
+func (s MockUserIDStore) SetUserID(ctx context.Context, email string, id string) error {
+	if s.isError {
+		return fmt.Errorf("AdminUpdateUserAttributes error")
+	}
+	s.ids[email] = id
+	return nil
+}
+
+type MockSQSClient struct {
+	calls *[]*sqs.SendMessageInput
+}
+
+func (m MockSQSClient) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	*m.calls = append(*m.calls, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type test struct {
+	outbox     Outbox
+	store      *MemoryStore
+	dlq        *MemoryDeadLetterQueue
+	publisher  *userevents.MemoryPublisher
+	userAPIErr *bool
+	now        *time.Time
+}
+
+func newTest(t *testing.T) test {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("Failed to initialise dev logger")
+	}
+	tt := test{
+		store:      NewMemoryStore(),
+		dlq:        NewMemoryDeadLetterQueue(),
+		publisher:  userevents.NewMemoryPublisher(),
+		userAPIErr: new(bool),
+		now:        new(time.Time),
+	}
+	*tt.now = time.Now()
+	tt.outbox = New(l, Config{Store: tt.store, DeadLetters: tt.dlq, Retry: RetryPolicy{MaxAttempts: 3, Base: time.Minute, Max: time.Hour}}, Deliverers{
+		KindCreateUser:   NewUserDeliverer(MockUserAPIClient{isError: tt.userAPIErr, created: new(int)}, MockUserIDStore{ids: map[string]string{}}),
+		KindPublishEvent: NewEventDeliverer(tt.publisher),
+	})
+	tt.outbox.now = func() time.Time { return *tt.now }
+	return tt
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{Base: 30 * time.Second, Max: 5 * time.Minute}
+	assert.Equal(t, 30*time.Second, p.Backoff(1))
+	assert.Equal(t, time.Minute, p.Backoff(2))
+	assert.Equal(t, 4*time.Minute, p.Backoff(4))
+	assert.Equal(t, 5*time.Minute, p.Backoff(5))
+	assert.Equal(t, 5*time.Minute, p.Backoff(100))
+}
+
+func TestSend(t *testing.T) {
+	tt := newTest(t)
+
+	s, err := tt.outbox.Send(context.Background(), CreateUser("abc@gmail.com"))
+	assert.NoError(t, err)
+	assert.True(t, s.Delivered)
+
+	var u models.User
+	assert.NoError(t, json.Unmarshal(s.Output, &u))
+	assert.Equal(t, "mockUserID1", u.UserID)
+
+	// The follow-up event is delivered inline too
+	assert.Len(t, tt.publisher.Events(), 1)
+	assert.Equal(t, userevents.TypeUserVerified, tt.publisher.Events()[0].Type)
+
+	delivered, _ := tt.store.List(context.Background(), StatusDelivered)
+	assert.Len(t, delivered, 2)
+}
+
+func TestRelay(t *testing.T) {
+	tt := newTest(t)
+	*tt.userAPIErr = true
+
+	s, err := tt.outbox.Send(context.Background(), CreateUser("abc@gmail.com"))
+	assert.NoError(t, err)
+	assert.False(t, s.Delivered)
+
+	// Not due until the backoff has passed
+	summary, err := tt.outbox.Relay(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{}, summary)
+
+	*tt.now = tt.now.Add(time.Minute)
+	summary, err = tt.outbox.Relay(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Retried: 1}, summary)
+
+	*tt.userAPIErr = false
+	*tt.now = tt.now.Add(2 * time.Minute)
+	summary, err = tt.outbox.Relay(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Delivered: 1}, summary)
+	assert.Len(t, tt.publisher.Events(), 1)
+	assert.Empty(t, tt.dlq.Entries())
+}
+
+// Delivering the same entry again finds the ID the first delivery recorded
+func TestUserDelivererIsIdempotent(t *testing.T) {
+	c := MockUserAPIClient{isError: new(bool), created: new(int)}
+	d := NewUserDeliverer(c, MockUserIDStore{ids: map[string]string{}})
+	e := CreateUser("abc@gmail.com")
+
+	first, err := d.Deliver(context.Background(), e)
+	assert.NoError(t, err)
+	second, err := d.Deliver(context.Background(), e)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, *c.created)
+	assert.JSONEq(t, string(first.Output), string(second.Output))
+	assert.Len(t, second.Next, 1)
+}
+
+// Failing to look the ID up isn't taken to mean there's no record, the entry is retried instead
+func TestUserDelivererLookupError(t *testing.T) {
+	c := MockUserAPIClient{isError: new(bool), created: new(int)}
+	d := NewUserDeliverer(c, MockUserIDStore{isError: true})
+
+	_, err := d.Deliver(context.Background(), CreateUser("abc@gmail.com"))
+	assert.EqualError(t, err, "AdminGetUser error")
+	assert.Equal(t, 0, *c.created)
+}
+
+func TestRelayDeadLetters(t *testing.T) {
+	tt := newTest(t)
+	*tt.userAPIErr = true
+
+	_, err := tt.outbox.Send(context.Background(), CreateUser("abc@gmail.com"))
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		*tt.now = tt.now.Add(time.Hour)
+		_, err := tt.outbox.Relay(context.Background(), 10)
+		assert.NoError(t, err)
+	}
+
+	dead, _ := tt.store.List(context.Background(), StatusDead)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "API Client Error", dead[0].LastError)
+	assert.Len(t, tt.dlq.Entries(), 1)
+
+	// Dead entries aren't tried again
+	*tt.now = tt.now.Add(time.Hour)
+	summary, err := tt.outbox.Relay(context.Background(), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{}, summary)
+}
+
+func TestUnknownKind(t *testing.T) {
+	tt := newTest(t)
+
+	e, err := NewEntry("unknown", map[string]string{})
+	assert.NoError(t, err)
+	s, err := tt.outbox.Send(context.Background(), e)
+	assert.NoError(t, err)
+	assert.False(t, s.Delivered)
+
+	// Straight to the dead-letter queue, there's no point retrying
+	assert.Len(t, tt.dlq.Entries(), 1)
+}
+
+func TestRelaySkipsClaimed(t *testing.T) {
+	tt := newTest(t)
+	*tt.userAPIErr = true
+
+	_, err := tt.outbox.Send(context.Background(), CreateUser("abc@gmail.com"))
+	assert.NoError(t, err)
+	*tt.now = tt.now.Add(time.Hour)
+
+	// Claimed by another relay after this one listed it
+	due, _ := tt.store.Due(context.Background(), *tt.now, 10)
+	claimed := due[0]
+	claimed.Attempts++
+	assert.NoError(t, tt.store.Put(context.Background(), claimed))
+
+	summary, err := tt.outbox.deliverDue(context.Background(), due)
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Skipped: 1}, summary)
+}
+
+func TestPublisher(t *testing.T) {
+	tt := newTest(t)
+
+	e := userevents.UserSignedUp("abc@gmail.com")
+	assert.NoError(t, tt.outbox.Publisher().Publish(context.Background(), e))
+	assert.Equal(t, []userevents.Event{e}, tt.publisher.Events())
+}
+
+func TestSQSDeadLetterQueue(t *testing.T) {
+	calls := []*sqs.SendMessageInput{}
+	q := NewSQSDeadLetterQueue(MockSQSClient{calls: &calls}, "https://sqs.eu-west-2.amazonaws.com/123456789012/outbox-dlq")
+
+	e := CreateUser("abc@gmail.com")
+	assert.NoError(t, q.Send(context.Background(), e))
+	assert.Len(t, calls, 1)
+	assert.Equal(t, KindCreateUser, aws.ToString(calls[0].MessageAttributes["kind"].StringValue))
+
+	var m Entry
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(calls[0].MessageBody)), &m))
+	assert.Equal(t, e.ID, m.ID)
+}
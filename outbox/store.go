@@ -0,0 +1,83 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Returned by Put when the entry has changed since it was read, e.g. because another relay has claimed it
+var ErrConflict = errors.New("outbox entry changed concurrently")
+
+type Store interface {
+	// Saves the entry if it hasn't changed since it was read, new entries have a Version of 0
+	Put(ctx context.Context, e Entry) error
+	// Pending entries due an attempt at or before now, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]Entry, error)
+	// Every entry with the status, for reporting on what's stuck
+	List(ctx context.Context, status string) ([]Entry, error)
+}
+
+/*
+Keeps entries in the Lambda's memory, so nothing survives the instance and the relay never sees them. Fine for tests
+and local development, DynamoDBStore is what makes the outbox durable.
+*/
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]Entry{},
+	}
+}
+
+func (s *MemoryStore) Put(_ context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries[e.ID].Version != e.Version {
+		return ErrConflict
+	}
+	e.Version++
+	s.entries[e.ID] = e
+	return nil
+}
+
+func (s *MemoryStore) Due(_ context.Context, now time.Time, limit int) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := []Entry{}
+	for _, e := range s.entries {
+		if e.Status == StatusPending && !e.NextAttempt.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttempt.Before(due[j].NextAttempt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) List(_ context.Context, status string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l := []Entry{}
+	for _, e := range s.entries {
+		if e.Status == status {
+			l = append(l, e)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].CreatedAt.Before(l[j].CreatedAt)
+	})
+	return l, nil
+}
@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+/*
+Keeps records in a DynamoDB table with a string partition key "pk", so that every Lambda instance sees the same
+limits. The table's TTL attribute should be "expiresAt", which is how old records get cleaned up.
+*/
+type DynamoDBStore struct {
+	client DynamoDBClient
+	table  string
+}
+
+func NewDynamoDBStore(c DynamoDBClient, table string) (DynamoDBStore, error) {
+	if table == "" {
+		return DynamoDBStore{}, fmt.Errorf("no table name supplied")
+	}
+	return DynamoDBStore{
+		client: c,
+		table:  table,
+	}, nil
+}
+
+func (s DynamoDBStore) Get(ctx context.Context, key string) (Record, error) {
+	o, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: key}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return Record{}, err
+	}
+	if o.Item == nil {
+		return Record{}, nil
+	}
+
+	// TTL deletion can lag by hours, so expired items are ignored rather than relied on being gone
+	if expiresAt, err := number(o.Item, "expiresAt"); err == nil && expiresAt > 0 && time.Now().Unix() > expiresAt {
+		v, _ := number(o.Item, "version")
+		return Record{Version: v}, nil
+	}
+
+	r := Record{}
+	if l, ok := o.Item["attempts"].(*types.AttributeValueMemberL); ok {
+		for _, a := range l.Value {
+			n, ok := a.(*types.AttributeValueMemberN)
+			if !ok {
+				continue
+			}
+			ms, err := strconv.ParseInt(n.Value, 10, 64)
+			if err != nil {
+				return Record{}, err
+			}
+			r.Attempts = append(r.Attempts, time.UnixMilli(ms))
+		}
+	}
+	lockouts, err := number(o.Item, "lockouts")
+	if err != nil {
+		return Record{}, err
+	}
+	r.Lockouts = int(lockouts)
+	lockedUntil, err := number(o.Item, "lockedUntil")
+	if err != nil {
+		return Record{}, err
+	}
+	if lockedUntil > 0 {
+		r.LockedUntil = time.UnixMilli(lockedUntil)
+	}
+	r.Version, err = number(o.Item, "version")
+	if err != nil {
+		return Record{}, err
+	}
+	return r, nil
+}
+
+func (s DynamoDBStore) Put(ctx context.Context, key string, r Record, expires time.Time) error {
+	attempts := make([]types.AttributeValue, len(r.Attempts))
+	for i, a := range r.Attempts {
+		attempts[i] = &types.AttributeValueMemberN{Value: strconv.FormatInt(a.UnixMilli(), 10)}
+	}
+	var lockedUntil int64
+	if !r.LockedUntil.IsZero() {
+		lockedUntil = r.LockedUntil.UnixMilli()
+	}
+
+	in := &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"pk":          &types.AttributeValueMemberS{Value: key},
+			"attempts":    &types.AttributeValueMemberL{Value: attempts},
+			"lockouts":    &types.AttributeValueMemberN{Value: strconv.Itoa(r.Lockouts)},
+			"lockedUntil": &types.AttributeValueMemberN{Value: strconv.FormatInt(lockedUntil, 10)},
+			"version":     &types.AttributeValueMemberN{Value: strconv.FormatInt(r.Version+1, 10)},
+			"expiresAt":   &types.AttributeValueMemberN{Value: strconv.FormatInt(expires.Unix(), 10)},
+		},
+	}
+	if r.Version == 0 {
+		in.ConditionExpression = aws.String("attribute_not_exists(pk)")
+	} else {
+		in.ConditionExpression = aws.String("version = :version")
+		in.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(r.Version, 10)},
+		}
+	}
+
+	_, err := s.client.PutItem(ctx, in)
+	var ccf *types.ConditionalCheckFailedException
+	if errors.As(err, &ccf) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s DynamoDBStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key:       map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: key}},
+	})
+	return err
+}
+
+// Missing attributes read as 0
+func number(item map[string]types.AttributeValue, name string) (int64, error) {
+	n, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, nil
+	}
+	return strconv.ParseInt(n.Value, 10, 64)
+}
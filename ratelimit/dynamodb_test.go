@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// Just enough of DynamoDB to check the conditional writes
+type MockDynamoDBClient struct {
+	isError bool
+	items   map[string]map[string]types.AttributeValue
+}
+
+func (m MockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("GetItem error")
+	}
+	k := params.Key["pk"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[k]}, nil
+}
+
+func (m MockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("PutItem error")
+	}
+	k := params.Item["pk"].(*types.AttributeValueMemberS).Value
+	existing, ok := m.items[k]
+	switch aws.ToString(params.ConditionExpression) {
+	case "attribute_not_exists(pk)":
+		if ok {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	case "version = :version":
+		v := params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value
+		if !ok || existing["version"].(*types.AttributeValueMemberN).Value != v {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	}
+	m.items[k] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m MockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if m.isError {
+		return nil, fmt.Errorf("DeleteItem error")
+	}
+	delete(m.items, params.Key["pk"].(*types.AttributeValueMemberS).Value)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	m := MockDynamoDBClient{items: map[string]map[string]types.AttributeValue{}}
+	s, err := NewDynamoDBStore(m, "rate-limits")
+	assert.Nil(t, err)
+
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+
+	r, err := s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Equal(t, Record{}, r)
+
+	r.Attempts = []time.Time{now.Add(-time.Second), now}
+	r.Lockouts = 2
+	r.LockedUntil = now.Add(time.Minute)
+	assert.Nil(t, s.Put(ctx, "ip:1.2.3.4", r, now.Add(time.Hour)))
+
+	stale := r
+	r, err = s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Equal(t, Record{
+		Attempts:    []time.Time{now.Add(-time.Second), now},
+		Lockouts:    2,
+		LockedUntil: now.Add(time.Minute),
+		Version:     1,
+	}, r)
+
+	assert.Nil(t, s.Put(ctx, "ip:1.2.3.4", r, now.Add(time.Hour)))
+	assert.ErrorIs(t, s.Put(ctx, "ip:1.2.3.4", stale, now.Add(time.Hour)), ErrConflict)
+	assert.ErrorIs(t, s.Put(ctx, "ip:1.2.3.4", r, now.Add(time.Hour)), ErrConflict)
+
+	// Expired records are ignored even if DynamoDB hasn't deleted them yet
+	r, err = s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put(ctx, "ip:1.2.3.4", r, now.Add(-time.Hour)))
+	r, err = s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Equal(t, Record{Version: 3}, r)
+
+	assert.Nil(t, s.Delete(ctx, "ip:1.2.3.4"))
+	r, err = s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Equal(t, Record{}, r)
+
+	_, err = NewDynamoDBStore(m, "")
+	assert.NotNil(t, err)
+
+	e, err := NewDynamoDBStore(MockDynamoDBClient{isError: true}, "rate-limits")
+	assert.Nil(t, err)
+	_, err = e.Get(ctx, "ip:1.2.3.4")
+	assert.NotNil(t, err)
+}
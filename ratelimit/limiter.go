@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// What a limit applies to, each kind has its own Policy
+const (
+	KindIP    = "ip"
+	KindEmail = "email"
+	// A signed in user's access token, for requests that don't name the user
+	KindToken = "token"
+)
+
+type Key struct {
+	Kind  string
+	Value string
+}
+
+func (k Key) String() string {
+	return k.Kind + ":" + k.Value
+}
+
+func IP(ip string) Key {
+	return Key{Kind: KindIP, Value: ip}
+}
+
+// Emails are normalised so that case and whitespace don't give an attacker extra attempts, and hashed to keep them out of the store
+func Email(email string) Key {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return Key{Kind: KindEmail, Value: hex.EncodeToString(h[:16])}
+}
+
+// Hashed like emails, tokens are credentials in their own right
+func Token(token string) Key {
+	if token == "" {
+		return Key{Kind: KindToken}
+	}
+	h := sha256.Sum256([]byte(token))
+	return Key{Kind: KindToken, Value: hex.EncodeToString(h[:16])}
+}
+
+/*
+Allows Limit attempts in any Window. Going over locks the key out for BaseLockout, doubling with each lockout that
+follows, up to MaxLockout.
+*/
+type Policy struct {
+	Limit       int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// IPs get more attempts than emails, as plenty of legitimate users can share one
+var DefaultPolicies = map[string]Policy{
+	KindIP: {
+		Limit:       50,
+		Window:      15 * time.Minute,
+		BaseLockout: time.Minute,
+		MaxLockout:  time.Hour,
+	},
+	KindEmail: {
+		Limit:       5,
+		Window:      15 * time.Minute,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	},
+	KindToken: {
+		Limit:       5,
+		Window:      15 * time.Minute,
+		BaseLockout: time.Minute,
+		MaxLockout:  24 * time.Hour,
+	},
+}
+
+type Limiter struct {
+	logger   *zap.Logger
+	now      func() time.Time
+	policies map[string]Policy
+	store    Store
+}
+
+func NewLimiter(logger *zap.Logger, store Store, policies map[string]Policy) Limiter {
+	return Limiter{
+		logger:   logger,
+		now:      time.Now,
+		policies: policies,
+		store:    store,
+	}
+}
+
+// How many times an update is retried when another request changes the record first
+const maxConflicts = 3
+
+/*
+Records an attempt against each key. If any of them are locked out, it returns how long until the caller can try
+again, otherwise 0.
+*/
+func (l Limiter) Allow(ctx context.Context, keys ...Key) (time.Duration, error) {
+	var retryAfter time.Duration
+	for _, k := range keys {
+		p, ok := l.policies[k.Kind]
+		if !ok || k.Value == "" {
+			continue
+		}
+
+		var wait time.Duration
+		var err error
+		for i := 0; i < maxConflicts; i++ {
+			wait, err = l.hit(ctx, k, p)
+			if !errors.Is(err, ErrConflict) {
+				break
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+	return retryAfter, nil
+}
+
+func (l Limiter) hit(ctx context.Context, k Key, p Policy) (time.Duration, error) {
+	now := l.now()
+	r, err := l.store.Get(ctx, k.String())
+	if err != nil {
+		return 0, err
+	}
+
+	if now.Before(r.LockedUntil) {
+		return r.LockedUntil.Sub(now), nil
+	}
+
+	// Sliding window, only attempts from the last Window count
+	attempts := []time.Time{}
+	for _, a := range r.Attempts {
+		if now.Sub(a) < p.Window {
+			attempts = append(attempts, a)
+		}
+	}
+	r.Attempts = append(attempts, now)
+
+	var wait time.Duration
+	if len(r.Attempts) > p.Limit {
+		wait = p.BaseLockout << r.Lockouts
+		if wait > p.MaxLockout || wait <= 0 {
+			wait = p.MaxLockout
+		}
+		r.Lockouts++
+		r.LockedUntil = now.Add(wait)
+		r.Attempts = nil
+		l.logger.Warn("Rate limit lockout",
+			zap.String("key", k.String()),
+			zap.Int("lockouts", r.Lockouts),
+			zap.Duration("duration", wait),
+		)
+	}
+
+	// Lockouts keep escalating until the key has been quiet for a while
+	err = l.store.Put(ctx, k.String(), r, now.Add(p.Window+p.MaxLockout))
+	return wait, err
+}
+
+// Clears the keys' history, e.g. once the user has proved they know the password
+func (l Limiter) Reset(ctx context.Context, keys ...Key) error {
+	for _, k := range keys {
+		if err := l.store.Delete(ctx, k.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var testPolicies = map[string]Policy{
+	KindIP: {
+		Limit:       3,
+		Window:      time.Minute,
+		BaseLockout: time.Minute,
+		MaxLockout:  4 * time.Minute,
+	},
+}
+
+func TestAllow(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	l := NewLimiter(zap.New(core), s, testPolicies)
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	k := IP("1.2.3.4")
+
+	type step struct {
+		Advance            time.Duration
+		ExpectedRetryAfter time.Duration
+	}
+
+	steps := []step{
+		{},
+		{Advance: 10 * time.Second},
+		{Advance: 10 * time.Second},
+		// Fourth attempt within the window
+		{Advance: 10 * time.Second, ExpectedRetryAfter: time.Minute},
+		{Advance: 30 * time.Second, ExpectedRetryAfter: 30 * time.Second},
+		// Lockout over, the window starts again
+		{Advance: 30 * time.Second},
+		// Attempts slide out of the window
+		{Advance: 50 * time.Second},
+		{Advance: 50 * time.Second},
+		{Advance: 1 * time.Second},
+		// Second lockout is twice as long
+		{Advance: 1 * time.Second, ExpectedRetryAfter: 2 * time.Minute},
+		{Advance: 2 * time.Minute},
+		{},
+		{},
+		// Capped at MaxLockout
+		{ExpectedRetryAfter: 4 * time.Minute},
+		{Advance: 4 * time.Minute},
+		{},
+		{},
+		{ExpectedRetryAfter: 4 * time.Minute},
+	}
+
+	for i, st := range steps {
+		now = now.Add(st.Advance)
+		r, err := l.Allow(ctx, k, Email("abc@gmail.com"))
+		assert.Nil(t, err)
+		assert.Equal(t, st.ExpectedRetryAfter, r, "step %d", i)
+	}
+
+	assert.Equal(t, 4, logs.FilterMessage("Rate limit lockout").Len())
+
+	assert.Nil(t, l.Reset(ctx, k))
+	r, err := l.Allow(ctx, k)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), r)
+}
+
+func TestKeys(t *testing.T) {
+	assert.Equal(t, Email("abc@gmail.com"), Email(" ABC@gmail.com "))
+	assert.NotEqual(t, Email("abc@gmail.com"), Email("abd@gmail.com"))
+	assert.NotContains(t, Email("abc@gmail.com").String(), "abc")
+	assert.Equal(t, "ip:1.2.3.4", IP("1.2.3.4").String())
+	assert.NotEqual(t, Token("abc"), Token("abd"))
+	assert.NotContains(t, Token("abc").String(), "abc")
+	// Skipped by Allow, like any other key without a value
+	assert.Empty(t, Token("").Value)
+}
+
+func TestMemoryStoreConflict(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+
+	r, err := s.Get(ctx, "ip:1.2.3.4")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Put(ctx, "ip:1.2.3.4", r, time.Now().Add(time.Minute)))
+	// r is now stale
+	assert.ErrorIs(t, s.Put(ctx, "ip:1.2.3.4", r, time.Now().Add(time.Minute)), ErrConflict)
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type Record struct {
+	Attempts    []time.Time
+	Lockouts    int
+	LockedUntil time.Time
+	// Lets stores reject writes based on a stale read
+	Version int64
+}
+
+// Returned by Put when the record has changed since it was read
+var ErrConflict = errors.New("rate limit record changed concurrently")
+
+type Store interface {
+	// Returns an empty Record if there isn't one for the key
+	Get(ctx context.Context, key string) (Record, error)
+	// Saves the record if it hasn't changed since it was read, it can be forgotten after expires
+	Put(ctx context.Context, key string, r Record, expires time.Time) error
+	Delete(ctx context.Context, key string) error
+}
+
+/*
+Keeps records in the Lambda's memory, so limits only apply per instance. Fine for tests and local development,
+DynamoDBStore shares them between instances.
+*/
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]memoryRecord
+	now     func() time.Time
+}
+
+type memoryRecord struct {
+	record  Record
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records: map[string]memoryRecord{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.records[key]
+	if !ok {
+		return Record{}, nil
+	}
+	if s.now().After(r.expires) {
+		delete(s.records, key)
+		return Record{}, nil
+	}
+	return r.record, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, r Record, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.records[key].record.Version != r.Version {
+		return ErrConflict
+	}
+	r.Version++
+	s.records[key] = memoryRecord{record: r, expires: expires}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, key)
+	return nil
+}
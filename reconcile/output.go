@@ -0,0 +1,112 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func (r Report) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+var csvHeader = []string{"kind", "sub", "cognitoEmail", "repaired", "error"}
+
+// One row per drift, dead outbox entries are only in the JSON
+func (r Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, d := range r.Drift {
+		err := cw.Write([]string{d.Kind, d.Sub, csvSafe(d.CognitoEmail), strconv.FormatBool(d.Repaired), csvSafe(d.Error)})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Stops spreadsheets treating a value as a formula, emails are user supplied
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+/*
+Saves the JSON and CSV reports side by side in a bucket, named after when the report was generated. The reports
+contain email addresses, so the bucket should be private and encrypted.
+*/
+type S3Output struct {
+	client S3Client
+	bucket string
+	prefix string
+}
+
+func NewS3Output(c S3Client, bucket string, prefix string) S3Output {
+	return S3Output{
+		client: c,
+		bucket: bucket,
+		prefix: prefix,
+	}
+}
+
+func (o S3Output) Save(ctx context.Context, r Report) error {
+	name := fmt.Sprintf("%s%s-%s", o.prefix, r.GeneratedAt.Format("2006-01-02T15-04-05Z"), r.Mode)
+
+	var j, c bytes.Buffer
+	if err := r.WriteJSON(&j); err != nil {
+		return err
+	}
+	if err := r.WriteCSV(&c); err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		key         string
+		contentType string
+		body        []byte
+	}{
+		{name + ".json", "application/json", j.Bytes()},
+		{name + ".csv", "text/csv", c.Bytes()},
+	} {
+		_, err := o.client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(o.bucket),
+			Key:                  aws.String(f.key),
+			ContentType:          aws.String(f.contentType),
+			Body:                 bytes.NewReader(f.body),
+			ServerSideEncryption: types.ServerSideEncryptionAes256,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keeps nothing, for when there's no bucket to save reports to
+type discard struct{}
+
+func (discard) Save(context.Context, Report) error {
+	return nil
+}
+
+var Discard = discard{}
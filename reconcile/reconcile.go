@@ -0,0 +1,72 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/benjaminkitson/bk-auth-api/utils/logging"
+	"go.uber.org/zap"
+)
+
+type Reconciler struct {
+	authUsers auth.UserLister
+	logger    *zap.Logger
+	store     outbox.Store
+}
+
+func NewReconciler(logger *zap.Logger, a auth.UserLister, s outbox.Store) Reconciler {
+	return Reconciler{
+		authUsers: a,
+		logger:    logger,
+		store:     s,
+	}
+}
+
+/*
+Builds the report, and in repair mode queues a fix for each drift on the outbox for the relay to deliver, treating
+Cognito as the source of truth. The create user deliverer checks for a record ID first, so a user verified since
+Cognito was listed doesn't get a second record.
+*/
+func (rc Reconciler) Run(ctx context.Context, mode string) (Report, error) {
+	if mode != ModeDryRun && mode != ModeRepair {
+		return Report{}, fmt.Errorf("unknown reconciliation mode %q", mode)
+	}
+
+	authUsers, err := rc.authUsers.ListUsers(ctx)
+	if err != nil {
+		return Report{}, err
+	}
+	r := Compare(authUsers)
+	r.Mode = mode
+
+	r.DeadEntries, err = rc.store.List(ctx, outbox.StatusDead)
+	if err != nil {
+		return Report{}, err
+	}
+
+	if mode == ModeRepair {
+		for i := range r.Drift {
+			rc.repair(ctx, &r.Drift[i])
+		}
+	}
+	return r, nil
+}
+
+func (rc Reconciler) repair(ctx context.Context, d *Drift) {
+	var err error
+	switch d.Kind {
+	case DriftMissingRecord:
+		err = rc.store.Put(ctx, outbox.CreateUser(d.CognitoEmail))
+	default:
+		err = fmt.Errorf("no repair for %q", d.Kind)
+	}
+
+	if err != nil {
+		rc.logger.Error("Failed to repair drift", zap.String("kind", d.Kind), logging.Email("email", d.CognitoEmail), zap.Error(err))
+		d.Error = err.Error()
+		return
+	}
+	d.Repaired = true
+}
@@ -0,0 +1,81 @@
+package reconcile
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+)
+
+// The ways Cognito and bk-user-api can disagree
+const (
+	// Confirmed in Cognito with no bk-user-api record ID, e.g. because creating the record failed during verify
+	DriftMissingRecord = "missing_record"
+)
+
+const (
+	ModeDryRun = "dry-run"
+	ModeRepair = "repair"
+)
+
+type Drift struct {
+	Kind         string `json:"kind"`
+	Sub          string `json:"sub,omitempty"`
+	CognitoEmail string `json:"cognitoEmail,omitempty"`
+	// Only set in repair mode, where it means the fix has been queued on the outbox
+	Repaired bool   `json:"repaired"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	GeneratedAt  time.Time `json:"generatedAt"`
+	Mode         string    `json:"mode"`
+	CognitoUsers int       `json:"cognitoUsers"`
+	Drift        []Drift   `json:"drift"`
+	// Outbox entries the relay has given up on, which are often the cause of the drift
+	DeadEntries []outbox.Entry `json:"deadEntries"`
+}
+
+/*
+Finds confirmed Cognito users without a bk-user-api record ID. Unconfirmed users aren't expected to have a record yet.
+bk-user-api records can't be listed, so records with no Cognito user or a different email aren't reported.
+*/
+func Compare(authUsers []auth.User) Report {
+	r := Report{
+		GeneratedAt:  time.Now().UTC(),
+		Mode:         ModeDryRun,
+		CognitoUsers: len(authUsers),
+		Drift:        []Drift{},
+		DeadEntries:  []outbox.Entry{},
+	}
+
+	for _, u := range authUsers {
+		if u.Confirmed && u.UserID == "" {
+			r.Drift = append(r.Drift, Drift{Kind: DriftMissingRecord, Sub: u.ID, CognitoEmail: u.Email})
+		}
+	}
+
+	sort.SliceStable(r.Drift, func(i, j int) bool {
+		if r.Drift[i].Kind != r.Drift[j].Kind {
+			return r.Drift[i].Kind < r.Drift[j].Kind
+		}
+		return strings.ToLower(r.Drift[i].CognitoEmail) < strings.ToLower(r.Drift[j].CognitoEmail)
+	})
+	return r
+}
+
+// Nothing to fix
+func (r Report) Clean() bool {
+	return len(r.Drift) == 0 && len(r.DeadEntries) == 0
+}
+
+// How many of each kind of drift there is
+func (r Report) Counts() map[string]int {
+	c := map[string]int{}
+	for _, d := range r.Drift {
+		c[d.Kind]++
+	}
+	return c
+}
@@ -0,0 +1,174 @@
+package reconcile
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/benjaminkitson/bk-auth-api/outbox"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeCognito struct {
+	isError bool
+	users   []auth.User
+}
+
+func (f *fakeCognito) ListUsers(ctx context.Context) ([]auth.User, error) {
+	if f.isError {
+		return nil, fmt.Errorf("ListUsers error")
+	}
+	return f.users, nil
+}
+
+// A store that rejects every write
+type failingStore struct {
+	*outbox.MemoryStore
+}
+
+func (failingStore) Put(ctx context.Context, e outbox.Entry) error {
+	return fmt.Errorf("Put error")
+}
+
+func fakeUsers() *fakeCognito {
+	return &fakeCognito{users: []auth.User{
+		{ID: "sub1", Email: "abc@gmail.com", Confirmed: true, UserID: "id1"},
+		// Missing a record
+		{ID: "sub2", Email: "GHI@gmail.com", Confirmed: true},
+		{ID: "sub3", Email: "def@gmail.com", Confirmed: true},
+		// Not expected to have a record yet
+		{ID: "sub4", Email: "unconfirmed@gmail.com"},
+	}}
+}
+
+func TestCompare(t *testing.T) {
+	c := fakeUsers()
+	r := Compare(c.users)
+
+	// Ordered by email, ignoring case
+	assert.Equal(t, []Drift{
+		{Kind: DriftMissingRecord, Sub: "sub3", CognitoEmail: "def@gmail.com"},
+		{Kind: DriftMissingRecord, Sub: "sub2", CognitoEmail: "GHI@gmail.com"},
+	}, r.Drift)
+	assert.Equal(t, map[string]int{DriftMissingRecord: 2}, r.Counts())
+	assert.Equal(t, 4, r.CognitoUsers)
+	assert.False(t, r.Clean())
+
+	r = Compare([]auth.User{{ID: "sub1", Email: "abc@gmail.com", Confirmed: true, UserID: "id1"}})
+	assert.True(t, r.Clean())
+}
+
+func TestRunDryRun(t *testing.T) {
+	s := outbox.NewMemoryStore()
+	dead := outbox.CreateUser("ghi@gmail.com")
+	dead.Status = outbox.StatusDead
+	assert.NoError(t, s.Put(context.Background(), dead))
+
+	rc := NewReconciler(zap.NewNop(), fakeUsers(), s)
+	r, err := rc.Run(context.Background(), ModeDryRun)
+	assert.NoError(t, err)
+	assert.Equal(t, ModeDryRun, r.Mode)
+	assert.Len(t, r.Drift, 2)
+	assert.Len(t, r.DeadEntries, 1)
+
+	// Nothing queued
+	pending, err := s.List(context.Background(), outbox.StatusPending)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+	for _, d := range r.Drift {
+		assert.False(t, d.Repaired)
+	}
+}
+
+func TestRunRepair(t *testing.T) {
+	s := outbox.NewMemoryStore()
+	rc := NewReconciler(zap.NewNop(), fakeUsers(), s)
+	r, err := rc.Run(context.Background(), ModeRepair)
+	assert.NoError(t, err)
+	for _, d := range r.Drift {
+		assert.True(t, d.Repaired)
+		assert.Empty(t, d.Error)
+	}
+
+	// Queued for the relay to create
+	pending, err := s.List(context.Background(), outbox.StatusPending)
+	assert.NoError(t, err)
+	emails := []string{}
+	for _, e := range pending {
+		assert.Equal(t, outbox.KindCreateUser, e.Kind)
+		var p outbox.CreateUserPayload
+		assert.NoError(t, json.Unmarshal(e.Payload, &p))
+		emails = append(emails, p.Email)
+	}
+	assert.ElementsMatch(t, []string{"def@gmail.com", "GHI@gmail.com"}, emails)
+
+	rc = NewReconciler(zap.NewNop(), fakeUsers(), failingStore{outbox.NewMemoryStore()})
+	r, err = rc.Run(context.Background(), ModeRepair)
+	assert.NoError(t, err)
+	for _, d := range r.Drift {
+		assert.False(t, d.Repaired)
+		assert.Equal(t, "Put error", d.Error)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	c := fakeUsers()
+	rc := NewReconciler(zap.NewNop(), c, outbox.NewMemoryStore())
+	_, err := rc.Run(context.Background(), "fix-everything")
+	assert.Error(t, err)
+
+	c.isError = true
+	_, err = rc.Run(context.Background(), ModeDryRun)
+	assert.Error(t, err)
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := Report{Drift: []Drift{
+		{Kind: DriftMissingRecord, Sub: "sub3", CognitoEmail: "ghi@gmail.com", Repaired: true},
+		{Kind: DriftMissingRecord, Sub: "sub6", CognitoEmail: "=cmd@gmail.com", Error: "Put error"},
+	}}
+
+	var b bytes.Buffer
+	assert.NoError(t, r.WriteCSV(&b))
+	rows, err := csv.NewReader(&b).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{
+		csvHeader,
+		{DriftMissingRecord, "sub3", "ghi@gmail.com", "true", ""},
+		{DriftMissingRecord, "sub6", "'=cmd@gmail.com", "false", "Put error"},
+	}, rows)
+}
+
+type MockS3Client struct {
+	calls *[]*s3.PutObjectInput
+}
+
+func (m MockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	*m.calls = append(*m.calls, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3Output(t *testing.T) {
+	r, err := NewReconciler(zap.NewNop(), fakeUsers(), outbox.NewMemoryStore()).Run(context.Background(), ModeDryRun)
+	assert.NoError(t, err)
+
+	calls := []*s3.PutObjectInput{}
+	o := NewS3Output(MockS3Client{calls: &calls}, "reports", "reconciliation/")
+	assert.NoError(t, o.Save(context.Background(), r))
+
+	assert.Len(t, calls, 2)
+	name := "reconciliation/" + r.GeneratedAt.Format("2006-01-02T15-04-05Z") + "-dry-run"
+	assert.Equal(t, name+".json", aws.ToString(calls[0].Key))
+	assert.Equal(t, name+".csv", aws.ToString(calls[1].Key))
+
+	var saved Report
+	assert.NoError(t, json.NewDecoder(calls[0].Body).Decode(&saved))
+	assert.Equal(t, r.Drift, saved.Drift)
+}
@@ -0,0 +1,166 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const DefaultTTL = 5 * time.Minute
+
+// How long a background refresh gets, it can't use the context of the request that started it
+const refreshTimeout = 10 * time.Second
+
+type cacheKey struct {
+	name  string
+	stage string
+}
+
+type cacheEntry struct {
+	secret     Secret
+	fetched    time.Time
+	refreshing bool
+}
+
+/*
+Holds secrets between invocations of a lambda, so it should be created outside the handler and passed to
+NewCachingClient on each invocation. Secrets are used for the TTL, and once they're most of the way through it
+they're refreshed in the background so requests don't wait on Secrets Manager. If a secret can't be fetched once
+it's expired, the expired one is used until it can be.
+*/
+type Cache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*cacheEntry
+	ttl     time.Duration
+	// Entries older than this are refreshed in the background
+	refreshAfter time.Duration
+	now          func() time.Time
+	refreshes    sync.WaitGroup
+}
+
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		entries:      map[cacheKey]*cacheEntry{},
+		ttl:          ttl,
+		refreshAfter: ttl * 4 / 5,
+		now:          time.Now,
+	}
+}
+
+// Uses the TTL in SECRETS_CACHE_TTL (e.g. "10m"), or DefaultTTL if it isn't set
+func CacheFromEnv() (*Cache, error) {
+	v := os.Getenv("SECRETS_CACHE_TTL")
+	if v == "" {
+		return NewCache(DefaultTTL), nil
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil {
+		return NewCache(DefaultTTL), err
+	}
+	return NewCache(ttl), nil
+}
+
+// Forgets every secret, e.g. after a rotation
+func (c *Cache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[cacheKey]*cacheEntry{}
+}
+
+// Waits for any background refreshes to finish
+func (c *Cache) Wait() {
+	c.refreshes.Wait()
+}
+
+func (c *Cache) put(k cacheKey, s Secret) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[k] = &cacheEntry{secret: s, fetched: c.now()}
+}
+
+type CachingClient struct {
+	logger *zap.Logger
+	client fetcher
+	cache  *Cache
+}
+
+func NewCachingClient(l *zap.Logger, sm SecretsManagerClient, cache *Cache) (CachingClient, error) {
+	sc, err := NewSecretsClient(l, sm)
+	if err != nil {
+		return CachingClient{}, err
+	}
+	return CachingClient{
+		logger: l,
+		client: sc,
+		cache:  cache,
+	}, nil
+}
+
+func (cc CachingClient) Get(ctx context.Context, name string, stage string) (Secret, error) {
+	if stage == "" {
+		stage = StageCurrent
+	}
+	k := cacheKey{name: name, stage: stage}
+
+	cc.cache.mu.Lock()
+	e, ok := cc.cache.entries[k]
+	var stale Secret
+	if ok {
+		age := cc.cache.now().Sub(e.fetched)
+		if age < cc.cache.ttl {
+			if age >= cc.cache.refreshAfter && !e.refreshing {
+				e.refreshing = true
+				cc.cache.refreshes.Add(1)
+				go cc.refresh(k, e)
+			}
+			s := e.secret
+			cc.cache.mu.Unlock()
+			return s, nil
+		}
+		stale = e.secret
+	}
+	cc.cache.mu.Unlock()
+
+	s, err := cc.client.Get(ctx, name, stage)
+	if err != nil {
+		if ok {
+			cc.logger.Warn("Failed to refresh secret, using expired secret", zap.Error(err))
+			return stale, nil
+		}
+		return Secret{}, err
+	}
+	cc.cache.put(k, s)
+	return s, nil
+}
+
+func (cc CachingClient) refresh(k cacheKey, e *cacheEntry) {
+	defer cc.cache.refreshes.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+
+	s, err := cc.client.Get(ctx, k.name, k.stage)
+	if err != nil {
+		cc.logger.Warn("Failed to refresh secret in the background", zap.Error(err))
+		cc.cache.mu.Lock()
+		e.refreshing = false
+		cc.cache.mu.Unlock()
+		return
+	}
+	cc.cache.put(k, s)
+}
+
+func (cc CachingClient) GetSecret(ctx context.Context, ref string) (string, error) {
+	return getSecret(ctx, cc, ref, StageCurrent)
+}
+
+func (cc CachingClient) GetSecretVersion(ctx context.Context, ref string, stage string) (string, error) {
+	return getSecret(ctx, cc, ref, stage)
+}
+
+func (cc CachingClient) GetSecretBinary(ctx context.Context, name string, stage string) ([]byte, error) {
+	return getSecretBinary(ctx, cc, name, stage)
+}
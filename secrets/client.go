@@ -2,40 +2,152 @@ package secrets
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"go.uber.org/zap"
 )
 
-type SecretsClient struct {
-	logger *zap.Logger
-	smc    *secretsmanager.Client
+// Version stages, see https://docs.aws.amazon.com/secretsmanager/latest/userguide/getting-started.html#term_version
+const (
+	StageCurrent  = "AWSCURRENT"
+	StagePending  = "AWSPENDING"
+	StagePrevious = "AWSPREVIOUS"
+)
+
+// Returned (wrapped) when a secret#field reference names a field the secret doesn't have
+var ErrFieldNotFound = errors.New("secret field not found")
+
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
 }
 
+/*
+Secrets are referred to by name or ARN, optionally followed by #field to pick a field out of a secret that's a JSON
+object, e.g. "bk-auth/mailer#apiKey"
+*/
 type SecretGetter interface {
-	GetSecret(string) (string, error)
+	GetSecret(ctx context.Context, ref string) (string, error)
+}
+
+// One version of a secret. Binary is only set for secrets stored as binary, String otherwise
+type Secret struct {
+	Name          string
+	VersionID     string
+	VersionStages []string
+	String        string
+	Binary        []byte
+}
+
+func (s Secret) Bytes() []byte {
+	if s.Binary != nil {
+		return s.Binary
+	}
+	return []byte(s.String)
+}
+
+// Something that can fetch secret versions, which GetSecret, GetSecretVersion and GetSecretBinary are built on
+type fetcher interface {
+	Get(ctx context.Context, name string, stage string) (Secret, error)
+}
+
+type SecretsClient struct {
+	logger *zap.Logger
+	smc    SecretsManagerClient
 }
 
 /*
-Simple wrapper around the Secrets Manager client for retrieving a secret
-TODO: Write tests? Disproportionately complicated given how simple this is
+Gets secrets straight from Secrets Manager on every call. Lambdas should use a CachingClient, which this sits behind.
 */
-func NewSecretsClient(l *zap.Logger, sm *secretsmanager.Client) (SecretsClient, error) {
+func NewSecretsClient(l *zap.Logger, sm SecretsManagerClient) (SecretsClient, error) {
 	return SecretsClient{
 		logger: l,
 		smc:    sm,
 	}, nil
-
 }
 
-func (sc SecretsClient) GetSecret(name string) (string, error) {
-	sc.logger.Info("Getting secret")
-	sv, err := sc.smc.GetSecretValue(context.TODO(), &secretsmanager.GetSecretValueInput{
-		SecretId: &name,
+// Gets the version of the secret with the stage, or the current version if stage is empty
+func (sc SecretsClient) Get(ctx context.Context, name string, stage string) (Secret, error) {
+	if stage == "" {
+		stage = StageCurrent
+	}
+	sc.logger.Info("Getting secret", zap.String("stage", stage))
+	sv, err := sc.smc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(name),
+		VersionStage: aws.String(stage),
 	})
 	if err != nil {
 		sc.logger.Error("Failed to retrieve secret", zap.Error(err))
+		return Secret{}, err
+	}
+	return Secret{
+		Name:          aws.ToString(sv.Name),
+		VersionID:     aws.ToString(sv.VersionId),
+		VersionStages: sv.VersionStages,
+		String:        aws.ToString(sv.SecretString),
+		Binary:        sv.SecretBinary,
+	}, nil
+}
+
+func (sc SecretsClient) GetSecret(ctx context.Context, ref string) (string, error) {
+	return getSecret(ctx, sc, ref, StageCurrent)
+}
+
+// Like GetSecret, but for the version with the stage, e.g. StagePending while the secret is being rotated
+func (sc SecretsClient) GetSecretVersion(ctx context.Context, ref string, stage string) (string, error) {
+	return getSecret(ctx, sc, ref, stage)
+}
+
+func (sc SecretsClient) GetSecretBinary(ctx context.Context, name string, stage string) ([]byte, error) {
+	return getSecretBinary(ctx, sc, name, stage)
+}
+
+func getSecret(ctx context.Context, f fetcher, ref string, stage string) (string, error) {
+	name, field := ParseRef(ref)
+	s, err := f.Get(ctx, name, stage)
+	if err != nil {
 		return "", err
 	}
-	return *sv.SecretString, nil
+	if field == "" {
+		return string(s.Bytes()), nil
+	}
+	return Field(s.Bytes(), field)
+}
+
+func getSecretBinary(ctx context.Context, f fetcher, name string, stage string) ([]byte, error) {
+	s, err := f.Get(ctx, name, stage)
+	if err != nil {
+		return nil, err
+	}
+	return s.Bytes(), nil
+}
+
+// Splits "name#field" into its name and field, the field is empty if there isn't one
+func ParseRef(ref string) (string, string) {
+	name, field, _ := strings.Cut(ref, "#")
+	return name, field
+}
+
+/*
+Picks a top level field out of a secret that's a JSON object. Strings are returned as they are, anything else as
+JSON.
+*/
+func Field(secret []byte, field string) (string, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(secret, &fields); err != nil {
+		return "", fmt.Errorf("secret isn't a JSON object: %w", err)
+	}
+	v, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrFieldNotFound, field)
+	}
+	var s string
+	if err := json.Unmarshal(v, &s); err == nil {
+		return s, nil
+	}
+	return string(v), nil
 }
@@ -0,0 +1,372 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// Secrets by name then stage, counting the calls made for each
+type MockSecretsManagerClient struct {
+	mu       sync.Mutex
+	isError  bool
+	versions map[string]map[string]*secretsmanager.GetSecretValueOutput
+	calls    int
+}
+
+func (m *MockSecretsManagerClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.isError {
+		return nil, fmt.Errorf("GetSecretValue error")
+	}
+	v, ok := m.versions[aws.ToString(params.SecretId)][aws.ToString(params.VersionStage)]
+	if !ok {
+		return nil, fmt.Errorf("ResourceNotFoundException")
+	}
+	return v, nil
+}
+
+func (m *MockSecretsManagerClient) set(name string, stage string, value string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[name][stage] = &secretsmanager.GetSecretValueOutput{Name: aws.String(name), SecretString: aws.String(value)}
+}
+
+func (m *MockSecretsManagerClient) fail(isError bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.isError = isError
+}
+
+func (m *MockSecretsManagerClient) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func mockClient() *MockSecretsManagerClient {
+	return &MockSecretsManagerClient{versions: map[string]map[string]*secretsmanager.GetSecretValueOutput{
+		"COGNITO_CLIENT": {
+			StageCurrent: {Name: aws.String("COGNITO_CLIENT"), VersionId: aws.String("v2"), VersionStages: []string{StageCurrent}, SecretString: aws.String("client-id")},
+			StagePending: {Name: aws.String("COGNITO_CLIENT"), VersionId: aws.String("v3"), VersionStages: []string{StagePending}, SecretString: aws.String("new-client-id")},
+		},
+		"bk-auth/mailer": {
+			StageCurrent: {Name: aws.String("bk-auth/mailer"), SecretString: aws.String(`{"apiKey":"key","port":587,"tls":{"enabled":true}}`)},
+		},
+		"signing-key": {
+			StageCurrent: {Name: aws.String("signing-key"), SecretBinary: []byte{0x00, 0x01, 0xff}},
+		},
+		"empty": {
+			StageCurrent: {Name: aws.String("empty")},
+		},
+	}}
+}
+
+func TestGetSecret(t *testing.T) {
+	type test struct {
+		Name            string
+		Ref             string
+		Stage           string
+		ClientError     bool
+		Expected        string
+		ExpectedError   bool
+		ExpectedErrorIs error
+	}
+
+	tests := []test{
+		{
+			Name:     "Current version",
+			Ref:      "COGNITO_CLIENT",
+			Expected: "client-id",
+		},
+		{
+			Name:     "Pending version",
+			Ref:      "COGNITO_CLIENT",
+			Stage:    StagePending,
+			Expected: "new-client-id",
+		},
+		{
+			Name:     "String field",
+			Ref:      "bk-auth/mailer#apiKey",
+			Expected: "key",
+		},
+		{
+			Name:     "Number field",
+			Ref:      "bk-auth/mailer#port",
+			Expected: "587",
+		},
+		{
+			Name:     "Object field",
+			Ref:      "bk-auth/mailer#tls",
+			Expected: `{"enabled":true}`,
+		},
+		{
+			Name:            "Missing field",
+			Ref:             "bk-auth/mailer#password",
+			ExpectedError:   true,
+			ExpectedErrorIs: ErrFieldNotFound,
+		},
+		{
+			Name:          "Field of a secret that isn't JSON",
+			Ref:           "COGNITO_CLIENT#id",
+			ExpectedError: true,
+		},
+		{
+			Name:     "Binary",
+			Ref:      "signing-key",
+			Expected: "\x00\x01\xff",
+		},
+		{
+			Name:     "Neither string nor binary",
+			Ref:      "empty",
+			Expected: "",
+		},
+		{
+			Name:          "Missing secret",
+			Ref:           "missing",
+			ExpectedError: true,
+		},
+		{
+			Name:          "Client error",
+			Ref:           "COGNITO_CLIENT",
+			ClientError:   true,
+			ExpectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := mockClient()
+			m.isError = tt.ClientError
+			sc, err := NewSecretsClient(zap.NewNop(), m)
+			assert.Nil(t, err)
+
+			var v string
+			if tt.Stage == "" {
+				v, err = sc.GetSecret(context.Background(), tt.Ref)
+			} else {
+				v, err = sc.GetSecretVersion(context.Background(), tt.Ref, tt.Stage)
+			}
+			if tt.ExpectedError {
+				assert.Error(t, err)
+				if tt.ExpectedErrorIs != nil {
+					assert.ErrorIs(t, err, tt.ExpectedErrorIs)
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.Expected, v)
+		})
+	}
+}
+
+func TestGetSecretBinary(t *testing.T) {
+	sc, err := NewSecretsClient(zap.NewNop(), mockClient())
+	assert.Nil(t, err)
+
+	b, err := sc.GetSecretBinary(context.Background(), "signing-key", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x01, 0xff}, b)
+
+	// String secrets come back as their bytes
+	b, err = sc.GetSecretBinary(context.Background(), "COGNITO_CLIENT", StageCurrent)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("client-id"), b)
+
+	s, err := sc.Get(context.Background(), "COGNITO_CLIENT", "")
+	assert.Nil(t, err)
+	assert.Equal(t, Secret{Name: "COGNITO_CLIENT", VersionID: "v2", VersionStages: []string{StageCurrent}, String: "client-id"}, s)
+}
+
+func TestParseRef(t *testing.T) {
+	for ref, expected := range map[string][2]string{
+		"COGNITO_CLIENT":        {"COGNITO_CLIENT", ""},
+		"bk-auth/mailer#apiKey": {"bk-auth/mailer", "apiKey"},
+		"arn:aws:secretsmanager:eu-west-2:123456789012:secret:mailer-AbCdEf#apiKey": {"arn:aws:secretsmanager:eu-west-2:123456789012:secret:mailer-AbCdEf", "apiKey"},
+	} {
+		name, field := ParseRef(ref)
+		assert.Equal(t, expected, [2]string{name, field}, ref)
+	}
+}
+
+// A cache with a clock the test moves along
+func testCache(ttl time.Duration) (*Cache, func(time.Duration)) {
+	c := NewCache(ttl)
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	return c, func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+}
+
+func TestCachingClient(t *testing.T) {
+	m := mockClient()
+	cache, advance := testCache(10 * time.Minute)
+	cc, err := NewCachingClient(zap.NewNop(), m, cache)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	v, err := cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "client-id", v)
+	assert.Equal(t, 1, m.count())
+
+	// Fields and other clients share what's cached
+	v, err = cc.GetSecret(ctx, "bk-auth/mailer#apiKey")
+	assert.Nil(t, err)
+	assert.Equal(t, "key", v)
+	v, err = cc.GetSecret(ctx, "bk-auth/mailer#port")
+	assert.Nil(t, err)
+	assert.Equal(t, "587", v)
+	other, err := NewCachingClient(zap.NewNop(), m, cache)
+	assert.Nil(t, err)
+	_, err = other.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, m.count())
+
+	// Stages are cached separately
+	v, err = cc.GetSecretVersion(ctx, "COGNITO_CLIENT", StagePending)
+	assert.Nil(t, err)
+	assert.Equal(t, "new-client-id", v)
+	assert.Equal(t, 3, m.count())
+
+	// Rotated, but the cached version is used until it's due a refresh
+	m.set("COGNITO_CLIENT", StageCurrent, "rotated-client-id")
+	advance(5 * time.Minute)
+	v, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "client-id", v)
+	assert.Equal(t, 3, m.count())
+
+	cache.Clear()
+	v, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-client-id", v)
+	assert.Equal(t, 4, m.count())
+}
+
+func TestCachingClientRefresh(t *testing.T) {
+	m := mockClient()
+	cache, advance := testCache(10 * time.Minute)
+	cc, err := NewCachingClient(zap.NewNop(), m, cache)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	m.set("COGNITO_CLIENT", StageCurrent, "rotated-client-id")
+
+	// Due a refresh, the cached version is used while it happens
+	advance(9 * time.Minute)
+	v, err := cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "client-id", v)
+	cache.Wait()
+	assert.Equal(t, 2, m.count())
+
+	v, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-client-id", v)
+	assert.Equal(t, 2, m.count())
+
+	// A failed refresh is tried again by the next call
+	m.fail(true)
+	advance(9 * time.Minute)
+	_, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	cache.Wait()
+	_, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	cache.Wait()
+	assert.Equal(t, 4, m.count())
+}
+
+func TestCachingClientExpired(t *testing.T) {
+	m := mockClient()
+	cache, advance := testCache(10 * time.Minute)
+	cc, err := NewCachingClient(zap.NewNop(), m, cache)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	_, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+
+	// Expired, so fetched before it's used
+	m.set("COGNITO_CLIENT", StageCurrent, "rotated-client-id")
+	advance(11 * time.Minute)
+	v, err := cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-client-id", v)
+	assert.Equal(t, 2, m.count())
+
+	// The expired version is better than nothing
+	m.fail(true)
+	advance(11 * time.Minute)
+	v, err = cc.GetSecret(ctx, "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	assert.Equal(t, "rotated-client-id", v)
+
+	// But there's nothing to fall back on for a secret that was never fetched
+	_, err = cc.GetSecret(ctx, "bk-auth/mailer#apiKey")
+	assert.Error(t, err)
+}
+
+func TestCachingClientConcurrent(t *testing.T) {
+	m := mockClient()
+	cache, advance := testCache(10 * time.Minute)
+	cc, err := NewCachingClient(zap.NewNop(), m, cache)
+	assert.Nil(t, err)
+
+	_, err = cc.GetSecret(context.Background(), "COGNITO_CLIENT")
+	assert.Nil(t, err)
+	advance(9 * time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := cc.GetSecret(context.Background(), "COGNITO_CLIENT")
+			assert.Nil(t, err)
+			assert.Equal(t, "client-id", v)
+		}()
+	}
+	wg.Wait()
+	cache.Wait()
+
+	// Only one background refresh for all of them
+	assert.Equal(t, 2, m.count())
+}
+
+func TestCacheFromEnv(t *testing.T) {
+	c, err := CacheFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultTTL, c.ttl)
+
+	t.Setenv("SECRETS_CACHE_TTL", "1m")
+	c, err = CacheFromEnv()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, c.ttl)
+	assert.Equal(t, 48*time.Second, c.refreshAfter)
+
+	t.Setenv("SECRETS_CACHE_TTL", "soon")
+	c, err = CacheFromEnv()
+	assert.Error(t, err)
+	assert.Equal(t, DefaultTTL, c.ttl)
+}
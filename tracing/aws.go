@@ -0,0 +1,14 @@
+package tracing
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+)
+
+/*
+Creates a span for every call made by clients created from the SDK config, e.g. CognitoIdentityProvider.InitiateAuth,
+and puts the trace headers on the request so that X-Ray links it to the service's own segment
+*/
+func (t Tracing) InstrumentAWS(cfg *aws.Config) {
+	otelaws.AppendMiddlewares(&cfg.APIOptions, otelaws.WithTracerProvider(t.provider), otelaws.WithTextMapPropagator(Propagator))
+}
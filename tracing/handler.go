@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// The header Lambda sets _X_AMZN_TRACE_ID from on each invocation when active tracing is on
+const xrayHeader = "X-Amzn-Trace-Id"
+
+/*
+Creates a span for every request the handler serves, a child of the Lambda's X-Ray segment or of the trace the caller's
+headers name, and exports it before returning, as the Lambda may be frozen straight after
+*/
+func (t Tracing) Wrap(operation string, h utils.APIHandler) utils.APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		headers := http.Header{}
+		for k, v := range request.Headers {
+			headers.Set(k, v)
+		}
+		ctx, span := t.tracer.Start(extract(ctx, headers), operation,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(invocationAttributes(ctx)...),
+			trace.WithAttributes(
+				semconv.FaaSTriggerHTTP,
+				semconv.HTTPRequestMethodKey.String(request.HTTPMethod),
+				semconv.HTTPRoute(request.Resource),
+				attribute.String("aws.api_gateway.request_id", request.RequestContext.RequestID),
+			),
+		)
+		res, err := h(ctx, request)
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+		setError(span, err)
+		if err == nil && (res.StatusCode == 0 || res.StatusCode >= 500) {
+			span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+		}
+		t.end(ctx, span)
+
+		return res, err
+	}
+}
+
+/*
+Creates a span for every invocation of a handler for events other than API requests, e.g. Cognito triggers, a child of
+the Lambda's X-Ray segment
+*/
+func WrapEvent[E any, R any](t Tracing, operation string, h func(context.Context, E) (R, error)) func(context.Context, E) (R, error) {
+	return func(ctx context.Context, event E) (R, error) {
+		ctx, span := t.tracer.Start(extract(ctx, http.Header{}), operation,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(invocationAttributes(ctx)...),
+			trace.WithAttributes(semconv.FaaSTriggerOther),
+		)
+		res, err := h(ctx, event)
+
+		setError(span, err)
+		t.end(ctx, span)
+
+		return res, err
+	}
+}
+
+func (t Tracing) end(ctx context.Context, span trace.Span) {
+	span.End()
+	// Failing to export shouldn't fail the request, the global handler logs it
+	if err := t.Flush(context.WithoutCancel(ctx)); err != nil {
+		otel.Handle(err)
+	}
+}
+
+func setError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// The parent named by the headers, with the Lambda's own trace header taking precedence over the caller's
+func extract(ctx context.Context, headers http.Header) context.Context {
+	if h := os.Getenv("_X_AMZN_TRACE_ID"); h != "" {
+		headers.Set(xrayHeader, h)
+	}
+	return Propagator.Extract(ctx, propagation.HeaderCarrier(headers))
+}
+
+func invocationAttributes(ctx context.Context) []attribute.KeyValue {
+	lc, ok := lambdacontext.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{semconv.FaaSInvocationID(lc.AwsRequestID), semconv.CloudResourceID(lc.InvokedFunctionArn)}
+}
+
+/*
+Adds the Lambda request ID and the trace ID to everything the logger logs, so that logs can be found from a trace and
+the other way round. The span ID is added too once a span has started.
+*/
+func Logger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	fields := []zap.Field{}
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		fields = append(fields, zap.String("request_id", lc.AwsRequestID))
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()), zap.String("span_id", sc.SpanID().String()))
+	} else if sc = trace.SpanContextFromContext(extract(ctx, http.Header{})); sc.IsValid() {
+		fields = append(fields, zap.String("trace_id", sc.TraceID().String()))
+	}
+	return logger.With(fields...)
+}
@@ -0,0 +1,136 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The instrumentation name spans are created with
+const TracerName = "github.com/benjaminkitson/bk-auth-api"
+
+const (
+	// Spans are created, so logs still get trace IDs, but aren't sent anywhere
+	ExporterNone = "none"
+	// Spans with X-Ray compatible IDs, sent over OTLP to the collector in the ADOT Lambda layer, which forwards them to X-Ray
+	ExporterXRay = "xray"
+	// Spans sent over OTLP/HTTP to OTEL_EXPORTER_OTLP_ENDPOINT
+	ExporterOTLP = "otlp"
+	// Spans written to stdout, for running locally
+	ExporterStdout = "stdout"
+)
+
+/*
+Propagates both W3C trace context and X-Ray trace headers. X-Ray comes last so that, when both are present, a span's
+parent is the Lambda's own segment.
+*/
+var Propagator propagation.TextMapPropagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+	xray.Propagator{},
+)
+
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+func New(provider *sdktrace.TracerProvider) Tracing {
+	return Tracing{provider: provider, tracer: provider.Tracer(TracerName)}
+}
+
+/*
+Sets up tracing with the exporter named by TRACING_EXPORTER (see the Exporter constants), none if it's unset, and
+registers it globally so that anything instrumented without a Tracing, e.g. the SDK config appconfig loads, uses it too.
+Lambdas should call it once, before they start.
+*/
+func FromEnv(ctx context.Context) (Tracing, error) {
+	t, err := fromEnv(ctx)
+	if err != nil {
+		t = New(NewProvider(nil))
+	}
+	t.Register()
+	return t, err
+}
+
+func fromEnv(ctx context.Context) (Tracing, error) {
+	var opts []sdktrace.TracerProviderOption
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch e := os.Getenv("TRACING_EXPORTER"); e {
+	case "", ExporterNone:
+	case ExporterXRay:
+		opts = append(opts, sdktrace.WithIDGenerator(xray.NewIDGenerator()))
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New()
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", e)
+	}
+	if err != nil {
+		return Tracing{}, err
+	}
+	return New(NewProvider(exporter, opts...)), nil
+}
+
+/*
+A provider that batches spans for the exporter, or doesn't export them if it's nil. Lambdas freeze between invocations,
+so the batch is flushed before each one returns, see Flush.
+*/
+func NewProvider(exporter sdktrace.SpanExporter, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append([]sdktrace.TracerProviderOption{sdktrace.WithResource(lambdaResource())}, opts...)
+	if exporter != nil {
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...)
+}
+
+func lambdaResource() *resource.Resource {
+	name := os.Getenv("AWS_LAMBDA_FUNCTION_NAME")
+	if name == "" {
+		name = "bk-auth-api"
+	}
+	return resource.NewSchemaless(
+		semconv.ServiceName(name),
+		semconv.ServiceNamespace("bk-auth-api"),
+		semconv.CloudProviderAWS,
+		semconv.CloudPlatformAWSLambda,
+		semconv.CloudRegion(os.Getenv("AWS_REGION")),
+		semconv.FaaSName(name),
+		semconv.FaaSVersion(os.Getenv("AWS_LAMBDA_FUNCTION_VERSION")),
+	)
+}
+
+/*
+Makes t the global tracer provider and propagator. bk-user-api's client sends requests with the default HTTP client, so
+its transport is wrapped too, which creates a span for each request and puts the trace headers on it.
+*/
+func (t Tracing) Register() {
+	otel.SetTracerProvider(t.provider)
+	otel.SetTextMapPropagator(Propagator)
+	if _, ok := http.DefaultTransport.(*otelhttp.Transport); !ok {
+		http.DefaultTransport = otelhttp.NewTransport(http.DefaultTransport,
+			otelhttp.WithTracerProvider(t.provider),
+			otelhttp.WithPropagators(Propagator),
+		)
+	}
+}
+
+// Exports every span that's ended. Wrap and WrapEvent call it once the invocation's span has ended.
+func (t Tracing) Flush(ctx context.Context) error {
+	return t.provider.ForceFlush(ctx)
+}
@@ -0,0 +1,359 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	cognito "github.com/benjaminkitson/bk-auth-api/cognitoadapter"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	xrayTrace   = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+)
+
+func newTracing() (Tracing, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return New(NewProvider(exporter)), exporter
+}
+
+func attributes(s tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	a := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes {
+		a[kv.Key] = kv.Value
+	}
+	return a
+}
+
+func TestWrap(t *testing.T) {
+	type test struct {
+		Name           string
+		Headers        map[string]string
+		LambdaTrace    string
+		Response       events.APIGatewayProxyResponse
+		Error          error
+		ExpectedTrace  string
+		ExpectedStatus codes.Code
+	}
+
+	tests := []test{
+		{
+			Name:           "Success",
+			Response:       utils.RESPONSE_200(`{"message": "Successfully signed in!"}`),
+			ExpectedStatus: codes.Unset,
+		},
+		{
+			Name:           "Caller's trace",
+			Headers:        map[string]string{"traceparent": traceparent},
+			Response:       utils.RESPONSE_401,
+			ExpectedTrace:  "4bf92f3577b34da6a3ce929d0e0e4736",
+			ExpectedStatus: codes.Unset,
+		},
+		{
+			Name:           "Lambda's trace",
+			Headers:        map[string]string{"traceparent": traceparent},
+			LambdaTrace:    xrayTrace,
+			Response:       utils.RESPONSE_200(`{}`),
+			ExpectedTrace:  "5759e988bd862e3fe1be46a994272793",
+			ExpectedStatus: codes.Unset,
+		},
+		{
+			Name:           "Failure",
+			Response:       utils.RESPONSE_500,
+			ExpectedStatus: codes.Error,
+		},
+		{
+			Name:           "Handler error",
+			Error:          fmt.Errorf("handler error"),
+			ExpectedStatus: codes.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			t.Setenv("_X_AMZN_TRACE_ID", tt.LambdaTrace)
+			tr, exporter := newTracing()
+			var handlerSpan trace.SpanContext
+			h := tr.Wrap("sign_in", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				handlerSpan = trace.SpanContextFromContext(ctx)
+				return tt.Response, tt.Error
+			})
+
+			ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-id"})
+			r, err := h(ctx, events.APIGatewayProxyRequest{HTTPMethod: http.MethodPost, Resource: "/signin", Headers: tt.Headers})
+			assert.Equal(t, tt.Response, r)
+			assert.Equal(t, tt.Error, err)
+
+			// Exported without any flushing by the test
+			spans := exporter.GetSpans()
+			assert.Len(t, spans, 1)
+			s := spans[0]
+			assert.Equal(t, "sign_in", s.Name)
+			assert.Equal(t, trace.SpanKindServer, s.SpanKind)
+			assert.Equal(t, handlerSpan, s.SpanContext)
+			assert.Equal(t, tt.ExpectedStatus, s.Status.Code)
+			if tt.ExpectedTrace != "" {
+				assert.Equal(t, tt.ExpectedTrace, s.SpanContext.TraceID().String())
+				assert.True(t, s.Parent.IsRemote())
+			} else {
+				assert.False(t, s.Parent.IsValid())
+			}
+
+			a := attributes(s)
+			assert.Equal(t, "POST", a["http.request.method"].AsString())
+			assert.Equal(t, "/signin", a["http.route"].AsString())
+			assert.Equal(t, "request-id", a["faas.invocation_id"].AsString())
+			assert.Equal(t, int64(r.StatusCode), a["http.response.status_code"].AsInt64())
+			assert.Equal(t, tt.Error != nil, len(s.Events) == 1)
+		})
+	}
+}
+
+func TestWrapEvent(t *testing.T) {
+	t.Setenv("_X_AMZN_TRACE_ID", xrayTrace)
+	tr, exporter := newTracing()
+	h := WrapEvent(tr, "pre_sign_up", func(ctx context.Context, event events.CognitoEventUserPoolsPreSignup) (events.CognitoEventUserPoolsPreSignup, error) {
+		if event.Request.UserAttributes["email"] == "" {
+			return event, fmt.Errorf("no email")
+		}
+		return event, nil
+	})
+
+	event := events.CognitoEventUserPoolsPreSignup{}
+	_, err := h(context.Background(), event)
+	assert.Error(t, err)
+	event.Request.UserAttributes = map[string]string{"email": "abc@gmail.com"}
+	_, err = h(context.Background(), event)
+	assert.Nil(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	for _, s := range spans {
+		assert.Equal(t, "pre_sign_up", s.Name)
+		assert.Equal(t, "5759e988bd862e3fe1be46a994272793", s.SpanContext.TraceID().String())
+		assert.Equal(t, "53995c3f42cd8ad8", s.Parent.SpanID().String())
+	}
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+}
+
+func TestLogger(t *testing.T) {
+	t.Setenv("_X_AMZN_TRACE_ID", xrayTrace)
+	tr, _ := newTracing()
+
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(&buf), zap.InfoLevel))
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{AwsRequestID: "request-id"})
+
+	// Before the handler's span has started
+	Logger(ctx, logger).Info("before")
+	var span trace.SpanContext
+	_, _ = WrapEvent(tr, "custom_message", func(ctx context.Context, event struct{}) (struct{}, error) {
+		span = trace.SpanContextFromContext(ctx)
+		Logger(ctx, logger).Info("during")
+		return event, nil
+	})(ctx, struct{}{})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+	var before, during map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &before))
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &during))
+
+	assert.Equal(t, "request-id", before["request_id"])
+	assert.Equal(t, "5759e988bd862e3fe1be46a994272793", before["trace_id"])
+	assert.NotContains(t, before, "span_id")
+	assert.Equal(t, "request-id", during["request_id"])
+	assert.Equal(t, "5759e988bd862e3fe1be46a994272793", during["trace_id"])
+	assert.Equal(t, span.SpanID().String(), during["span_id"])
+}
+
+// Answers every request with the status and body, keeping the requests it was sent
+type MockHTTPClient struct {
+	statusCode int
+	body       string
+	requests   *[]*http.Request
+}
+
+func (c MockHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	*c.requests = append(*c.requests, r)
+	return &http.Response{
+		StatusCode: c.statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+		Body:       io.NopCloser(strings.NewReader(c.body)),
+		Request:    r,
+	}, nil
+}
+
+func TestInstrumentAWS(t *testing.T) {
+	t.Setenv("_X_AMZN_TRACE_ID", "")
+	tr, exporter := newTracing()
+	requests := []*http.Request{}
+
+	for _, c := range []MockHTTPClient{
+		{statusCode: 200, body: `{}`, requests: &requests},
+		{statusCode: 400, body: `{"__type": "NotAuthorizedException", "message": "Incorrect username or password."}`, requests: &requests},
+	} {
+		cfg := aws.Config{
+			Region:      "eu-west-2",
+			Credentials: aws.AnonymousCredentials{},
+			HTTPClient:  c,
+		}
+		tr.InstrumentAWS(&cfg)
+		_, _ = WrapEvent(tr, "pre_token_generation", func(ctx context.Context, event struct{}) (struct{}, error) {
+			_, err := cognitoidentityprovider.NewFromConfig(cfg).InitiateAuth(ctx, &cognitoidentityprovider.InitiateAuthInput{
+				AuthFlow: "USER_PASSWORD_AUTH",
+				ClientId: aws.String("client"),
+			})
+			return event, err
+		})(context.Background(), struct{}{})
+	}
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 4)
+	calls := []tracetest.SpanStub{spans[0], spans[2]}
+	for i, s := range calls {
+		assert.Equal(t, "Cognito Identity Provider.InitiateAuth", s.Name)
+		assert.Equal(t, trace.SpanKindClient, s.SpanKind)
+		// A child of the handler's span, which ends after it
+		assert.Equal(t, spans[i*2+1].SpanContext.SpanID(), s.Parent.SpanID())
+		assert.Contains(t, requests[i].Header.Get("traceparent"), s.SpanContext.TraceID().String())
+	}
+	assert.Equal(t, codes.Unset, calls[0].Status.Code)
+	assert.Equal(t, codes.Error, calls[1].Status.Code)
+}
+
+// The adapter passes the handler's context on, so its Cognito calls are part of the request's trace
+func TestInstrumentAWSThroughAdapter(t *testing.T) {
+	t.Setenv("_X_AMZN_TRACE_ID", "")
+	tr, exporter := newTracing()
+	requests := []*http.Request{}
+	cfg := aws.Config{
+		Region:      "eu-west-2",
+		Credentials: aws.AnonymousCredentials{},
+		HTTPClient:  MockHTTPClient{statusCode: 400, body: `{"__type": "NotAuthorizedException", "message": "Incorrect username or password."}`, requests: &requests},
+	}
+	tr.InstrumentAWS(&cfg)
+	ca := cognito.NewAdapter(cognitoidentityprovider.NewFromConfig(cfg), "client", "pool", zap.NewNop())
+
+	_, err := tr.Wrap("sign_in", func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		_, err := ca.SignIn(ctx, map[string]string{"email": "abc@gmail.com", "password": "Abcabc123"})
+		return utils.RESPONSE_200(""), err
+	})(context.Background(), events.APIGatewayProxyRequest{Headers: map[string]string{"traceparent": traceparent}})
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "Cognito Identity Provider.InitiateAuth", spans[0].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext.TraceID().String())
+	assert.Contains(t, requests[0].Header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+}
+
+// Calls the server with the default HTTP client, as bk-user-api's client does
+type MockUserAPIClient struct {
+	url string
+}
+
+func (m MockUserAPIClient) get(ctx context.Context) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("User API error")
+	}
+	return nil
+}
+
+func (m MockUserAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	return models.User{}, m.get(ctx)
+}
+
+func (m MockUserAPIClient) DeleteUser(ctx context.Context, id string) (string, error) {
+	return id, m.get(ctx)
+}
+
+
+
+func TestInstrumentUserAPI(t *testing.T) {
+	t.Setenv("_X_AMZN_TRACE_ID", "")
+	tr, exporter := newTracing()
+	transport := http.DefaultTransport
+	defer func() { http.DefaultTransport = transport }()
+	tr.Register()
+
+	for _, isError := range []bool{false, true} {
+		exporter.Reset()
+		headers := []string{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers = append(headers, r.Header.Get("traceparent"))
+			if isError {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}))
+		defer server.Close()
+		c := tr.InstrumentUserAPI(MockUserAPIClient{url: server.URL})
+
+		ctx := context.Background()
+		_, err := c.CreateUser(ctx, "abc@gmail.com")
+		assert.Equal(t, isError, err != nil)
+		id, err := c.DeleteUser(ctx, "123")
+		assert.Equal(t, isError, err != nil)
+		assert.Equal(t, "123", id)
+		assert.Nil(t, tr.Flush(ctx))
+
+		spans := map[string]tracetest.SpanStub{}
+		for _, s := range exporter.GetSpans() {
+			if s.SpanKind == trace.SpanKindClient && strings.HasPrefix(s.Name, "UserAPI.") {
+				spans[s.Name] = s
+			}
+		}
+		assert.Len(t, exporter.GetSpans(), 4)
+		assert.Len(t, headers, 2)
+		for i, op := range []string{"CreateUser", "DeleteUser"} {
+			s, ok := spans["UserAPI."+op]
+			assert.True(t, ok, op)
+			assert.Equal(t, isError, s.Status.Code == codes.Error, op)
+			// The request carries the call's trace, through its own HTTP span
+			assert.Contains(t, headers[i], s.SpanContext.TraceID().String(), op)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	transport := http.DefaultTransport
+	defer func() { http.DefaultTransport = transport }()
+
+	for exporter, isError := range map[string]bool{"": false, ExporterNone: false, ExporterStdout: false, ExporterOTLP: false, ExporterXRay: false, "jaeger": true} {
+		t.Setenv("TRACING_EXPORTER", exporter)
+		tr, err := FromEnv(context.Background())
+		assert.Equal(t, isError, err != nil, exporter)
+		assert.NotNil(t, tr.provider, exporter)
+	}
+}
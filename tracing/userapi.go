@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-user-api/models"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type userAPIClient struct {
+	client metrics.UserAPIClient
+	tracer trace.Tracer
+}
+
+/*
+Creates a span for every call made through the client, as UserAPI.<method>. The HTTP requests it makes are its children,
+see Register.
+*/
+func (t Tracing) InstrumentUserAPI(c metrics.UserAPIClient) metrics.UserAPIClient {
+	return userAPIClient{client: c, tracer: t.tracer}
+}
+
+func (c userAPIClient) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "UserAPI."+operation, trace.WithSpanKind(trace.SpanKindClient))
+}
+
+func (c userAPIClient) CreateUser(ctx context.Context, email string) (models.User, error) {
+	ctx, span := c.start(ctx, "CreateUser")
+	u, err := c.client.CreateUser(ctx, email)
+	setError(span, err)
+	span.End()
+	return u, err
+}
+
+func (c userAPIClient) DeleteUser(ctx context.Context, id string) (string, error) {
+	ctx, span := c.start(ctx, "DeleteUser")
+	r, err := c.client.DeleteUser(ctx, id)
+	setError(span, err)
+	span.End()
+	return r, err
+}
+
+
+
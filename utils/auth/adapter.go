@@ -1,7 +1,38 @@
 package auth
 
-type AdapterHandler func(map[string]string) (map[string]string, error)
+import (
+	"context"
+	"errors"
+)
+
+type AdapterHandler func(context.Context, map[string]string) (map[string]string, error)
 
 type EmailVerifier interface {
-	VerifyEmail(map[string]string) (map[string]string, error)
+	VerifyEmail(context.Context, map[string]string) (map[string]string, error)
+}
+
+type GroupManager interface {
+	AddUserToGroup(context.Context, map[string]string) (map[string]string, error)
+	RemoveUserFromGroup(context.Context, map[string]string) (map[string]string, error)
+	ListGroupsForUser(context.Context, map[string]string) (map[string]string, error)
+}
+
+// A user as the auth provider has them
+type User struct {
+	ID    string
+	Email string
+	// Users only get a bk-user-api record once they've confirmed their sign up
+	Confirmed bool
+	// The bk-user-api record ID, empty until the record has been created
+	UserID string
 }
+
+type UserLister interface {
+	ListUsers(ctx context.Context) ([]User, error)
+}
+
+// Returned (wrapped) by adapters when a request is rejected before reaching the auth provider
+var ErrInvalidRequest = errors.New("invalid request body")
+
+// Returned (wrapped) by adapters when the auth provider rejects a token, e.g. an expired or revoked refresh token
+var ErrInvalidToken = errors.New("invalid token")
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"regexp"
+)
+
+// Error codes returned to clients alongside a 400, so that they can show something more useful than "Invalid request"
+const (
+	ErrCodeEmailDomainNotAllowed = "EMAIL_DOMAIN_NOT_ALLOWED"
+	ErrCodeDisposableEmail       = "DISPOSABLE_EMAIL"
+	ErrCodeValidationFailed      = "VALIDATION_FAILED"
+	ErrCodeRateLimited           = "RATE_LIMITED"
+	ErrCodePasswordBreached      = "PASSWORD_BREACHED"
+	ErrCodeInvalidCode           = "INVALID_CODE"
+)
+
+/*
+An error caused by the request rather than by the service. It's also how Cognito triggers reject requests: the
+trigger returns a RequestError, Cognito relays its message inside a UserLambdaValidationException, and the adapter
+turns it back into a RequestError with ParseRequestError.
+*/
+type RequestError struct {
+	Code    string
+	Message string
+}
+
+func (e RequestError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Lets RequestErrors be handled anywhere ErrInvalidRequest is
+func (e RequestError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// Cognito wraps trigger errors, e.g. "PreSignUp failed with error DISPOSABLE_EMAIL: Some message."
+var requestErrorPattern = regexp.MustCompile(`([A-Z][A-Z_]+): (.*?)\.?$`)
+
+func ParseRequestError(message string) (RequestError, bool) {
+	m := requestErrorPattern.FindStringSubmatch(message)
+	if m == nil {
+		return RequestError{}, false
+	}
+	return RequestError{Code: m[1], Message: m[2]}, true
+}
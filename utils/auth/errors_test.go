@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequestError(t *testing.T) {
+	type test struct {
+		Name          string
+		Message       string
+		ExpectedOk    bool
+		ExpectedError RequestError
+	}
+
+	tests := []test{
+		{
+			Name:          "Cognito trigger message",
+			Message:       "PreSignUp failed with error DISPOSABLE_EMAIL: Disposable email addresses are not allowed.",
+			ExpectedOk:    true,
+			ExpectedError: RequestError{Code: ErrCodeDisposableEmail, Message: "Disposable email addresses are not allowed"},
+		},
+		{
+			Name:          "Round trip",
+			Message:       RequestError{Code: ErrCodeEmailDomainNotAllowed, Message: "Nope"}.Error(),
+			ExpectedOk:    true,
+			ExpectedError: RequestError{Code: ErrCodeEmailDomainNotAllowed, Message: "Nope"},
+		},
+		{
+			Name:    "Unrelated message",
+			Message: "PreSignUp failed with error something went wrong.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			e, ok := ParseRequestError(tt.Message)
+			assert.Equal(t, tt.ExpectedOk, ok)
+			assert.Equal(t, tt.ExpectedError, e)
+		})
+	}
+}
+
+func TestRequestErrorIsInvalidRequest(t *testing.T) {
+	var err error = RequestError{Code: ErrCodeDisposableEmail}
+	assert.True(t, errors.Is(err, ErrInvalidRequest))
+}
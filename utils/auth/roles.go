@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Roles are backed by Cognito groups of the same name, declared in cdk/cdk.go
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleMember  = "member"
+)
+
+var Roles = []string{RoleAdmin, RoleSupport, RoleMember}
+
+func IsRole(r string) bool {
+	return slices.Contains(Roles, r)
+}
+
+var ErrUnauthenticated = errors.New("no verified token claims on request")
+var ErrForbidden = errors.New("caller does not have the required role")
+
+const groupsClaim = "cognito:groups"
+
+/*
+Returns the claims of the token verified by the API Gateway Cognito authorizer. Only routes that sit behind the
+authorizer have claims, so this should never be used to authenticate requests on any other route.
+*/
+func Claims(request events.APIGatewayProxyRequest) (map[string]interface{}, bool) {
+	c, ok := request.RequestContext.Authorizer["claims"].(map[string]interface{})
+	return c, ok
+}
+
+/*
+Returns the groups in the verified token's cognito:groups claim. API Gateway flattens list claims into a string,
+which depending on the integration looks like "admin,support" or "[admin support]", so both are handled.
+*/
+func Groups(request events.APIGatewayProxyRequest) []string {
+	c, ok := Claims(request)
+	if !ok {
+		return nil
+	}
+
+	switch g := c[groupsClaim].(type) {
+	case []interface{}:
+		groups := []string{}
+		for _, v := range g {
+			if s, ok := v.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	case string:
+		return strings.FieldsFunc(strings.Trim(g, "[]"), func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+	}
+	return nil
+}
+
+/*
+Checks that the caller has at least one of the given roles, returning ErrUnauthenticated if there are no verified
+claims at all and ErrForbidden if none of the roles match
+*/
+func RequireRole(request events.APIGatewayProxyRequest, roles ...string) error {
+	if _, ok := Claims(request); !ok {
+		return ErrUnauthenticated
+	}
+	for _, g := range Groups(request) {
+		if slices.Contains(roles, g) {
+			return nil
+		}
+	}
+	return ErrForbidden
+}
+
+// Returns an identifier for the caller suitable for the audit trail
+func Caller(request events.APIGatewayProxyRequest) string {
+	c, _ := Claims(request)
+	if e, ok := c["email"].(string); ok && e != "" {
+		return e
+	}
+	s, _ := c["sub"].(string)
+	return s
+}
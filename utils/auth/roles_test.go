@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWithClaims(claims map[string]interface{}) events.APIGatewayProxyRequest {
+	r := events.APIGatewayProxyRequest{}
+	if claims != nil {
+		r.RequestContext.Authorizer = map[string]interface{}{
+			"claims": claims,
+		}
+	}
+	return r
+}
+
+func TestRequireRole(t *testing.T) {
+	type test struct {
+		Name          string
+		Claims        map[string]interface{}
+		Roles         []string
+		ExpectedError error
+	}
+
+	tests := []test{
+		{
+			Name:   "Single group claim",
+			Claims: map[string]interface{}{"cognito:groups": "admin"},
+			Roles:  []string{RoleAdmin},
+		},
+		{
+			Name:   "Comma separated group claim",
+			Claims: map[string]interface{}{"cognito:groups": "member,support"},
+			Roles:  []string{RoleAdmin, RoleSupport},
+		},
+		{
+			Name:   "Bracketed group claim",
+			Claims: map[string]interface{}{"cognito:groups": "[member admin]"},
+			Roles:  []string{RoleAdmin},
+		},
+		{
+			Name:   "List group claim",
+			Claims: map[string]interface{}{"cognito:groups": []interface{}{"member", "admin"}},
+			Roles:  []string{RoleAdmin},
+		},
+		{
+			Name:          "Missing role",
+			Claims:        map[string]interface{}{"cognito:groups": "member"},
+			Roles:         []string{RoleAdmin},
+			ExpectedError: ErrForbidden,
+		},
+		{
+			Name:          "No groups claim",
+			Claims:        map[string]interface{}{"sub": "abc"},
+			Roles:         []string{RoleAdmin},
+			ExpectedError: ErrForbidden,
+		},
+		{
+			Name:          "No claims",
+			Roles:         []string{RoleAdmin},
+			ExpectedError: ErrUnauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			err := RequireRole(requestWithClaims(tt.Claims), tt.Roles...)
+			assert.Equal(t, tt.ExpectedError, err)
+		})
+	}
+}
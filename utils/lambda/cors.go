@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type APIHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+/*
+Which browser origins can call the API. cdk/cdk.go builds one of these per environment, passes it to the Lambdas
+with Environment, and the Lambdas read it back with CORSConfigFromEnv.
+*/
+type CORSConfig struct {
+	// Exact origins, e.g. "https://benjaminkitson.com", or subdomain wildcards, e.g. "https://*.benjaminkitson.com"
+	AllowedOrigins   []string
+	AllowCredentials bool
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	// How long browsers can cache preflight responses for, in seconds
+	MaxAge int
+}
+
+var DefaultAllowedHeaders = []string{"Content-Type", "Authorization", CSRFHeader}
+
+const (
+	corsAllowedOriginsEnv   = "CORS_ALLOWED_ORIGINS"
+	corsAllowCredentialsEnv = "CORS_ALLOW_CREDENTIALS"
+	corsAllowedHeadersEnv   = "CORS_ALLOWED_HEADERS"
+	corsExposedHeadersEnv   = "CORS_EXPOSED_HEADERS"
+	corsMaxAgeEnv           = "CORS_MAX_AGE"
+)
+
+// The environment variables CORSConfigFromEnv reads
+func (c CORSConfig) Environment() map[string]string {
+	return map[string]string{
+		corsAllowedOriginsEnv:   strings.Join(c.AllowedOrigins, ","),
+		corsAllowCredentialsEnv: strconv.FormatBool(c.AllowCredentials),
+		corsAllowedHeadersEnv:   strings.Join(c.AllowedHeaders, ","),
+		corsExposedHeadersEnv:   strings.Join(c.ExposedHeaders, ","),
+		corsMaxAgeEnv:           strconv.Itoa(c.MaxAge),
+	}
+}
+
+// With nothing configured no origins are allowed
+func CORSConfigFromEnv() CORSConfig {
+	c := CORSConfig{
+		AllowedOrigins: splitList(os.Getenv(corsAllowedOriginsEnv)),
+		AllowedHeaders: splitList(os.Getenv(corsAllowedHeadersEnv)),
+		ExposedHeaders: splitList(os.Getenv(corsExposedHeadersEnv)),
+	}
+	c.AllowCredentials, _ = strconv.ParseBool(os.Getenv(corsAllowCredentialsEnv))
+	c.MaxAge, _ = strconv.Atoi(os.Getenv(corsMaxAgeEnv))
+	if len(c.AllowedHeaders) == 0 {
+		c.AllowedHeaders = DefaultAllowedHeaders
+	}
+	return c
+}
+
+func splitList(s string) []string {
+	var l []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func (c CORSConfig) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+		prefix, suffix, ok := strings.Cut(o, "*.")
+		if !ok || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, "."+suffix) {
+			continue
+		}
+		// Whatever the wildcard matched has to be a subdomain, not a way to smuggle in a different host
+		sub := origin[len(prefix) : len(origin)-len(suffix)-1]
+		if sub != "" && !strings.ContainsAny(sub, "/:@?#") {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+The Access-Control-Allow-Origin value to use where the request's origin can't be checked, e.g. API Gateway's own error
+responses. That's only possible when a single exact origin, or any origin, is allowed.
+*/
+func (c CORSConfig) StaticOrigin() (string, bool) {
+	if slices.Contains(c.AllowedOrigins, "*") && !c.AllowCredentials {
+		return "*", true
+	}
+	if len(c.AllowedOrigins) == 1 && !strings.Contains(c.AllowedOrigins[0], "*") {
+		return c.AllowedOrigins[0], true
+	}
+	return "", false
+}
+
+// The CORS headers for a response to a request from origin, if it's allowed
+func (c CORSConfig) Headers(origin string, preflight bool) map[string]string {
+	h := map[string]string{"Vary": "Origin"}
+	if !c.AllowsOrigin(origin) {
+		return h
+	}
+
+	// Credentialed requests need the actual origin rather than a wildcard
+	if slices.Contains(c.AllowedOrigins, "*") && !c.AllowCredentials {
+		h["Access-Control-Allow-Origin"] = "*"
+	} else {
+		h["Access-Control-Allow-Origin"] = origin
+	}
+	if c.AllowCredentials {
+		h["Access-Control-Allow-Credentials"] = "true"
+	}
+
+	if preflight {
+		h["Access-Control-Allow-Headers"] = strings.Join(c.AllowedHeaders, ",")
+		if c.MaxAge > 0 {
+			h["Access-Control-Max-Age"] = strconv.Itoa(c.MaxAge)
+		}
+	} else if len(c.ExposedHeaders) > 0 {
+		h["Access-Control-Expose-Headers"] = strings.Join(c.ExposedHeaders, ",")
+	}
+	return h
+}
+
+/*
+Adds CORS headers to the handler's responses. Any the handler set are dropped first, so the config is the only thing
+deciding which origins are allowed.
+*/
+func (c CORSConfig) Wrap(h APIHandler) APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		r, err := h(ctx, request)
+
+		headers := make(map[string]string, len(r.Headers))
+		for k, v := range r.Headers {
+			// Methods are worked out by the handler's guard
+			ck := http.CanonicalHeaderKey(k)
+			if strings.HasPrefix(ck, "Access-Control-") && ck != "Access-Control-Allow-Methods" {
+				continue
+			}
+			headers[k] = v
+		}
+		for k, v := range c.Headers(Header(request, "Origin"), request.HTTPMethod == http.MethodOptions) {
+			headers[k] = v
+		}
+		r.Headers = headers
+
+		return r, err
+	}
+}
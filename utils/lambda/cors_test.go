@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowsOrigin(t *testing.T) {
+	c := CORSConfig{
+		AllowedOrigins: []string{"https://benjaminkitson.com", "https://*.benjaminkitson.com", "http://localhost:3000"},
+	}
+
+	type test struct {
+		Origin          string
+		ExpectedAllowed bool
+	}
+
+	tests := []test{
+		{Origin: "https://benjaminkitson.com", ExpectedAllowed: true},
+		{Origin: "https://app.benjaminkitson.com", ExpectedAllowed: true},
+		{Origin: "https://a.b.benjaminkitson.com", ExpectedAllowed: true},
+		{Origin: "http://localhost:3000", ExpectedAllowed: true},
+		{Origin: "http://localhost:4000"},
+		{Origin: "http://app.benjaminkitson.com"},
+		{Origin: "https://evilbenjaminkitson.com"},
+		{Origin: "https://benjaminkitson.com.evil.com"},
+		{Origin: "https://evil.com/.benjaminkitson.com"},
+		{Origin: "https://.benjaminkitson.com"},
+		{Origin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Origin, func(t *testing.T) {
+			assert.Equal(t, tt.ExpectedAllowed, c.AllowsOrigin(tt.Origin))
+		})
+	}
+}
+
+func TestCORSWrap(t *testing.T) {
+	c := CORSConfig{
+		AllowedOrigins:   []string{"https://*.benjaminkitson.com"},
+		AllowCredentials: true,
+		AllowedHeaders:   DefaultAllowedHeaders,
+		ExposedHeaders:   []string{"Retry-After"},
+		MaxAge:           600,
+	}
+
+	h := c.Wrap(func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		if request.HTTPMethod == "OPTIONS" {
+			return withHeaders(RESPONSE_204, map[string]string{"Access-Control-Allow-Methods": "POST,OPTIONS"}), nil
+		}
+		return withHeaders(RESPONSE_200("{}"), map[string]string{"Access-Control-Allow-Origin": "*"}), nil
+	})
+
+	type test struct {
+		Name            string
+		Method          string
+		Origin          string
+		ExpectedHeaders map[string]string
+	}
+
+	tests := []test{
+		{
+			Name:   "Allowed origin",
+			Method: "POST",
+			Origin: "https://app.benjaminkitson.com",
+			ExpectedHeaders: map[string]string{
+				"Content-Type":                     "application/json",
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Origin":      "https://app.benjaminkitson.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "Retry-After",
+			},
+		},
+		{
+			Name:   "Allowed origin preflight",
+			Method: "OPTIONS",
+			Origin: "https://app.benjaminkitson.com",
+			ExpectedHeaders: map[string]string{
+				"Content-Type":                     "application/json",
+				"Vary":                             "Origin",
+				"Access-Control-Allow-Origin":      "https://app.benjaminkitson.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "POST,OPTIONS",
+				"Access-Control-Allow-Headers":     "Content-Type,Authorization,X-CSRF-Token",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			Name:   "Disallowed origin",
+			Method: "POST",
+			Origin: "https://evil.com",
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "application/json",
+				"Vary":         "Origin",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			r, err := h(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod: tt.Method,
+				Headers:    map[string]string{"origin": tt.Origin},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.ExpectedHeaders, r.Headers)
+			// The shared headers mustn't be modified
+			assert.Len(t, Headers, 1)
+		})
+	}
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	c := CORSConfig{
+		AllowedOrigins:   []string{"https://benjaminkitson.com", "https://*.benjaminkitson.com"},
+		AllowCredentials: true,
+		AllowedHeaders:   DefaultAllowedHeaders,
+		ExposedHeaders:   []string{"Retry-After"},
+		MaxAge:           600,
+	}
+	for k, v := range c.Environment() {
+		t.Setenv(k, v)
+	}
+	assert.Equal(t, c, CORSConfigFromEnv())
+}
+
+func TestStaticOrigin(t *testing.T) {
+	type test struct {
+		Name           string
+		Config         CORSConfig
+		ExpectedOrigin string
+		ExpectedOk     bool
+	}
+
+	tests := []test{
+		{
+			Name:           "Single origin",
+			Config:         CORSConfig{AllowedOrigins: []string{"https://benjaminkitson.com"}, AllowCredentials: true},
+			ExpectedOrigin: "https://benjaminkitson.com",
+			ExpectedOk:     true,
+		},
+		{
+			Name:           "Any origin",
+			Config:         CORSConfig{AllowedOrigins: []string{"*"}},
+			ExpectedOrigin: "*",
+			ExpectedOk:     true,
+		},
+		{
+			Name:   "Any origin with credentials",
+			Config: CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		},
+		{
+			Name:   "Subdomains",
+			Config: CORSConfig{AllowedOrigins: []string{"https://*.benjaminkitson.com"}},
+		},
+		{
+			Name:   "Several origins",
+			Config: CORSConfig{AllowedOrigins: []string{"https://benjaminkitson.com", "http://localhost:3000"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			o, ok := tt.Config.StaticOrigin()
+			assert.Equal(t, tt.ExpectedOrigin, o)
+			assert.Equal(t, tt.ExpectedOk, ok)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Comfortably more than any of the request bodies we accept
+const DefaultMaxBodySize = 16 * 1024
+
+/*
+Checks what every API handler needs checking before it looks at the body: that the method is one the route supports,
+that the body is JSON and not too big. It also answers CORS preflight requests, and decodes bodies API Gateway has
+base64 encoded.
+*/
+type Guard struct {
+	// The methods the route supports, OPTIONS is always allowed
+	Methods []string
+	// Defaults to DefaultMaxBodySize
+	MaxBodySize int
+}
+
+/*
+Returns false and the response to send if the request should go no further. Otherwise the request is left with a
+plain text body, so handlers don't need to care whether it was encoded.
+*/
+func (g Guard) Check(request *events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, bool) {
+	allow := strings.Join(append(slices.Clone(g.Methods), http.MethodOptions), ",")
+
+	if request.HTTPMethod == http.MethodOptions {
+		return withHeaders(RESPONSE_204, map[string]string{
+			"Allow":                        allow,
+			"Access-Control-Allow-Methods": allow,
+		}), false
+	}
+
+	if !slices.Contains(g.Methods, request.HTTPMethod) {
+		return withHeaders(RESPONSE_405, map[string]string{"Allow": allow}), false
+	}
+
+	if request.IsBase64Encoded {
+		b, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return RESPONSE_400, false
+		}
+		request.Body = string(b)
+		request.IsBase64Encoded = false
+	}
+
+	max := g.MaxBodySize
+	if max == 0 {
+		max = DefaultMaxBodySize
+	}
+	if len(request.Body) > max {
+		return RESPONSE_413, false
+	}
+
+	if request.Body != "" && !isJSON(Header(*request, "Content-Type")) {
+		return RESPONSE_415, false
+	}
+
+	return events.APIGatewayProxyResponse{}, true
+}
+
+// Returns the value of a request header, ignoring the casing the caller used
+func Header(request events.APIGatewayProxyRequest, name string) string {
+	for k, v := range request.Headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isJSON(contentType string) bool {
+	t, _, err := mime.ParseMediaType(contentType)
+	return err == nil && t == "application/json"
+}
+
+// Copies the response's headers rather than adding to the shared map
+func withHeaders(r events.APIGatewayProxyResponse, headers map[string]string) events.APIGatewayProxyResponse {
+	h := make(map[string]string, len(r.Headers)+len(headers))
+	for k, v := range r.Headers {
+		h[k] = v
+	}
+	for k, v := range headers {
+		h[k] = v
+	}
+	r.Headers = h
+	return r
+}
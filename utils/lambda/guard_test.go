@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuard(t *testing.T) {
+	type test struct {
+		Name               string
+		Method             string
+		ContentType        string
+		Body               string
+		IsBase64Encoded    bool
+		ExpectedOk         bool
+		ExpectedStatusCode int
+		ExpectedAllow      string
+		ExpectedBody       string
+	}
+
+	tests := []test{
+		{
+			Name:         "Allowed request",
+			Method:       "POST",
+			ContentType:  "application/json",
+			Body:         "{\"email\": \"abc@gmail.com\"}",
+			ExpectedOk:   true,
+			ExpectedBody: "{\"email\": \"abc@gmail.com\"}",
+		},
+		{
+			Name:         "Content type with charset",
+			Method:       "POST",
+			ContentType:  "Application/JSON; charset=utf-8",
+			Body:         "{}",
+			ExpectedOk:   true,
+			ExpectedBody: "{}",
+		},
+		{
+			Name:         "No body",
+			Method:       "GET",
+			ExpectedOk:   true,
+			ExpectedBody: "",
+		},
+		{
+			Name:            "Base64 encoded body",
+			Method:          "POST",
+			ContentType:     "application/json",
+			Body:            base64.StdEncoding.EncodeToString([]byte("{\"email\": \"abc@gmail.com\"}")),
+			IsBase64Encoded: true,
+			ExpectedOk:      true,
+			ExpectedBody:    "{\"email\": \"abc@gmail.com\"}",
+		},
+		{
+			Name:               "Invalid base64 body",
+			Method:             "POST",
+			ContentType:        "application/json",
+			Body:               "{not base64}",
+			IsBase64Encoded:    true,
+			ExpectedStatusCode: 400,
+		},
+		{
+			Name:               "Preflight",
+			Method:             "OPTIONS",
+			ExpectedStatusCode: 204,
+			ExpectedAllow:      "GET,POST,OPTIONS",
+		},
+		{
+			Name:               "Method not allowed",
+			Method:             "DELETE",
+			ExpectedStatusCode: 405,
+			ExpectedAllow:      "GET,POST,OPTIONS",
+		},
+		{
+			Name:               "Form body",
+			Method:             "POST",
+			ContentType:        "application/x-www-form-urlencoded",
+			Body:               "email=abc%40gmail.com",
+			ExpectedStatusCode: 415,
+		},
+		{
+			Name:               "Missing content type",
+			Method:             "POST",
+			Body:               "{}",
+			ExpectedStatusCode: 415,
+		},
+		{
+			Name:               "Body too large",
+			Method:             "POST",
+			ContentType:        "application/json",
+			Body:               "\"" + strings.Repeat("a", 100) + "\"",
+			ExpectedStatusCode: 413,
+		},
+	}
+
+	g := Guard{
+		Methods:     []string{"GET", "POST"},
+		MaxBodySize: 100,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{
+				HTTPMethod:      tt.Method,
+				Headers:         map[string]string{"content-type": tt.ContentType},
+				Body:            tt.Body,
+				IsBase64Encoded: tt.IsBase64Encoded,
+			}
+
+			r, ok := g.Check(&req)
+			assert.Equal(t, tt.ExpectedOk, ok)
+			if ok {
+				assert.Equal(t, tt.ExpectedBody, req.Body)
+				assert.False(t, req.IsBase64Encoded)
+				return
+			}
+			assert.Equal(t, tt.ExpectedStatusCode, r.StatusCode)
+			assert.Equal(t, tt.ExpectedAllow, r.Headers["Allow"])
+			// The shared headers mustn't be modified
+			assert.NotContains(t, Headers, "Allow")
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	assert.Equal(t, "abc", BearerToken(events.APIGatewayProxyRequest{Headers: map[string]string{"authorization": "Bearer abc"}}))
+	assert.Equal(t, "", BearerToken(events.APIGatewayProxyRequest{Headers: map[string]string{"Authorization": "Basic abc"}}))
+	assert.Equal(t, "", BearerToken(events.APIGatewayProxyRequest{}))
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	AccessTokenCookie  = "bk_access_token"
+	RefreshTokenCookie = "bk_refresh_token"
+	// Readable by the client, which sends it back in CSRFHeader
+	CSRFCookie = "bk_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+var ErrCSRF = errors.New("missing or mismatched CSRF token")
+
+/*
+Cookie mode keeps tokens out of reach of the browser's JavaScript. Sign in and refresh set them as HttpOnly cookies
+instead of returning them in the body, and authenticated endpoints accept the access token cookie as well as the
+Authorization header. Cookies are sent automatically, so requests authenticated by one also need the double submit
+CSRF token.
+
+The ID token is deliberately still returned in the body. The role protected routes expect it in the Authorization
+header, and none of the endpoints here accept it in place of the access token, so having it readable only exposes the
+claims the client is shown anyway.
+*/
+type SessionConfig struct {
+	Cookies bool
+	// The domain the CSRF cookie is set for, so clients on other subdomains can read it. Token cookies are host only.
+	Domain   string
+	SameSite http.SameSite
+	// The refresh token is only ever sent to the refresh endpoint. Relative to the API, see ForRequest.
+	RefreshPath string
+	// Cognito doesn't tell us how long refresh tokens last, so this should match the app client's setting
+	RefreshTokenMaxAge time.Duration
+}
+
+const (
+	sessionCookiesEnv        = "SESSION_COOKIES"
+	sessionCookieDomainEnv   = "SESSION_COOKIE_DOMAIN"
+	sessionCookieSameSiteEnv = "SESSION_COOKIE_SAME_SITE"
+)
+
+// Cognito's default refresh token validity
+const defaultRefreshTokenMaxAge = 30 * 24 * time.Hour
+
+// The environment variables SessionConfigFromEnv reads
+func (c SessionConfig) Environment() map[string]string {
+	s := "strict"
+	switch c.SameSite {
+	case http.SameSiteLaxMode:
+		s = "lax"
+	case http.SameSiteNoneMode:
+		s = "none"
+	}
+	return map[string]string{
+		sessionCookiesEnv:        strconv.FormatBool(c.Cookies),
+		sessionCookieDomainEnv:   c.Domain,
+		sessionCookieSameSiteEnv: s,
+	}
+}
+
+func SessionConfigFromEnv() SessionConfig {
+	c := SessionConfig{
+		Domain:             os.Getenv(sessionCookieDomainEnv),
+		SameSite:           http.SameSiteStrictMode,
+		RefreshPath:        "/refresh",
+		RefreshTokenMaxAge: defaultRefreshTokenMaxAge,
+	}
+	c.Cookies, _ = strconv.ParseBool(os.Getenv(sessionCookiesEnv))
+	switch strings.ToLower(os.Getenv(sessionCookieSameSiteEnv)) {
+	case "lax":
+		c.SameSite = http.SameSiteLaxMode
+	case "none":
+		c.SameSite = http.SameSiteNoneMode
+	}
+	return c
+}
+
+/*
+Puts RefreshPath under the path the request reached the API by. Without a custom domain API Gateway serves the API
+under its stage, e.g. /prod/refresh, and a custom domain's base path mapping adds its own prefix instead. Either way
+it's the part of the request context's path before the resource.
+*/
+func (c SessionConfig) ForRequest(request events.APIGatewayProxyRequest) SessionConfig {
+	p := request.RequestContext.Path
+	if request.Resource != "" && strings.HasSuffix(p, request.Resource) {
+		c.RefreshPath = strings.TrimSuffix(p, request.Resource) + c.RefreshPath
+	}
+	return c
+}
+
+/*
+Moves the tokens from an adapter's token response into Set-Cookie headers, returning them with what's left of the body.
+The ID token stays in the body, see SessionConfig.
+*/
+func (c SessionConfig) TokenCookies(tokens map[string]string) ([]string, map[string]string, error) {
+	body := make(map[string]string, len(tokens))
+	for k, v := range tokens {
+		if k != "token" && k != "refreshToken" {
+			body[k] = v
+		}
+	}
+
+	expiresIn, err := strconv.Atoi(tokens["expiresIn"])
+	if err != nil {
+		expiresIn = int(time.Hour.Seconds())
+	}
+
+	cookies := []string{
+		c.cookie(AccessTokenCookie, tokens["token"], "", "/", expiresIn, true),
+	}
+	// Refreshing doesn't issue a new refresh token, so the existing cookie and CSRF token are left alone
+	if tokens["refreshToken"] != "" {
+		csrf, err := csrfToken()
+		if err != nil {
+			return nil, nil, err
+		}
+		cookies = append(cookies,
+			c.cookie(RefreshTokenCookie, tokens["refreshToken"], "", c.RefreshPath, int(c.RefreshTokenMaxAge.Seconds()), true),
+			c.cookie(CSRFCookie, csrf, c.Domain, "/", int(c.RefreshTokenMaxAge.Seconds()), false),
+		)
+	}
+	return cookies, body, nil
+}
+
+func WithCookies(r events.APIGatewayProxyResponse, cookies []string) events.APIGatewayProxyResponse {
+	if len(cookies) == 0 {
+		return r
+	}
+	r.MultiValueHeaders = map[string][]string{"Set-Cookie": cookies}
+	return r
+}
+
+func (c SessionConfig) cookie(name string, value string, domain string, path string, maxAge int, httpOnly bool) string {
+	ck := http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   domain,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   true,
+		SameSite: c.SameSite,
+	}
+	return ck.String()
+}
+
+func csrfToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*
+Returns the access token from the Authorization header or, in cookie mode, the access token cookie. An empty token
+means the request isn't authenticated.
+*/
+func (c SessionConfig) AccessToken(request events.APIGatewayProxyRequest) (string, error) {
+	if t := BearerToken(request); t != "" {
+		return t, nil
+	}
+	return c.cookieToken(request, AccessTokenCookie)
+}
+
+// Returns the refresh token cookie, or an empty string outside cookie mode
+func (c SessionConfig) RefreshToken(request events.APIGatewayProxyRequest) (string, error) {
+	return c.cookieToken(request, RefreshTokenCookie)
+}
+
+func (c SessionConfig) cookieToken(request events.APIGatewayProxyRequest, name string) (string, error) {
+	if !c.Cookies {
+		return "", nil
+	}
+	t := Cookie(request, name)
+	if t == "" {
+		return "", nil
+	}
+
+	csrf := Cookie(request, CSRFCookie)
+	h := Header(request, CSRFHeader)
+	if csrf == "" || subtle.ConstantTimeCompare([]byte(csrf), []byte(h)) != 1 {
+		return "", ErrCSRF
+	}
+	return t, nil
+}
+
+// Returns the value of a request cookie, or an empty string if there isn't one
+func Cookie(request events.APIGatewayProxyRequest, name string) string {
+	hr := http.Request{Header: http.Header{}}
+	for k, v := range request.MultiValueHeaders {
+		if http.CanonicalHeaderKey(k) == "Cookie" {
+			hr.Header["Cookie"] = append(hr.Header["Cookie"], v...)
+		}
+	}
+	if v := Header(request, "Cookie"); v != "" && len(hr.Header) == 0 {
+		hr.Header.Add("Cookie", v)
+	}
+	ck, err := hr.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return ck.Value
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCookies(t *testing.T) {
+	c := SessionConfig{
+		Cookies:            true,
+		Domain:             "benjaminkitson.com",
+		SameSite:           http.SameSiteStrictMode,
+		RefreshPath:        "/refresh",
+		RefreshTokenMaxAge: time.Hour,
+	}
+
+	cookies, body, err := c.TokenCookies(map[string]string{
+		"message":      "Successfully signed in!",
+		"token":        "mockToken",
+		"refreshToken": "mockRefreshToken",
+		"idToken":      "mockIdToken",
+		"expiresIn":    "600",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"message": "Successfully signed in!", "idToken": "mockIdToken", "expiresIn": "600"}, body)
+
+	assert.Len(t, cookies, 3)
+	assert.Equal(t, "bk_access_token=mockToken; Path=/; Max-Age=600; HttpOnly; Secure; SameSite=Strict", cookies[0])
+	assert.Equal(t, "bk_refresh_token=mockRefreshToken; Path=/refresh; Max-Age=3600; HttpOnly; Secure; SameSite=Strict", cookies[1])
+	// The client has to be able to read the CSRF token to send it back
+	assert.True(t, strings.HasPrefix(cookies[2], "bk_csrf="))
+	assert.NotContains(t, cookies[2], "HttpOnly")
+	assert.Contains(t, cookies[2], "Domain=benjaminkitson.com")
+
+	// Refreshing only replaces the access token
+	cookies, _, err = c.TokenCookies(map[string]string{"token": "mockToken"})
+	assert.Nil(t, err)
+	assert.Len(t, cookies, 1)
+}
+
+func TestForRequest(t *testing.T) {
+	c := SessionConfig{Cookies: true, RefreshPath: "/refresh"}
+	for _, tt := range []struct {
+		Name         string
+		Path         string
+		ExpectedPath string
+	}{
+		{Name: "stage", Path: "/prod/signin", ExpectedPath: "/prod/refresh"},
+		{Name: "base path mapping", Path: "/auth/signin", ExpectedPath: "/auth/refresh"},
+		{Name: "custom domain without a base path", Path: "/signin", ExpectedPath: "/refresh"},
+		{Name: "unknown", ExpectedPath: "/refresh"},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := events.APIGatewayProxyRequest{Resource: "/signin", RequestContext: events.APIGatewayProxyRequestContext{Path: tt.Path}}
+			assert.Equal(t, tt.ExpectedPath, c.ForRequest(r).RefreshPath)
+		})
+	}
+	// Left as it is
+	assert.Equal(t, "/refresh", c.RefreshPath)
+}
+
+func TestAccessToken(t *testing.T) {
+	type test struct {
+		Name          string
+		Cookies       bool
+		Headers       map[string]string
+		ExpectedToken string
+		ExpectedError error
+	}
+
+	tests := []test{
+		{
+			Name:          "Bearer token",
+			Headers:       map[string]string{"Authorization": "Bearer headerToken"},
+			ExpectedToken: "headerToken",
+		},
+		{
+			Name:          "Bearer token takes precedence",
+			Cookies:       true,
+			Headers:       map[string]string{"Authorization": "Bearer headerToken", "Cookie": "bk_access_token=cookieToken"},
+			ExpectedToken: "headerToken",
+		},
+		{
+			Name:          "Cookie with CSRF token",
+			Cookies:       true,
+			Headers:       map[string]string{"cookie": "a=b; bk_access_token=cookieToken; bk_csrf=csrf", "x-csrf-token": "csrf"},
+			ExpectedToken: "cookieToken",
+		},
+		{
+			Name:          "Cookie without CSRF token",
+			Cookies:       true,
+			Headers:       map[string]string{"Cookie": "bk_access_token=cookieToken; bk_csrf=csrf"},
+			ExpectedError: ErrCSRF,
+		},
+		{
+			Name:          "CSRF header without cookie",
+			Cookies:       true,
+			Headers:       map[string]string{"Cookie": "bk_access_token=cookieToken", "X-CSRF-Token": ""},
+			ExpectedError: ErrCSRF,
+		},
+		{
+			Name:    "Cookie outside cookie mode",
+			Headers: map[string]string{"Cookie": "bk_access_token=cookieToken; bk_csrf=csrf", "X-CSRF-Token": "csrf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			c := SessionConfig{Cookies: tt.Cookies}
+			token, err := c.AccessToken(events.APIGatewayProxyRequest{Headers: tt.Headers})
+			assert.Equal(t, tt.ExpectedToken, token)
+			assert.Equal(t, tt.ExpectedError, err)
+		})
+	}
+}
+
+func TestSessionConfigFromEnv(t *testing.T) {
+	c := SessionConfig{
+		Cookies:            true,
+		Domain:             "benjaminkitson.com",
+		SameSite:           http.SameSiteLaxMode,
+		RefreshPath:        "/refresh",
+		RefreshTokenMaxAge: defaultRefreshTokenMaxAge,
+	}
+	for k, v := range c.Environment() {
+		t.Setenv(k, v)
+	}
+	assert.Equal(t, c, SessionConfigFromEnv())
+}
@@ -0,0 +1,214 @@
+/*
+Starts the Lambdas. Each one builds its handler for every invocation and hands it to API or Event, which set up tracing,
+config, CORS and auditing once for the instance, and log, measure and trace every invocation the same way.
+*/
+package start
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/benjaminkitson/bk-auth-api/appconfig"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/metrics"
+	"github.com/benjaminkitson/bk-auth-api/tracing"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"go.uber.org/zap"
+)
+
+// How long a request waits for its audit event to be written before responding anyway
+const auditFlushTimeout = time.Second
+
+// How long the audit queue has to be written once Lambda says the instance is shutting down
+const shutdownTimeout = 400 * time.Millisecond
+
+// What a handler is built with for each invocation
+type Invocation struct {
+	// Carries the invocation's trace and span IDs
+	Logger  *zap.Logger
+	Metrics metrics.Metrics
+	Tracing tracing.Tracing
+}
+
+// Loads the SDK config with the invocation's metrics and tracing middleware
+func (i Invocation) AWSConfig(ctx context.Context) (aws.Config, error) {
+	sdkConfig, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	i.Metrics.InstrumentAWS(&sdkConfig)
+	i.Tracing.InstrumentAWS(&sdkConfig)
+	return sdkConfig, nil
+}
+
+// Measures and traces every call the bk-user-api client makes
+func (i Invocation) UserAPI(c metrics.UserAPIClient) metrics.UserAPIClient {
+	return i.Tracing.InstrumentUserAPI(i.Metrics.InstrumentUserAPI(c))
+}
+
+type options struct {
+	config interface{}
+	audit  bool
+}
+
+type Option func(*options)
+
+/*
+Loads cfg with appconfig. Every Lambda sets up its config sources once tracing is, so that loading is traced too, and
+exits if they or cfg can't be loaded.
+*/
+func WithConfig(cfg interface{}) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+/*
+Records an audit event for every request, with the operation as its action. Only API uses it. Each request waits for
+its event to be written before responding, as Lambda can freeze the instance as soon as it has, though never for longer
+than auditFlushTimeout. Anything a timed out write leaves behind is written with the next request's.
+*/
+func WithAudit() Option {
+	return func(o *options) {
+		o.audit = true
+	}
+}
+
+// Sets up whatever lives for as long as the instance
+func setup(opts []Option) (options, tracing.Tracing) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	tr, err := tracing.FromEnv(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to initialise tracing, spans won't be exported: %v", err)
+	}
+
+	if o.config == nil {
+		o.config = &struct{}{}
+	}
+	if err := appconfig.LoadFromEnv(context.Background(), o.config); err != nil {
+		fmt.Printf("Failed to load config: %v", err)
+		os.Exit(1)
+	}
+	return o, tr
+}
+
+func newInvocation(ctx context.Context, tr tracing.Tracing) Invocation {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		fmt.Printf("Failed to initialise logger: %v", err)
+		logger = &zap.Logger{}
+	}
+	logger = tracing.Logger(ctx, logger)
+	return Invocation{
+		Logger:  logger,
+		Metrics: metrics.New(metrics.NewLoggerSink(logger)),
+		Tracing: tr,
+	}
+}
+
+/*
+Serves API Gateway requests with the handler build returns for each invocation. Every request is traced, measured as
+operation and gets CORS headers from the environment.
+*/
+func API(operation string, build func(context.Context, Invocation) (utils.APIHandler, error), opts ...Option) {
+	o, tr := setup(opts)
+
+	var recorder *audit.Recorder
+	if o.audit {
+		var err error
+		recorder, err = audit.RecorderFromEnv(context.Background())
+		if err != nil {
+			fmt.Printf("Failed to initialise audit sink, using stdout: %v", err)
+		}
+	}
+
+	h := apiHandler(operation, build, tr, utils.CORSConfigFromEnv(), recorder)
+	if recorder == nil {
+		lambda.Start(h)
+		return
+	}
+	// Lambda only sends SIGTERM when an extension is registered, e.g. the ADOT collector layer, so this is only a backstop
+	lambda.StartWithOptions(h, lambda.WithEnableSIGTERM(flushOnShutdown(recorder)))
+}
+
+func flushOnShutdown(recorder *audit.Recorder) func() {
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := recorder.Flush(ctx); err != nil {
+			fmt.Printf("Failed to write audit events on shutdown: %v", err)
+		}
+	}
+}
+
+func apiHandler(operation string, build func(context.Context, Invocation) (utils.APIHandler, error), tr tracing.Tracing, cors utils.CORSConfig, recorder *audit.Recorder) utils.APIHandler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		inv := newInvocation(ctx, tr)
+		defer inv.Logger.Sync()
+
+		h, err := build(ctx, inv)
+		if err != nil {
+			inv.Logger.Error("Failed to initialise handler", zap.Error(err))
+			return events.APIGatewayProxyResponse{}, err
+		}
+
+		h = inv.Metrics.Wrap(operation, h)
+		if recorder == nil {
+			return tr.Wrap(operation, cors.Wrap(h))(ctx, request)
+		}
+
+		r, err := tr.Wrap(operation, cors.Wrap(recorder.Wrap(audit.Action(operation), h)))(ctx, request)
+		flushAudit(ctx, inv, operation, recorder)
+		return r, err
+	}
+}
+
+func flushAudit(ctx context.Context, inv Invocation, operation string, recorder *audit.Recorder) {
+	ctx, cancel := context.WithTimeout(ctx, auditFlushTimeout)
+	defer cancel()
+	err := recorder.Flush(ctx)
+	if err == nil {
+		return
+	}
+	inv.Logger.Error("Failed to write audit events", zap.Error(err))
+
+	var d audit.DroppedError
+	if errors.As(err, &d) {
+		inv.Metrics.Put(metrics.Dimensions{Operation: operation, Outcome: metrics.OutcomeFailure},
+			metrics.Value{Name: metrics.MetricAuditEventsDropped, Unit: metrics.UnitCount, Value: float64(d.Count)})
+	}
+}
+
+// Like API, for Lambdas invoked with other events, e.g. Cognito triggers and schedules
+func Event[E any, R any](operation string, build func(context.Context, Invocation) (func(context.Context, E) (R, error), error), opts ...Option) {
+	_, tr := setup(opts)
+
+	lambda.Start(eventHandler(operation, build, tr))
+}
+
+func eventHandler[E any, R any](operation string, build func(context.Context, Invocation) (func(context.Context, E) (R, error), error), tr tracing.Tracing) func(context.Context, E) (R, error) {
+	return func(ctx context.Context, event E) (R, error) {
+		inv := newInvocation(ctx, tr)
+		defer inv.Logger.Sync()
+
+		h, err := build(ctx, inv)
+		if err != nil {
+			inv.Logger.Error("Failed to initialise handler", zap.Error(err))
+			var r R
+			return r, err
+		}
+
+		return tracing.WrapEvent(tr, operation, metrics.WrapEvent(inv.Metrics, operation, h))(ctx, event)
+	}
+}
@@ -0,0 +1,136 @@
+package start
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/audit"
+	"github.com/benjaminkitson/bk-auth-api/tracing"
+	utils "github.com/benjaminkitson/bk-auth-api/utils/lambda"
+	"github.com/stretchr/testify/assert"
+)
+
+// Every request gets CORS headers and an audit event, and the handler is built afresh for each one
+func TestAPI(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "audit.jsonl")
+	recorder := audit.NewRecorder(audit.NewFileSink(p), audit.DefaultQueueSize)
+	cors := utils.CORSConfig{AllowedOrigins: []string{"https://benjaminkitson.com"}}
+
+	builds := 0
+	h := apiHandler(string(audit.ActionSignIn), func(ctx context.Context, inv Invocation) (utils.APIHandler, error) {
+		builds++
+		assert.NotNil(t, inv.Logger)
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return utils.RESPONSE_200("{}"), nil
+		}, nil
+	}, tracing.New(tracing.NewProvider(nil)), cors, recorder)
+
+	req := events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Headers:    map[string]string{"Origin": "https://benjaminkitson.com"},
+	}
+	for range 2 {
+		r, err := h(context.Background(), req)
+		assert.Nil(t, err)
+		assert.Equal(t, 200, r.StatusCode)
+		assert.Equal(t, "https://benjaminkitson.com", r.Headers["Access-Control-Allow-Origin"])
+	}
+	assert.Equal(t, 2, builds)
+
+	assert.NoError(t, recorder.Flush(context.Background()))
+	events, err := audit.ReadFile(p)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, audit.ActionSignIn, events[0].Action)
+}
+
+// Blocks writes until it's released
+type slowSink struct {
+	release chan struct{}
+	written chan []audit.Event
+}
+
+func (s slowSink) Write(ctx context.Context, events []audit.Event) error {
+	<-s.release
+	s.written <- events
+	return nil
+}
+
+// Lambda can freeze the instance once the response is returned, so the audit event is written before it is
+func TestAPIWaitsForAudit(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "audit.jsonl")
+	recorder := audit.NewRecorder(audit.NewFileSink(p), audit.DefaultQueueSize)
+
+	h := apiHandler(string(audit.ActionSignIn), func(ctx context.Context, inv Invocation) (utils.APIHandler, error) {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return utils.RESPONSE_200("{}"), nil
+		}, nil
+	}, tracing.New(tracing.NewProvider(nil)), utils.CORSConfig{}, recorder)
+
+	r, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST"})
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	events, err := audit.ReadFile(p)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+// A sink that's too slow doesn't hold the response up for long, what it hasn't written goes with the next request's
+func TestAPIAuditTimeout(t *testing.T) {
+	sink := slowSink{release: make(chan struct{}), written: make(chan []audit.Event, 2)}
+	recorder := audit.NewRecorder(sink, audit.DefaultQueueSize)
+
+	h := apiHandler(string(audit.ActionSignIn), func(ctx context.Context, inv Invocation) (utils.APIHandler, error) {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+			return utils.RESPONSE_200("{}"), nil
+		}, nil
+	}, tracing.New(tracing.NewProvider(nil)), utils.CORSConfig{}, recorder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r, err := h(ctx, events.APIGatewayProxyRequest{HTTPMethod: "POST"})
+	assert.Nil(t, err)
+	assert.Equal(t, 200, r.StatusCode)
+	assert.Empty(t, sink.written)
+
+	close(sink.release)
+	_, err = h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST"})
+	assert.Nil(t, err)
+	assert.Len(t, <-sink.written, 1)
+	assert.Len(t, <-sink.written, 1)
+
+	flushOnShutdown(recorder)()
+	assert.Empty(t, sink.written)
+}
+
+func TestAPIBuildError(t *testing.T) {
+	h := apiHandler("fallback", func(ctx context.Context, inv Invocation) (utils.APIHandler, error) {
+		return nil, fmt.Errorf("no client")
+	}, tracing.New(tracing.NewProvider(nil)), utils.CORSConfig{}, nil)
+
+	_, err := h(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: "POST"})
+	assert.EqualError(t, err, "no client")
+}
+
+func TestEvent(t *testing.T) {
+	h := eventHandler("pre_sign_up", func(ctx context.Context, inv Invocation) (func(context.Context, string) (string, error), error) {
+		return func(ctx context.Context, event string) (string, error) {
+			return event + " handled", nil
+		}, nil
+	}, tracing.New(tracing.NewProvider(nil)))
+
+	r, err := h(context.Background(), "event")
+	assert.Nil(t, err)
+	assert.Equal(t, "event handled", r)
+
+	h = eventHandler("pre_sign_up", func(ctx context.Context, inv Invocation) (func(context.Context, string) (string, error), error) {
+		return nil, fmt.Errorf("no client")
+	}, tracing.New(tracing.NewProvider(nil)))
+
+	_, err = h(context.Background(), "event")
+	assert.EqualError(t, err, "no client")
+}
@@ -0,0 +1,16 @@
+package utils
+
+import (
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Returns the bearer token from the request's Authorization header, or an empty string if there isn't one
+func BearerToken(request events.APIGatewayProxyRequest) string {
+	t, ok := strings.CutPrefix(Header(request, "Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(t)
+}
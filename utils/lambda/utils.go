@@ -2,12 +2,20 @@ package utils
 
 // TODO: Not sure if this package name follows correct convention with respect to folder structure
 
-import "github.com/aws/aws-lambda-go/events"
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
 
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/benjaminkitson/bk-auth-api/utils/auth"
+	"github.com/benjaminkitson/bk-auth-api/utils/validation"
+)
+
+// CORS headers are added per request, see CORSConfig
 var Headers = map[string]string{
-	"Access-Control-Allow-Headers": "Content-Type",
-	"Access-Control-Allow-Origin":  "*",
-	"Access-Control-Allow-Methods": "OPTIONS,POST,GET",
+	"Content-Type": "application/json",
 }
 
 var RESPONSE_500 = events.APIGatewayProxyResponse{
@@ -22,6 +30,51 @@ var RESPONSE_400 = events.APIGatewayProxyResponse{
 	Body:       "{\"message\": \"Invalid request\"}",
 }
 
+var RESPONSE_401 = events.APIGatewayProxyResponse{
+	StatusCode: 401,
+	Headers:    Headers,
+	Body:       "{\"message\": \"Unauthorized\"}",
+}
+
+var RESPONSE_403 = events.APIGatewayProxyResponse{
+	StatusCode: 403,
+	Headers:    Headers,
+	Body:       "{\"message\": \"Forbidden\"}",
+}
+
+var RESPONSE_204 = events.APIGatewayProxyResponse{
+	StatusCode: 204,
+	Headers:    Headers,
+}
+
+var RESPONSE_405 = events.APIGatewayProxyResponse{
+	StatusCode: 405,
+	Headers:    Headers,
+	Body:       "{\"message\": \"Method not allowed\"}",
+}
+
+var RESPONSE_413 = events.APIGatewayProxyResponse{
+	StatusCode: 413,
+	Headers:    Headers,
+	Body:       "{\"message\": \"Request body too large\"}",
+}
+
+var RESPONSE_415 = events.APIGatewayProxyResponse{
+	StatusCode: 415,
+	Headers:    Headers,
+	Body:       "{\"message\": \"Request body must be JSON\"}",
+}
+
+// Tells the client how long to wait, in whole seconds rounded up
+func RESPONSE_429(retryAfter time.Duration) events.APIGatewayProxyResponse {
+	return withHeaders(RESPONSE_ERROR(429, auth.ErrCodeRateLimited, "Too many attempts, try again later"), map[string]string{
+		"Retry-After": strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))),
+	})
+}
+
+// A password that meets the policy but has turned up in known breaches, see the breach package
+var RESPONSE_PASSWORD_BREACHED = RESPONSE_ERROR(400, auth.ErrCodePasswordBreached, "This password has appeared in a data breach, choose a different one")
+
 func RESPONSE_200(body string) events.APIGatewayProxyResponse {
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
@@ -29,3 +82,45 @@ func RESPONSE_200(body string) events.APIGatewayProxyResponse {
 		Body:       body,
 	}
 }
+
+// Accepted, but the work will finish in the background
+func RESPONSE_202(body string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: 202,
+		Headers:    Headers,
+		Body:       body,
+	}
+}
+
+// A 4xx response that tells the client why the request failed, with a code it can act on
+func RESPONSE_ERROR(statusCode int, code string, message string) events.APIGatewayProxyResponse {
+	b, err := json.Marshal(map[string]string{
+		"message": message,
+		"code":    code,
+	})
+	if err != nil {
+		return RESPONSE_500
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    Headers,
+		Body:       string(b),
+	}
+}
+
+// A 400 listing every invalid field, so the client can show each problem next to the field it relates to
+func RESPONSE_VALIDATION(errs validation.Errors) events.APIGatewayProxyResponse {
+	b, err := json.Marshal(map[string]interface{}{
+		"message": "Invalid request",
+		"code":    auth.ErrCodeValidationFailed,
+		"errors":  errs,
+	})
+	if err != nil {
+		return RESPONSE_500
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 400,
+		Headers:    Headers,
+		Body:       string(b),
+	}
+}
@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logged in place of values that must never be written anywhere, such as passwords and codes
+const Redacted = "[REDACTED]"
+
+/*
+Returns a short, stable hash of the value, so that log lines about the same user or token can be correlated without
+the value itself ending up in CloudWatch. Only suitable for values that can't be guessed, like tokens, or that are
+only sensitive rather than secret, like emails.
+*/
+func Hash(v string) string {
+	if v == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(v))
+	return "sha256:" + hex.EncodeToString(h[:8])
+}
+
+// Emails are normalised first, so that the same address always hashes the same way
+func HashEmail(v string) string {
+	return Hash(strings.ToLower(strings.TrimSpace(v)))
+}
+
+func redact(v string) string {
+	if v == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// An email address, or any other identifier for a user, hashed
+func Email(key string, v string) zap.Field {
+	return zap.String(key, HashEmail(v))
+}
+
+// An access, ID or refresh token, or a Cognito session, hashed
+func Token(key string, v string) zap.Field {
+	return zap.String(key, Hash(v))
+}
+
+// Passwords are redacted rather than hashed, as a hash of a weak one is easily reversed
+func Password(key string, v string) zap.Field {
+	return zap.String(key, redact(v))
+}
+
+// Verification and reset codes are short enough to brute force from a hash too
+func Code(key string, v string) zap.Field {
+	return zap.String(key, redact(v))
+}
+
+func Secret(key string, v string) zap.Field {
+	return zap.String(key, redact(v))
+}
+
+type sensitivity int
+
+const (
+	public sensitivity = iota
+	hashed
+	hashedEmail
+	redacted
+)
+
+// Decides how a value is logged from the name of the field or attribute that holds it
+func classify(name string) sensitivity {
+	n := strings.ToLower(name)
+	switch {
+	case n == "email" || n == "previousemail" || n == "username" || n == "caller":
+		return hashedEmail
+	case strings.Contains(n, "password") || strings.Contains(n, "secret"):
+		return redacted
+	case n == "code" || strings.HasSuffix(n, "confirmationcode") || strings.HasSuffix(n, "verificationcode"):
+		return redacted
+	case n == "tokentype":
+		return public
+	case strings.Contains(n, "token") || n == "session":
+		return hashed
+	}
+	return public
+}
+
+func scrub(name string, v string) string {
+	switch classify(name) {
+	case hashed:
+		return Hash(v)
+	case hashedEmail:
+		return HashEmail(v)
+	case redacted:
+		return redact(v)
+	}
+	return v
+}
+
+type body map[string]string
+
+func (b body) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for k, v := range b {
+		enc.AddString(k, scrub(k, v))
+	}
+	return nil
+}
+
+// A request or response body, with each field redacted or hashed according to its name
+func Body(key string, b map[string]string) zap.Field {
+	return zap.Object(key, body(b))
+}
+
+/*
+Any value that marshals to JSON, such as an SDK output, with sensitive fields redacted or hashed according to their
+names. Name/value pairs like Cognito's user attributes are redacted according to the name. Use this in place of
+zap.Any for anything that may hold user data.
+*/
+func Output(key string, v interface{}) zap.Field {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return zap.String(key, Redacted)
+	}
+	var g interface{}
+	if err := json.Unmarshal(b, &g); err != nil {
+		return zap.String(key, Redacted)
+	}
+	return zap.Any(key, walk("", g))
+}
+
+func walk(name string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		// Attribute pairs, e.g. {"Name": "email", "Value": "abc@gmail.com"}
+		if n, ok := t["Name"].(string); ok {
+			if s, ok := t["Value"].(string); ok {
+				t["Value"] = scrub(n, s)
+			}
+		}
+		for k, c := range t {
+			t[k] = walk(k, c)
+		}
+		return t
+	case []interface{}:
+		for i, c := range t {
+			t[i] = walk(name, c)
+		}
+		return t
+	case string:
+		return scrub(name, t)
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider"
+	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+var sensitive = []string{
+	"abc@gmail.com",
+	"Abcabc123",
+	"123456",
+	"mockAccessToken",
+	"mockIdToken",
+	"mockRefreshToken",
+	"mockSession",
+	"mockSecret",
+}
+
+// Everything the logs contain, as it would be written out
+func captured(logs *observer.ObservedLogs) string {
+	s := ""
+	for _, e := range logs.All() {
+		s += e.Message + fmt.Sprint(e.ContextMap())
+	}
+	return s
+}
+
+func TestFieldsRedactSensitiveValues(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	l := zap.New(core)
+
+	l.Info("fields",
+		Email("email", " ABC@gmail.com"),
+		Password("password", "Abcabc123"),
+		Code("code", "123456"),
+		Token("token", "mockAccessToken"),
+		Secret("secret", "mockSecret"),
+	)
+	l.Info("body", Body("body", map[string]string{
+		"email":            "abc@gmail.com",
+		"password":         "Abcabc123",
+		"previousPassword": "Abcabc123",
+		"code":             "123456",
+		"session":          "mockSession",
+		"refreshToken":     "mockRefreshToken",
+		"locale":           "en-GB",
+	}))
+	l.Info("output", Output("output", &cognitoidentityprovider.InitiateAuthOutput{
+		Session: aws.String("mockSession"),
+		AuthenticationResult: &types.AuthenticationResultType{
+			AccessToken:  aws.String("mockAccessToken"),
+			IdToken:      aws.String("mockIdToken"),
+			RefreshToken: aws.String("mockRefreshToken"),
+			TokenType:    aws.String("Bearer"),
+			ExpiresIn:    3600,
+		},
+	}))
+	l.Info("attributes", Output("output", &cognitoidentityprovider.AdminCreateUserOutput{
+		User: &types.UserType{
+			Username: aws.String("abc@gmail.com"),
+			Attributes: []types.AttributeType{
+				{Name: aws.String("email"), Value: aws.String("abc@gmail.com")},
+				{Name: aws.String("locale"), Value: aws.String("en-GB")},
+			},
+		},
+	}))
+
+	out := captured(logs)
+	for _, s := range sensitive {
+		assert.NotContains(t, out, s)
+	}
+	// Values that aren't sensitive are left alone
+	assert.Contains(t, out, "en-GB")
+	assert.Contains(t, out, "Bearer")
+	assert.Contains(t, out, "3600")
+}
+
+func TestHashesCorrelate(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	l := zap.New(core)
+
+	l.Info("one", Email("email", "abc@gmail.com"))
+	l.Info("two", Body("body", map[string]string{"email": "Abc@Gmail.com"}))
+	l.Info("three", Email("email", "def@gmail.com"))
+
+	e := logs.All()
+	one := e[0].ContextMap()["email"]
+	two := e[1].ContextMap()["body"].(map[string]interface{})["email"]
+	three := e[2].ContextMap()["email"]
+	assert.Equal(t, one, two)
+	assert.NotEqual(t, one, three)
+	assert.Equal(t, HashEmail("abc@gmail.com"), one)
+}
+
+func TestEmptyValuesStayEmpty(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	zap.New(core).Info("empty", Password("password", ""), Token("token", ""))
+
+	assert.Equal(t, "", logs.All()[0].ContextMap()["password"])
+	assert.Equal(t, "", logs.All()[0].ContextMap()["token"])
+}
+
+func TestOutputUnmarshalable(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	zap.New(core).Info("output", Output("output", func() {}))
+
+	assert.Equal(t, Redacted, logs.All()[0].ContextMap()["output"])
+}
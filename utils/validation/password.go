@@ -0,0 +1,81 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type PasswordPolicy struct {
+	MinLength        int
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigits    bool
+	RequireSymbols   bool
+}
+
+// The user pool's password policy. cdk/cdk.go configures the pool from this, so the two can't drift apart.
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:        8,
+	RequireLowercase: true,
+	RequireUppercase: true,
+	RequireDigits:    true,
+	RequireSymbols:   false,
+}
+
+// Cognito's maximum password length
+const maxPasswordLength = 256
+
+// The symbols Cognito accepts as special characters
+const passwordSymbols = "^$*.[]{}()?\"!@#%&/\\,><':;|_~`=+- "
+
+func (p PasswordPolicy) Rule() Rule {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		var lower, upper, digit, symbol bool
+		for _, c := range value {
+			switch {
+			case unicode.IsLower(c):
+				lower = true
+			case unicode.IsUpper(c):
+				upper = true
+			case unicode.IsDigit(c):
+				digit = true
+			case strings.ContainsRune(passwordSymbols, c):
+				symbol = true
+			}
+		}
+
+		var missing []string
+		if p.RequireLowercase && !lower {
+			missing = append(missing, "a lowercase letter")
+		}
+		if p.RequireUppercase && !upper {
+			missing = append(missing, "an uppercase letter")
+		}
+		if p.RequireDigits && !digit {
+			missing = append(missing, "a number")
+		}
+		if p.RequireSymbols && !symbol {
+			missing = append(missing, "a symbol")
+		}
+
+		switch {
+		case len(value) < p.MinLength:
+			return fmt.Sprintf("must be at least %d characters", p.MinLength)
+		case len(value) > maxPasswordLength:
+			return fmt.Sprintf("must be at most %d characters", maxPasswordLength)
+		case len(missing) > 0:
+			return "must contain " + strings.Join(missing, ", ")
+		}
+		return ""
+	}
+}
+
+// A new password, checked against the pool's policy
+var Password = DefaultPasswordPolicy.Rule()
+
+// A password that's already set, which may predate the current policy
+var ExistingPassword = MaxLength(maxPasswordLength)
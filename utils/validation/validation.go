@@ -0,0 +1,118 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Checks a single field, returning a message describing the problem or "" if the value is fine
+type Rule func(value string) string
+
+/*
+Maps request body fields to the rules they have to satisfy. Rules other than Required accept empty values, so
+optional fields just leave Required out.
+*/
+type Schema map[string][]Rule
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, fe := range e {
+		s[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(s, ", ")
+}
+
+// Returns the first failing rule for each field, ordered by field name, or nil if the body is valid
+func (s Schema) Validate(body map[string]string) Errors {
+	fields := make([]string, 0, len(s))
+	for f := range s {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var errs Errors
+	for _, f := range fields {
+		for _, r := range s[f] {
+			if m := r(body[f]); m != "" {
+				errs = append(errs, FieldError{Field: f, Message: m})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+func Required(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+// Cognito's limit for string attributes and the maximum length of an email address
+const (
+	maxAttributeLength = 2048
+	maxEmailLength     = 254
+)
+
+func Email(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) > maxEmailLength {
+		return fmt.Sprintf("must be at most %d characters", maxEmailLength)
+	}
+	// ParseAddress accepts display names, e.g. "Ben <ben@example.com>", which Cognito doesn't
+	a, err := mail.ParseAddress(value)
+	if err != nil || a.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+var codePattern = regexp.MustCompile(`^[0-9]{6}$`)
+
+// Cognito's verification and confirmation codes
+func Code(value string) string {
+	if value != "" && !codePattern.MatchString(value) {
+		return "must be a 6 digit code"
+	}
+	return ""
+}
+
+func MaxLength(n int) Rule {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) > n {
+			return fmt.Sprintf("must be at most %d characters", n)
+		}
+		return ""
+	}
+}
+
+func OneOf(values ...string) Rule {
+	return func(value string) string {
+		if value == "" {
+			return ""
+		}
+		for _, v := range values {
+			if value == v {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(values, ", ")
+	}
+}
+
+// A free text attribute, e.g. name
+var Attribute = MaxLength(maxAttributeLength)
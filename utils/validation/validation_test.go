@@ -0,0 +1,117 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	schema := Schema{
+		"email":    {Required, Email},
+		"password": {Required, Password},
+		"code":     {Code},
+		"role":     {OneOf("admin", "member")},
+		"name":     {MaxLength(5)},
+	}
+
+	type test struct {
+		Name           string
+		Body           map[string]string
+		ExpectedErrors Errors
+	}
+
+	tests := []test{
+		{
+			Name: "Valid body",
+			Body: map[string]string{"email": "abc@gmail.com", "password": "Password123", "code": "123456", "role": "admin", "name": "Ben"},
+		},
+		{
+			Name: "Optional fields missing",
+			Body: map[string]string{"email": "abc@gmail.com", "password": "Password123"},
+		},
+		{
+			Name: "Required fields missing",
+			Body: map[string]string{"email": " "},
+			ExpectedErrors: Errors{
+				{Field: "email", Message: "is required"},
+				{Field: "password", Message: "is required"},
+			},
+		},
+		{
+			Name: "Every field invalid",
+			Body: map[string]string{"email": "Ben <abc@gmail.com>", "password": "password", "code": "1234", "role": "superuser", "name": "Benjamin"},
+			ExpectedErrors: Errors{
+				{Field: "code", Message: "must be a 6 digit code"},
+				{Field: "email", Message: "must be a valid email address"},
+				{Field: "name", Message: "must be at most 5 characters"},
+				{Field: "password", Message: "must contain an uppercase letter, a number"},
+				{Field: "role", Message: "must be one of admin, member"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.ExpectedErrors, schema.Validate(tt.Body))
+		})
+	}
+}
+
+func TestEmail(t *testing.T) {
+	valid := []string{"abc@gmail.com", "a.b+c@mail.example.co.uk"}
+	invalid := []string{"abc", "abc@", "@gmail.com", "abc@gmail", "abc@@gmail.com", "Ben <abc@gmail.com>"}
+
+	for _, e := range valid {
+		assert.Empty(t, Email(e), e)
+	}
+	for _, e := range invalid {
+		assert.NotEmpty(t, Email(e), e)
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	type test struct {
+		Name            string
+		Policy          PasswordPolicy
+		Password        string
+		ExpectedMessage string
+	}
+
+	tests := []test{
+		{
+			Name:     "Meets default policy",
+			Policy:   DefaultPasswordPolicy,
+			Password: "Password123",
+		},
+		{
+			Name:            "Too short",
+			Policy:          DefaultPasswordPolicy,
+			Password:        "Pass1",
+			ExpectedMessage: "must be at least 8 characters",
+		},
+		{
+			Name:            "Missing lowercase",
+			Policy:          DefaultPasswordPolicy,
+			Password:        "PASSWORD123",
+			ExpectedMessage: "must contain a lowercase letter",
+		},
+		{
+			Name:            "Missing symbol",
+			Policy:          PasswordPolicy{MinLength: 8, RequireSymbols: true},
+			Password:        "password",
+			ExpectedMessage: "must contain a symbol",
+		},
+		{
+			Name:     "Has symbol",
+			Policy:   PasswordPolicy{MinLength: 8, RequireSymbols: true},
+			Password: "password!",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			assert.Equal(t, tt.ExpectedMessage, tt.Policy.Rule()(tt.Password))
+		})
+	}
+}